@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/minhlong/go-aws-boilerplate/internal/schema"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+const usage = `Inspects and replays the insight job dead letter queue.
+
+  dlq list     [-shop ID] [-max N]
+  dlq show     -id MESSAGE_ID
+  dlq validate -id MESSAGE_ID | -file BODY.json
+  dlq replay   -id ID[,ID] | -shop ID | -all  [-file BODY.json] [-force] [-dry-run]
+
+An edited payload is replayed by saving it with show, editing the file and passing it to replay with -file and
+the message id. Against a local SQS compatible endpoint, e.g. ElasticMQ:
+
+  go run ./cmd/dlq list -endpoint http://localhost:9324 -region elasticmq \
+    -dlq http://localhost:9324/000000000000/insight-async-job-dlq \
+    -queue http://localhost:9324/000000000000/insight-async-job
+
+Common flags:
+`
+
+type options struct {
+	endpoint string
+	region   string
+	dlq      string
+	queue    string
+	max      int
+	shopID   int64
+	ids      string
+	file     string
+	all      bool
+	force    bool
+	dryRun   bool
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage(newFlagSet("dlq", &options{}))
+		os.Exit(2)
+	}
+
+	// Logs go to stderr, stdout carries the listings and shown bodies
+	logging.InitWithOutput(os.Stderr)
+
+	command := os.Args[1]
+	opts := &options{}
+	flags := newFlagSet(command, opts)
+	if err := flags.Parse(os.Args[2:]); err != nil {
+		os.Exit(2)
+	}
+	if opts.dlq == "" {
+		fmt.Fprintln(os.Stderr, "the dead letter queue url is missing, set -dlq or INSIGHT_JOB_DLQ_URL")
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	q := newQueues(opts.endpoint, opts.region, opts.dlq, opts.queue)
+
+	var err error
+	switch command {
+	case "list":
+		err = list(ctx, q, opts)
+	case "show":
+		err = show(ctx, q, opts)
+	case "validate":
+		err = validate(ctx, q, opts)
+	case "replay":
+		err = replay(ctx, q, opts)
+	default:
+		printUsage(flags)
+		os.Exit(2)
+	}
+	q.release(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func newFlagSet(command string, opts *options) *flag.FlagSet {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.StringVar(&opts.endpoint, "endpoint", os.Getenv("SQS_ENDPOINT"), "SQS compatible endpoint, empty for AWS")
+	flags.StringVar(&opts.region, "region", os.Getenv("AWS_REGION"), "region of the queues")
+	flags.StringVar(&opts.dlq, "dlq", os.Getenv("INSIGHT_JOB_DLQ_URL"), "dead letter queue url")
+	flags.StringVar(&opts.queue, "queue", os.Getenv("INSIGHT_JOB_QUEUE_URL"), "main queue url messages are replayed to")
+	flags.IntVar(&opts.max, "max", 100, "maximum number of messages read from the dead letter queue")
+	flags.Int64Var(&opts.shopID, "shop", 0, "only messages of this shop")
+	flags.StringVar(&opts.ids, "id", "", "comma separated message ids")
+	flags.StringVar(&opts.file, "file", "", "edited message body, replaces the body of the single selected message")
+	flags.BoolVar(&opts.all, "all", false, "replay every message read")
+	flags.BoolVar(&opts.force, "force", false, "replay bodies that fail validation")
+	flags.BoolVar(&opts.dryRun, "dry-run", false, "print what would be replayed without sending")
+	flags.Usage = func() { printUsage(flags) }
+
+	return flags
+}
+
+func printUsage(flags *flag.FlagSet) {
+	fmt.Fprint(os.Stderr, usage)
+	flags.SetOutput(os.Stderr)
+	flags.PrintDefaults()
+}
+
+func list(ctx context.Context, q *queues, opts *options) error {
+	letters, err := q.receive(ctx, opts.max, opts.shopID)
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "MESSAGE ID\tSHOP\tRECEIVES\tKIND\tREASON\tVALID")
+	for _, letter := range letters {
+		valid := "yes"
+		if _, err := schema.Decode([]byte(letter.Body)); err != nil {
+			valid = err.Error()
+		}
+		fmt.Fprintf(writer, "%s\t%d\t%d\t%s\t%s\t%s\n", letter.MessageID, letter.ShopID, letter.ReceiveCount, letter.Kind(), letter.Reason(), valid)
+	}
+	fmt.Fprintf(writer, "%d messages\n", len(letters))
+
+	return writer.Flush()
+}
+
+func show(ctx context.Context, q *queues, opts *options) error {
+	letter, err := selectOne(ctx, q, opts)
+	if err != nil {
+		return err
+	}
+
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, []byte(letter.Body), "", "  "); err != nil {
+		fmt.Println(letter.Body)
+		return nil
+	}
+	fmt.Println(pretty.String())
+
+	return nil
+}
+
+func validate(ctx context.Context, q *queues, opts *options) error {
+	var body []byte
+	if opts.file != "" {
+		var err error
+		if body, err = os.ReadFile(opts.file); err != nil {
+			return err
+		}
+	} else {
+		letter, err := selectOne(ctx, q, opts)
+		if err != nil {
+			return err
+		}
+		body = []byte(letter.Body)
+	}
+
+	request, err := schema.Decode(body)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("valid, shop %d, version %d\n", request.ShopID, request.Version)
+
+	return nil
+}
+
+func replay(ctx context.Context, q *queues, opts *options) error {
+	if opts.queue == "" {
+		return fmt.Errorf("the main queue url is missing, set -queue or INSIGHT_JOB_QUEUE_URL")
+	}
+	if opts.ids == "" && opts.shopID == 0 && !opts.all {
+		return fmt.Errorf("select messages with -id, -shop or -all")
+	}
+
+	letters, err := q.receive(ctx, opts.max, opts.shopID)
+	if err != nil {
+		return err
+	}
+	letters = filterIDs(letters, opts.ids)
+
+	var edited string
+	if opts.file != "" {
+		if len(letters) != 1 {
+			return fmt.Errorf("-file replaces the body of exactly one message, %d are selected", len(letters))
+		}
+		body, err := os.ReadFile(opts.file)
+		if err != nil {
+			return err
+		}
+		edited = string(body)
+	}
+
+	failed := 0
+	for _, letter := range letters {
+		body := letter.Body
+		if edited != "" {
+			body = edited
+		}
+
+		if _, err := schema.Decode([]byte(body)); err != nil && !opts.force {
+			fmt.Printf("%s: skipped, %v\n", letter.MessageID, err)
+			failed++
+			continue
+		}
+		if opts.dryRun {
+			fmt.Printf("%s: would replay shop %d\n", letter.MessageID, letter.ShopID)
+			continue
+		}
+
+		if err := q.replay(ctx, letter, body); err != nil {
+			fmt.Printf("%s: %v\n", letter.MessageID, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s: replayed\n", letter.MessageID)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d messages not replayed", failed, len(letters))
+	}
+
+	return nil
+}
+
+func selectOne(ctx context.Context, q *queues, opts *options) (*deadLetter, error) {
+	if opts.ids == "" || strings.Contains(opts.ids, ",") {
+		return nil, fmt.Errorf("select one message with -id")
+	}
+
+	letters, err := q.receive(ctx, opts.max, opts.shopID)
+	if err != nil {
+		return nil, err
+	}
+	letters = filterIDs(letters, opts.ids)
+	if len(letters) == 0 {
+		return nil, fmt.Errorf("message %s is not on the dead letter queue, or is in flight", opts.ids)
+	}
+
+	return &letters[0], nil
+}
+
+func filterIDs(letters []deadLetter, ids string) []deadLetter {
+	if ids == "" {
+		return letters
+	}
+
+	wanted := map[string]bool{}
+	for _, id := range strings.Split(ids, ",") {
+		wanted[strings.TrimSpace(id)] = true
+	}
+
+	selected := letters[:0]
+	for _, letter := range letters {
+		if wanted[letter.MessageID] {
+			selected = append(selected, letter)
+		}
+	}
+
+	return selected
+}
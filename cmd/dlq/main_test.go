@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/minhlong/go-aws-boilerplate/internal/funcservice"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+const (
+	validBody   = `{"v": 2, "sid": 12, "since": "2024-04-01T00:00:00Z", "until": "2024-04-01T00:00:00Z"}`
+	invalidBody = `{"v": 4, "sid": 34}`
+)
+
+// fakeSQS serves its messages on the first receive and records what is sent to the main queue and deleted from
+// the dead letter queue.
+type fakeSQS struct {
+	sqsiface.SQSAPI
+	messages []*sqs.Message
+	received bool
+	sent     []*sqs.SendMessageInput
+	deleted  []string
+}
+
+func (f *fakeSQS) ReceiveMessageWithContext(_ aws.Context, _ *sqs.ReceiveMessageInput, _ ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	if f.received {
+		return &sqs.ReceiveMessageOutput{}, nil
+	}
+	f.received = true
+
+	return &sqs.ReceiveMessageOutput{Messages: f.messages}, nil
+}
+
+func (f *fakeSQS) SendMessageWithContext(_ aws.Context, input *sqs.SendMessageInput, _ ...request.Option) (*sqs.SendMessageOutput, error) {
+	f.sent = append(f.sent, input)
+
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func (f *fakeSQS) DeleteMessageWithContext(_ aws.Context, input *sqs.DeleteMessageInput, _ ...request.Option) (*sqs.DeleteMessageOutput, error) {
+	f.deleted = append(f.deleted, aws.StringValue(input.ReceiptHandle))
+
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (f *fakeSQS) ChangeMessageVisibilityWithContext(_ aws.Context, _ *sqs.ChangeMessageVisibilityInput, _ ...request.Option) (*sqs.ChangeMessageVisibilityOutput, error) {
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func message(id string, body string) *sqs.Message {
+	return &sqs.Message{
+		MessageId:     aws.String(id),
+		ReceiptHandle: aws.String("handle-" + id),
+		Body:          aws.String(body),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			"traceparent":                      {DataType: aws.String("String"), StringValue: aws.String("00-trace")},
+			funcservice.FailureKindAttribute:   {DataType: aws.String("String"), StringValue: aws.String("permanent")},
+			funcservice.FailureReasonAttribute: {DataType: aws.String("String"), StringValue: aws.String("can not aggregate")},
+		},
+	}
+}
+
+func TestFilterIDs(t *testing.T) {
+	letters := func() []deadLetter {
+		return []deadLetter{{MessageID: "m1"}, {MessageID: "m2"}, {MessageID: "m3"}}
+	}
+
+	tests := []struct {
+		name string
+		ids  string
+		want []string
+	}{
+		{name: "no ids keeps every message", want: []string{"m1", "m2", "m3"}},
+		{name: "one id", ids: "m2", want: []string{"m2"}},
+		{name: "several ids with spaces", ids: "m3, m1", want: []string{"m1", "m3"}},
+		{name: "unknown id", ids: "m9", want: []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := []string{}
+			for _, letter := range filterIDs(letters(), test.ids) {
+				got = append(got, letter.MessageID)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("filterIDs() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     options
+		replayed []string
+		fails    bool
+	}{
+		{name: "selected ids", opts: options{ids: "m1"}, replayed: []string{"m1"}},
+		{name: "shop", opts: options{shopID: 12}, replayed: []string{"m1", "m2"}},
+		{name: "all skips invalid bodies", opts: options{all: true}, replayed: []string{"m1", "m2"}, fails: true},
+		{name: "all forced", opts: options{all: true, force: true}, replayed: []string{"m1", "m2", "m3"}},
+		{name: "dry run sends nothing", opts: options{all: true, force: true, dryRun: true}},
+		{name: "no selection", opts: options{}, fails: true},
+		{name: "edited body needs one message", opts: options{shopID: 12, file: "body.json"}, fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &fakeSQS{messages: []*sqs.Message{
+				message("m1", validBody),
+				message("m2", validBody),
+				message("m3", invalidBody),
+			}}
+			q := &queues{client: client, deadLetterUrl: "dlq", targetQueueUrl: "queue"}
+			test.opts.max, test.opts.queue = 10, "queue"
+
+			err := replay(context.Background(), q, &test.opts)
+			if (err != nil) != test.fails {
+				t.Errorf("replay() error = %v, want failure %v", err, test.fails)
+			}
+
+			var replayed []string
+			for _, handle := range client.deleted {
+				replayed = append(replayed, handle[len("handle-"):])
+			}
+			sort.Strings(replayed)
+			if !reflect.DeepEqual(replayed, test.replayed) {
+				t.Errorf("replayed %v, want %v", replayed, test.replayed)
+			}
+			if len(client.sent) != len(test.replayed) {
+				t.Fatalf("sent %d messages, want %d", len(client.sent), len(test.replayed))
+			}
+			for _, sent := range client.sent {
+				if _, ok := sent.MessageAttributes[funcservice.FailureKindAttribute]; ok {
+					t.Error("replayed message keeps the failure kind")
+				}
+				if _, ok := sent.MessageAttributes["traceparent"]; !ok {
+					t.Error("replayed message lost its attributes")
+				}
+			}
+		})
+	}
+}
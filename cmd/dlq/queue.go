@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/minhlong/go-aws-boilerplate/internal/funcservice"
+	"github.com/pkg/errors"
+	"strconv"
+)
+
+// inspectTimeout hides the received messages from other consumers while the tool works on them, release makes
+// them visible again when it is done.
+const inspectTimeout = 60
+
+type deadLetter struct {
+	MessageID     string
+	ReceiptHandle string
+	Body          string
+	Attributes    map[string]*sqs.MessageAttributeValue
+	ReceiveCount  int
+	ShopID        int64
+}
+
+// Reason is the failure the handler recorded, messages moved by the queue redrive policy ran out of retries.
+func (d deadLetter) Reason() string {
+	if reason := d.Attributes[funcservice.FailureReasonAttribute]; reason != nil && reason.StringValue != nil {
+		return *reason.StringValue
+	}
+
+	return "retries exhausted"
+}
+
+func (d deadLetter) Kind() string {
+	if kind := d.Attributes[funcservice.FailureKindAttribute]; kind != nil && kind.StringValue != nil {
+		return *kind.StringValue
+	}
+
+	return "transient"
+}
+
+type queues struct {
+	client         sqsiface.SQSAPI
+	deadLetterUrl  string
+	targetQueueUrl string
+	received       []string
+}
+
+// newQueues connects to SQS, or to a compatible endpoint such as ElasticMQ or LocalStack when one is given.
+func newQueues(endpoint string, region string, deadLetterUrl string, targetQueueUrl string) *queues {
+	config := aws.Config{}
+	if endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
+	}
+	if region != "" {
+		config.Region = aws.String(region)
+	}
+
+	sharedSession := session.Must(session.NewSessionWithOptions(session.Options{
+		Config:            config,
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+
+	return &queues{client: sqs.New(sharedSession), deadLetterUrl: deadLetterUrl, targetQueueUrl: targetQueueUrl}
+}
+
+// receive reads up to max messages of the dead letter queue, optionally only the ones of a shop.
+func (q *queues) receive(ctx context.Context, max int, shopID int64) ([]deadLetter, error) {
+	seen := map[string]bool{}
+	var letters []deadLetter
+	for len(letters) < max {
+		output, err := q.client.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(q.deadLetterUrl),
+			MaxNumberOfMessages:   aws.Int64(10),
+			VisibilityTimeout:     aws.Int64(inspectTimeout),
+			WaitTimeSeconds:       aws.Int64(1),
+			AttributeNames:        aws.StringSlice([]string{sqs.MessageSystemAttributeNameApproximateReceiveCount}),
+			MessageAttributeNames: aws.StringSlice([]string{"All"}),
+		})
+		if err != nil {
+			return nil, errors.WithMessage(err, "can not receive dead letters")
+		}
+		if len(output.Messages) == 0 {
+			break
+		}
+
+		for _, message := range output.Messages {
+			messageID := aws.StringValue(message.MessageId)
+			if seen[messageID] {
+				continue
+			}
+			seen[messageID] = true
+			q.received = append(q.received, aws.StringValue(message.ReceiptHandle))
+
+			letter := deadLetter{
+				MessageID:     messageID,
+				ReceiptHandle: aws.StringValue(message.ReceiptHandle),
+				Body:          aws.StringValue(message.Body),
+				Attributes:    message.MessageAttributes,
+			}
+			letter.ReceiveCount, _ = strconv.Atoi(aws.StringValue(message.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]))
+
+			var body struct {
+				ShopID int64 `json:"sid"`
+			}
+			_ = json.Unmarshal([]byte(letter.Body), &body)
+			letter.ShopID = body.ShopID
+
+			if shopID != 0 && letter.ShopID != shopID {
+				continue
+			}
+			letters = append(letters, letter)
+		}
+	}
+
+	if len(letters) > max {
+		letters = letters[:max]
+	}
+
+	return letters, nil
+}
+
+// replay sends the body to the main queue with the original attributes, minus the failure ones, and removes the
+// message from the dead letter queue once it is sent.
+func (q *queues) replay(ctx context.Context, letter deadLetter, body string) error {
+	attributes := make(map[string]*sqs.MessageAttributeValue, len(letter.Attributes))
+	for name, attribute := range letter.Attributes {
+		if name == funcservice.FailureKindAttribute || name == funcservice.FailureReasonAttribute {
+			continue
+		}
+		attributes[name] = attribute
+	}
+
+	_, err := q.client.SendMessageWithContext(ctx, &sqs.SendMessageInput{
+		MessageBody:       aws.String(body),
+		QueueUrl:          aws.String(q.targetQueueUrl),
+		MessageAttributes: attributes,
+	})
+	if err != nil {
+		return errors.WithMessage(err, "can not send to the main queue")
+	}
+
+	_, err = q.client.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(q.deadLetterUrl),
+		ReceiptHandle: aws.String(letter.ReceiptHandle),
+	})
+	if err != nil {
+		return errors.WithMessage(err, "replayed but can not delete from the dead letter queue")
+	}
+
+	return nil
+}
+
+// release puts every message received and not replayed back on the dead letter queue right away.
+func (q *queues) release(ctx context.Context) {
+	for _, receiptHandle := range q.received {
+		// Replayed messages are deleted already, their handles fail and are ignored
+		_, _ = q.client.ChangeMessageVisibilityWithContext(ctx, &sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          aws.String(q.deadLetterUrl),
+			ReceiptHandle:     aws.String(receiptHandle),
+			VisibilityTimeout: aws.Int64(0),
+		})
+	}
+	q.received = nil
+}
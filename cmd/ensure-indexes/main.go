@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Creates the shop indexes ahead of traffic, e.g. for newly onboarded shops
+//
+//	DB_URI=mongodb://localhost:27017 DB_NAME=insights go run ./cmd/ensure-indexes -shops 12,34
+func main() {
+	shops := flag.String("shops", "", "comma separated shop ids")
+	layout := flag.String("layout", os.Getenv("STORAGE_LAYOUT"), "storage layout: per_shop or shared")
+	flag.Parse()
+
+	logging.Init()
+
+	if *shops == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *layout == "" {
+		*layout = repository.LayoutPerShop
+	}
+
+	ctx := context.Background()
+	failed := false
+	for _, value := range strings.Split(*shops, ",") {
+		shopID, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid shop id %q\n", value)
+			failed = true
+			continue
+		}
+
+		repo, err := repository.NewMongoDbWithLayout(ctx, shopID, *layout)
+		if err == nil {
+			err = repo.EnsureIndexes(ctx)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "shop %d: %v\n", shopID, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("shop %d: indexes ensured\n", shopID)
+	}
+
+	repository.CloseConnections(ctx)
+
+	if failed {
+		os.Exit(1)
+	}
+}
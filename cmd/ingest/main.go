@@ -0,0 +1,15 @@
+package main
+
+import (
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/minhlong/go-aws-boilerplate/internal/handler"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+)
+
+func main() {
+	// Init JSON logger
+	logging.Init()
+
+	// Ingest ad performance rows from SQS or direct invoke
+	lambda.Start(handler.HandleIngestEvent)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/minhlong/go-aws-boilerplate/internal/funcservice"
+	"github.com/minhlong/go-aws-boilerplate/internal/handler"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/internal/schema"
+	"github.com/minhlong/go-aws-boilerplate/internal/service"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	formatJSON  = "json"
+	formatTable = "table"
+)
+
+// Runs an insight job read-only against a configured Mongo without AWS, printing what would be notified, e.g.
+//
+//	DB_URI=mongodb://localhost:27017 DB_NAME=insights go run ./cmd/insights -shop 12 -preset last_7d -format table
+//
+// The request comes from -file, the same JSON body the queue carries, and flags override its fields. Nothing is
+// written: platform data is not synced, the insight cache and alert rules are skipped and exports are written
+// under OBJECT_STORE_DIR.
+func main() {
+	file := flag.String("file", "", "request JSON file, flags override its fields")
+	shopID := flag.Int64("shop", 0, "shop id")
+	platform := flag.String("platform", "", "ad platform")
+	currency := flag.String("currency", "", "shop currency code")
+	accounts := flag.String("accounts", "", "comma separated ad account ids")
+	since := flag.String("since", "", "first day, YYYY-MM-DD")
+	until := flag.String("until", "", "last day, YYYY-MM-DD")
+	preset := flag.String("preset", "", "date preset instead of -since and -until, e.g. yesterday or last_7d")
+	timezone := flag.String("tz", "UTC", "timezone the preset, or today without a range, is resolved in")
+	jobType := flag.String("job", "", "job type, insights when empty")
+	attribution := flag.String("attribution", "", "comma separated attribution models")
+	reconcile := flag.Bool("reconcile", false, "reconcile with store orders")
+	exportFormat := flag.String("export", "", "render an export file: csv or xlsx")
+	format := flag.String("format", formatTable, "output: table, or json for the notifications as they would be sent")
+	out := flag.String("out", "", "write the output to a file instead of stdout")
+	flag.Parse()
+
+	logging.InitWithOutput(os.Stderr)
+
+	request, err := buildRequest(*file)
+	if err != nil {
+		fail(2, err)
+	}
+	if *shopID != 0 {
+		request.ShopID = *shopID
+	}
+	if *platform != "" {
+		request.Platform = *platform
+	}
+	if *currency != "" {
+		request.ShopCurrency = *currency
+	}
+	if *accounts != "" {
+		request.Accounts = nil
+		for _, id := range strings.Split(*accounts, ",") {
+			request.Accounts = append(request.Accounts, repository.Account{ID: strings.TrimSpace(id)})
+		}
+	}
+	if *jobType != "" {
+		request.JobType = *jobType
+	}
+	if *attribution != "" {
+		request.Attribution = &repository.AttributionOptions{Models: strings.Split(*attribution, ",")}
+	}
+	if *reconcile {
+		request.Reconcile = true
+	}
+	if *exportFormat != "" {
+		request.Export = &repository.Export{Format: *exportFormat}
+	}
+	if err := applyDates(request, *since, *until, *preset, *timezone); err != nil {
+		fail(2, err)
+	}
+
+	if err := schema.Validate(*request); err != nil {
+		fail(2, err)
+	}
+
+	output := io.Writer(os.Stdout)
+	if *out != "" {
+		outFile, err := os.Create(*out)
+		if err != nil {
+			fail(1, err)
+		}
+		defer outFile.Close()
+		output = outFile
+	}
+	switch *format {
+	case formatJSON:
+		funcservice.SetSink(&funcservice.WriterSink{Writer: output})
+	case formatTable:
+		funcservice.SetSink(&tableSink{writer: output, currency: request.ShopCurrency})
+	default:
+		fail(2, fmt.Errorf("unknown format %q", *format))
+	}
+
+	ctx := logging.With(context.Background(), zap.Int64("shopID", request.ShopID), zap.String("jobType", request.JobType))
+	err = handler.PreviewRequest(ctx, request)
+	repository.CloseConnections(context.Background())
+	if err != nil {
+		fail(1, err)
+	}
+}
+
+func buildRequest(file string) (*repository.RequestInput, error) {
+	if file == "" {
+		return &repository.RequestInput{Version: repository.RequestVersion}, nil
+	}
+
+	body, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// Older versions are upgraded, validation runs once the flags are applied
+	return schema.Upgrade(body)
+}
+
+// applyDates sets the range of the request. Without one it runs for the day of the request's start_sync_time,
+// or today, as seen in the timezone.
+func applyDates(request *repository.RequestInput, since string, until string, preset string, timezone string) error {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if request.StartSyncTime.IsZero() {
+		request.StartSyncTime = now
+	}
+
+	if preset != "" {
+		request.Since, request.Until, err = service.ResolveDatePreset(preset, now, loc)
+
+		return err
+	}
+
+	if since != "" || until != "" {
+		if since == "" || until == "" {
+			return fmt.Errorf("-since and -until are given together")
+		}
+		if request.Since, err = time.Parse("2006-01-02", since); err != nil {
+			return err
+		}
+		if request.Until, err = time.Parse("2006-01-02", until); err != nil {
+			return err
+		}
+	}
+	if request.Since.IsZero() && request.Until.IsZero() {
+		// Days are dated at UTC midnight, the clock time would match no row
+		request.Since, request.Until, err = service.ResolveDatePreset(service.PresetToday, request.StartSyncTime, loc)
+	}
+
+	return err
+}
+
+func fail(code int, err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(code)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestApplyDates(t *testing.T) {
+	day := func(value string) time.Time {
+		parsed, _ := time.Parse("2006-01-02", value)
+		return parsed
+	}
+	// 23:30 UTC is already the next day in Tokyo
+	started := time.Date(2024, 3, 10, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		request   repository.RequestInput
+		since     string
+		until     string
+		timezone  string
+		wantSince time.Time
+		wantUntil time.Time
+		wantErr   bool
+	}{
+		{name: "range", since: "2024-01-01", until: "2024-01-07", timezone: "UTC", wantSince: day("2024-01-01"), wantUntil: day("2024-01-07")},
+		{name: "start day", request: repository.RequestInput{StartSyncTime: started}, timezone: "UTC", wantSince: day("2024-03-10"), wantUntil: day("2024-03-10")},
+		{name: "start day in timezone", request: repository.RequestInput{StartSyncTime: started}, timezone: "Asia/Tokyo", wantSince: day("2024-03-11"), wantUntil: day("2024-03-11")},
+		{name: "range of the file", request: repository.RequestInput{Since: day("2024-02-01"), Until: day("2024-02-29")}, timezone: "UTC", wantSince: day("2024-02-01"), wantUntil: day("2024-02-29")},
+		{name: "half a range", since: "2024-01-01", timezone: "UTC", wantErr: true},
+		{name: "bad timezone", timezone: "Mars/Base", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := tt.request
+			err := applyDates(&request, tt.since, tt.until, "", tt.timezone)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyDates() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			since, until := request.DateRange()
+			if !since.Equal(tt.wantSince) || !until.Equal(tt.wantUntil) {
+				t.Errorf("DateRange() = %s..%s, want %s..%s", since, until, tt.wantSince, tt.wantUntil)
+			}
+		})
+	}
+}
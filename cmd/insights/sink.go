@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/minhlong/go-aws-boilerplate/internal/export"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"io"
+)
+
+// tableSink prints insight notifications as a table of every level, other notifications as indented JSON.
+type tableSink struct {
+	writer   io.Writer
+	currency string
+}
+
+func (t *tableSink) Send(ctx context.Context, notification repository.InAppNotification, message []byte) error {
+	fmt.Fprintf(t.writer, "== %s: %s\n", notification.Topic, notification.Message)
+
+	var response repository.InsightResponse
+	switch data := notification.MessageAttributes["data"].(type) {
+	case repository.InsightResponse:
+		response = data
+	case []repository.AccountInsight:
+		// requests older than version 3 get the bare account array
+		response.Accounts = data
+	default:
+		return t.printJSON(data)
+	}
+
+	table, err := export.RenderTable(export.Flatten(response.Accounts, export.LayoutHierarchical), export.NewLocale(t.currency))
+	if err != nil {
+		return err
+	}
+	if _, err := t.writer.Write(table); err != nil {
+		return err
+	}
+
+	// Reconciliation and cache details have no table form
+	if response.Reconciliation != nil || response.Cache != nil {
+		return t.printJSON(repository.InsightResponse{Version: response.Version, Reconciliation: response.Reconciliation, Cache: response.Cache})
+	}
+
+	return nil
+}
+
+func (t *tableSink) printJSON(data interface{}) error {
+	body, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(t.writer, "%s\n", body)
+
+	return err
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"strings"
+	"testing"
+)
+
+func TestTableSink(t *testing.T) {
+	accounts := []repository.AccountInsight{{AccountName: "Main", Metrics: repository.Metrics{Spend: 12.5}}}
+
+	tests := []struct {
+		name     string
+		data     interface{}
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "insights",
+			data:     repository.InsightResponse{Version: repository.InsightResponseVersion, Accounts: accounts},
+			contains: []string{"Level", "Main", "$12.50"},
+			excludes: []string{`"cache"`},
+		},
+		{
+			name:     "insights with cache status",
+			data:     repository.InsightResponse{Version: repository.InsightResponseVersion, Accounts: accounts, Cache: &repository.CacheInfo{Hit: true}},
+			contains: []string{"Main", `"hit": true`},
+			excludes: []string{`"accounts": [`},
+		},
+		{
+			name:     "bare insights of an older request",
+			data:     accounts,
+			contains: []string{"Level", "Main", "$12.50"},
+			excludes: []string{`"v"`},
+		},
+		{
+			name:     "other notification",
+			data:     repository.ExportReference{Key: "exports/12/insights.csv"},
+			contains: []string{`"key": "exports/12/insights.csv"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			sink := &tableSink{writer: &out, currency: "USD"}
+			notification := repository.InAppNotification{Topic: "shop:insights", MessageAttributes: map[string]interface{}{"data": tt.data}}
+			if err := sink.Send(context.Background(), notification, nil); err != nil {
+				t.Fatal(err)
+			}
+			for _, text := range tt.contains {
+				if !strings.Contains(out.String(), text) {
+					t.Errorf("output lacks %q:\n%s", text, out.String())
+				}
+			}
+			for _, text := range tt.excludes {
+				if strings.Contains(out.String(), text) {
+					t.Errorf("output has %q:\n%s", text, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/internal/service"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Moves shops between the per shop and the shared storage layouts, e.g.
+//
+//	DB_URI=mongodb://localhost:27017 DB_NAME=insights go run ./cmd/migrate-layout -shops 12,34 -to shared
+func main() {
+	shops := flag.String("shops", "", "comma separated shop ids to migrate")
+	from := flag.String("from", repository.LayoutPerShop, "current layout: per_shop or shared")
+	to := flag.String("to", repository.LayoutShared, "target layout: per_shop or shared")
+	deleteSource := flag.Bool("delete-source", false, "remove the shop's data from the source layout after a verified copy")
+	flag.Parse()
+
+	logging.Init()
+
+	if *shops == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	failed := false
+	for _, value := range strings.Split(*shops, ",") {
+		shopID, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid shop id %q\n", value)
+			failed = true
+			continue
+		}
+
+		if err := service.MigrateLayout(ctx, shopID, *from, *to, *deleteSource); err != nil {
+			fmt.Fprintf(os.Stderr, "shop %d: %v\n", shopID, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("shop %d: migrated to %s\n", shopID, *to)
+	}
+
+	repository.CloseConnections(ctx)
+
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/minhlong/go-aws-boilerplate/internal/handler"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+)
+
+func main() {
+	// Init JSON logger
+	logging.Init()
+
+	// Archive shop data past its plan's retention
+	lambda.Start(handler.HandleRetentionEvent)
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/minhlong/go-aws-boilerplate/internal/handler"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"github.com/minhlong/go-aws-boilerplate/pkg/tracing"
+)
+
+func main() {
+	// Init JSON logger
+	logging.Init()
+
+	// Init tracing, enqueued jobs carry the scheduler's trace context
+	tracing.Init(context.Background())
+
+	// Enqueue due report schedules
+	lambda.Start(handler.HandleScheduleEvent)
+}
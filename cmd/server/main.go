@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"github.com/minhlong/go-aws-boilerplate/internal/handler"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"github.com/minhlong/go-aws-boilerplate/pkg/tracing"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Serves the API Gateway routes as a plain HTTP server, for development and container deployments, e.g.
+//
+//	DB_URI=mongodb://localhost:27017 DB_NAME=insights go run ./cmd/server -addr :8080 -shop 12
+//	curl 'localhost:8080/get-insight?preset=last_7d'
+//
+// Requests are authorized by the user authorizer function of the deployed API, or with -shop all act as that one
+// shop. The server refuses to start with neither.
+func main() {
+	addr := flag.String("addr", ":"+port(), "listen address")
+	authorizerFunction := flag.String("authorizer", os.Getenv("USER_AUTHORIZER_FUNCTION_ARN"), "name or ARN of the user authorizer function")
+	shopID := flag.Int64("shop", 0, "serve every request as this shop instead of calling the authorizer, for local development")
+	flag.Parse()
+
+	logging.Init()
+
+	var authorize handler.Authorizer
+	switch {
+	case *shopID > 0:
+		authorize = handler.ShopAuthorizer(*shopID)
+	case *authorizerFunction != "":
+		authorize = handler.LambdaAuthorizer(*authorizerFunction)
+	default:
+		zap.L().Error("an authorizer is required, set -authorizer or -shop")
+		os.Exit(2)
+	}
+
+	tracing.Init(context.Background())
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           handler.NewHTTPHandler(authorize),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		// Give requests in flight the API Gateway timeout to finish
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 29*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			zap.L().Warn("server did not shut down cleanly", zap.Error(err))
+		}
+	}()
+
+	zap.L().Info("server listening", zap.String("addr", *addr))
+	err := server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		// ListenAndServe returns as soon as Shutdown starts, the connections stay open until requests finished
+		<-done
+		err = nil
+	}
+	repository.CloseConnections(context.Background())
+	tracing.Shutdown(context.Background())
+	if err != nil {
+		zap.L().Error("server stopped", zap.Error(err))
+		os.Exit(1)
+	}
+}
+
+// port follows the PORT convention of container platforms.
+func port() string {
+	if value := os.Getenv("PORT"); value != "" {
+		return value
+	}
+
+	return "8080"
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/internal/service"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"github.com/minhlong/go-aws-boilerplate/pkg/tracing"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Tails the shop collections and pushes live insight updates, change streams need a replica set, e.g.
+//
+//	DB_URI="mongodb://localhost:27017/?replicaSet=rs0" DB_NAME=insights go run ./cmd/stream-worker
+func main() {
+	opts := service.DefaultStreamOptions()
+	flag.StringVar(&opts.Worker, "worker", opts.Worker, "name under which the resume token is stored")
+	flag.DurationVar(&opts.FlushInterval, "flush", opts.FlushInterval, "how long changes are batched before an update is pushed")
+	flag.DurationVar(&opts.SubscriptionRefresh, "refresh", opts.SubscriptionRefresh, "how often subscribed shops are reloaded")
+	flag.Parse()
+
+	logging.Init()
+	tracing.Init(context.Background())
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	err := service.RunStreamWorker(ctx, opts)
+	repository.CloseConnections(context.Background())
+	tracing.Shutdown(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,36 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+)
+
+func RenderCSV(rows []Row, locale Locale) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.Title
+	}
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for i, c := range columns {
+			record[i] = c.format(row, locale)
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
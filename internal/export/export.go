@@ -0,0 +1,40 @@
+package export
+
+import (
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/pkg/errors"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+var contentTypes = map[string]string{
+	FormatCSV:  "text/csv",
+	FormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// Render builds the export file and returns it with its content type.
+func Render(accounts []repository.AccountInsight, options repository.Export, currency string) ([]byte, string, error) {
+	rows := Flatten(accounts, options.Layout)
+	locale := NewLocale(currency)
+
+	var (
+		body []byte
+		err  error
+	)
+	switch options.Format {
+	case FormatCSV:
+		body, err = RenderCSV(rows, locale)
+	case FormatXLSX:
+		body, err = RenderXLSX(rows, locale)
+	default:
+		return nil, "", errors.Errorf("unknown export format %q", options.Format)
+	}
+	if err != nil {
+		return nil, "", errors.WithMessage(err, "can not render export")
+	}
+
+	return body, contentTypes[options.Format], nil
+}
@@ -0,0 +1,135 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"strings"
+	"testing"
+)
+
+func sampleAccounts() []repository.AccountInsight {
+	return []repository.AccountInsight{
+		{
+			AccountName: "Main",
+			Metrics:     repository.Metrics{Spend: 30},
+			Campaigns: []repository.CampaignInsight{
+				{
+					CampaignName:   "Spring",
+					CampaignStatus: "ACTIVE",
+					Metrics:        repository.Metrics{Spend: 30},
+					AdGroups: []repository.AdGroupInsight{
+						{
+							AdGroupName:   "Shoes",
+							AdGroupStatus: "ACTIVE",
+							Metrics:       repository.Metrics{Spend: 30},
+							Ads: []repository.AdInsight{
+								{AdName: "Red", AdStatus: "ACTIVE", Metrics: repository.Metrics{Spend: 10, Impressions: 1000}},
+								{AdName: "Blue", AdStatus: "PAUSED", Metrics: repository.Metrics{Spend: 20, Impressions: 2500}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	tests := []struct {
+		layout string
+		levels []string
+	}{
+		{layout: LayoutHierarchical, levels: []string{LevelAccount, LevelCampaign, LevelAdGroup, LevelAd, LevelAd}},
+		{layout: "", levels: []string{LevelAccount, LevelCampaign, LevelAdGroup, LevelAd, LevelAd}},
+		{layout: LayoutFlat, levels: []string{LevelAd, LevelAd}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.layout, func(t *testing.T) {
+			rows := Flatten(sampleAccounts(), tt.layout)
+			if len(rows) != len(tt.levels) {
+				t.Fatalf("got %d rows, want %d", len(rows), len(tt.levels))
+			}
+			for i, level := range tt.levels {
+				if rows[i].Level != level {
+					t.Errorf("row %d level = %q, want %q", i, rows[i].Level, level)
+				}
+			}
+			last := rows[len(rows)-1]
+			if last.AccountName != "Main" || last.Campaign != "Spring" || last.AdGroup != "Shoes" || last.Ad != "Blue" {
+				t.Errorf("ad row lost its parents: %+v", last)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      string
+		contentType string
+		wantErr     bool
+	}{
+		{name: "csv", format: FormatCSV, contentType: "text/csv"},
+		{name: "xlsx", format: FormatXLSX, contentType: contentTypes[FormatXLSX]},
+		{name: "unknown", format: "pdf", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, contentType, err := Render(sampleAccounts(), repository.Export{Format: tt.format, Layout: LayoutFlat}, "USD")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if contentType != tt.contentType {
+				t.Errorf("content type = %q, want %q", contentType, tt.contentType)
+			}
+			if len(body) == 0 {
+				t.Error("empty body")
+			}
+		})
+	}
+}
+
+func TestRenderCSV(t *testing.T) {
+	body, err := RenderCSV(Flatten(sampleAccounts(), LayoutFlat), NewLocale("USD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want header and 2 rows", len(records))
+	}
+	if records[0][0] != "Level" || len(records[0]) != len(columns) {
+		t.Errorf("unexpected header %v", records[0])
+	}
+	if records[2][4] != "Blue" || records[2][6] != "$20.00" || records[2][7] != "2,500" {
+		t.Errorf("unexpected row %v", records[2])
+	}
+}
+
+func TestRenderTable(t *testing.T) {
+	body, err := RenderTable(Flatten(sampleAccounts(), LayoutFlat), NewLocale("EUR"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimRight(string(body), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3", len(lines))
+	}
+	if !strings.HasPrefix(lines[0], "Level") || !strings.Contains(lines[2], "20,00 €") {
+		t.Errorf("unexpected table:\n%s", body)
+	}
+}
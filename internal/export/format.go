@@ -0,0 +1,97 @@
+package export
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+type currencyFormat struct {
+	Symbol      string
+	Decimals    int
+	DecimalSep  string
+	GroupSep    string
+	SymbolAfter bool
+}
+
+var currencyFormats = map[string]currencyFormat{
+	"USD": {Symbol: "$", Decimals: 2, DecimalSep: ".", GroupSep: ","},
+	"CAD": {Symbol: "CA$", Decimals: 2, DecimalSep: ".", GroupSep: ","},
+	"AUD": {Symbol: "A$", Decimals: 2, DecimalSep: ".", GroupSep: ","},
+	"SGD": {Symbol: "S$", Decimals: 2, DecimalSep: ".", GroupSep: ","},
+	"GBP": {Symbol: "£", Decimals: 2, DecimalSep: ".", GroupSep: ","},
+	"INR": {Symbol: "₹", Decimals: 2, DecimalSep: ".", GroupSep: ","},
+	"JPY": {Symbol: "¥", Decimals: 0, DecimalSep: ".", GroupSep: ","},
+	"EUR": {Symbol: "€", Decimals: 2, DecimalSep: ",", GroupSep: ".", SymbolAfter: true},
+	"BRL": {Symbol: "R$", Decimals: 2, DecimalSep: ",", GroupSep: "."},
+	"VND": {Symbol: "₫", Decimals: 0, DecimalSep: ",", GroupSep: ".", SymbolAfter: true},
+}
+
+// Locale formats numbers the way a shop's currency expects them to be read.
+type Locale struct {
+	currency currencyFormat
+}
+
+func NewLocale(currency string) Locale {
+	code := strings.ToUpper(currency)
+	format, ok := currencyFormats[code]
+	if !ok {
+		format = currencyFormat{Symbol: code, Decimals: 2, DecimalSep: ".", GroupSep: ",", SymbolAfter: true}
+	}
+
+	return Locale{currency: format}
+}
+
+func (l Locale) Number(value float64, decimals int) string {
+	negative := value < 0
+	text := strconv.FormatFloat(math.Abs(value), 'f', decimals, 64)
+
+	integer, fraction := text, ""
+	if i := strings.IndexByte(text, '.'); i >= 0 {
+		integer, fraction = text[:i], text[i+1:]
+	}
+
+	var b strings.Builder
+	if negative {
+		b.WriteByte('-')
+	}
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteString(l.currency.GroupSep)
+		}
+		b.WriteRune(digit)
+	}
+	if fraction != "" {
+		b.WriteString(l.currency.DecimalSep)
+		b.WriteString(fraction)
+	}
+
+	return b.String()
+}
+
+func (l Locale) Currency(value float64) string {
+	number := l.Number(value, l.currency.Decimals)
+	if l.currency.SymbolAfter {
+		return number + " " + l.currency.Symbol
+	}
+
+	return l.currency.Symbol + number
+}
+
+func (l Locale) Percent(value float64) string {
+	return l.Number(value, 2) + "%"
+}
+
+// xlsxCurrencyFormat is the spreadsheet number format code for the currency; separators are left to the reader's locale.
+func (l Locale) xlsxCurrencyFormat() string {
+	number := "#,##0"
+	if l.currency.Decimals > 0 {
+		number += "." + strings.Repeat("0", l.currency.Decimals)
+	}
+	symbol := `"` + l.currency.Symbol + `"`
+	if l.currency.SymbolAfter {
+		return number + " " + symbol
+	}
+
+	return symbol + number
+}
@@ -0,0 +1,81 @@
+package export
+
+import (
+	"testing"
+)
+
+func TestLocaleNumber(t *testing.T) {
+	tests := []struct {
+		name     string
+		currency string
+		value    float64
+		decimals int
+		want     string
+	}{
+		{name: "zero", currency: "USD", value: 0, decimals: 2, want: "0.00"},
+		{name: "no grouping", currency: "USD", value: 999.5, decimals: 2, want: "999.50"},
+		{name: "grouping", currency: "USD", value: 1234567.891, decimals: 2, want: "1,234,567.89"},
+		{name: "negative", currency: "USD", value: -1234.5, decimals: 1, want: "-1,234.5"},
+		{name: "no decimals", currency: "USD", value: 1234.6, decimals: 0, want: "1,235"},
+		{name: "euro separators", currency: "EUR", value: 1234567.5, decimals: 2, want: "1.234.567,50"},
+		{name: "lower case code", currency: "eur", value: 1000, decimals: 0, want: "1.000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewLocale(tt.currency).Number(tt.value, tt.decimals); got != tt.want {
+				t.Errorf("Number(%v, %d) = %q, want %q", tt.value, tt.decimals, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocaleCurrency(t *testing.T) {
+	tests := []struct {
+		currency string
+		value    float64
+		want     string
+	}{
+		{currency: "USD", value: 1234.5, want: "$1,234.50"},
+		{currency: "JPY", value: 1234.5, want: "¥1,234"},
+		{currency: "EUR", value: 1234.5, want: "1.234,50 €"},
+		{currency: "VND", value: 1500000, want: "1.500.000 ₫"},
+		{currency: "CHF", value: 10, want: "10.00 CHF"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.currency, func(t *testing.T) {
+			if got := NewLocale(tt.currency).Currency(tt.value); got != tt.want {
+				t.Errorf("Currency(%v) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalePercent(t *testing.T) {
+	if got := NewLocale("EUR").Percent(12.5); got != "12,50%" {
+		t.Errorf("Percent(12.5) = %q, want %q", got, "12,50%")
+	}
+	if got := NewLocale("USD").Percent(50); got != "50.00%" {
+		t.Errorf("Percent(50) = %q, want %q", got, "50.00%")
+	}
+}
+
+func TestXLSXCurrencyFormat(t *testing.T) {
+	tests := []struct {
+		currency string
+		want     string
+	}{
+		{currency: "USD", want: `"$"#,##0.00`},
+		{currency: "JPY", want: `"¥"#,##0`},
+		{currency: "EUR", want: `#,##0.00 "€"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.currency, func(t *testing.T) {
+			if got := NewLocale(tt.currency).xlsxCurrencyFormat(); got != tt.want {
+				t.Errorf("xlsxCurrencyFormat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
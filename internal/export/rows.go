@@ -0,0 +1,131 @@
+package export
+
+import (
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+)
+
+const (
+	LayoutHierarchical = "hierarchical"
+	LayoutFlat         = "flat"
+)
+
+const (
+	LevelAccount  = "account"
+	LevelCampaign = "campaign"
+	LevelAdGroup  = "ad_group"
+	LevelAd       = "ad"
+)
+
+type Row struct {
+	Level       string
+	AccountName string
+	Campaign    string
+	AdGroup     string
+	Ad          string
+	Status      string
+	Metrics     repository.Metrics
+}
+
+type columnKind int
+
+const (
+	kindText columnKind = iota
+	kindInteger
+	kindDecimal
+	kindCurrency
+	kindPercent
+)
+
+type column struct {
+	Title string
+	Kind  columnKind
+	Text  func(Row) string
+	Value func(Row) float64
+}
+
+var columns = []column{
+	{Title: "Level", Kind: kindText, Text: func(r Row) string { return r.Level }},
+	{Title: "Account", Kind: kindText, Text: func(r Row) string { return r.AccountName }},
+	{Title: "Campaign", Kind: kindText, Text: func(r Row) string { return r.Campaign }},
+	{Title: "Ad group", Kind: kindText, Text: func(r Row) string { return r.AdGroup }},
+	{Title: "Ad", Kind: kindText, Text: func(r Row) string { return r.Ad }},
+	{Title: "Status", Kind: kindText, Text: func(r Row) string { return r.Status }},
+	{Title: "Spend", Kind: kindCurrency, Value: func(r Row) float64 { return r.Metrics.Spend }},
+	{Title: "Impressions", Kind: kindInteger, Value: func(r Row) float64 { return float64(r.Metrics.Impressions) }},
+	{Title: "Clicks", Kind: kindInteger, Value: func(r Row) float64 { return float64(r.Metrics.Clicks) }},
+	{Title: "CTR", Kind: kindPercent, Value: func(r Row) float64 { return r.Metrics.CTR }},
+	{Title: "Add to cart", Kind: kindInteger, Value: func(r Row) float64 { return r.Metrics.AddToCart }},
+	{Title: "Cost per add to cart", Kind: kindCurrency, Value: func(r Row) float64 { return r.Metrics.CostPerATC }},
+	{Title: "Purchases", Kind: kindInteger, Value: func(r Row) float64 { return r.Metrics.Purchases }},
+	{Title: "Purchases value", Kind: kindCurrency, Value: func(r Row) float64 { return r.Metrics.PurchasesValue }},
+	{Title: "Cost per purchase", Kind: kindCurrency, Value: func(r Row) float64 { return r.Metrics.CostPerPurchase }},
+	{Title: "Conversion rate", Kind: kindPercent, Value: func(r Row) float64 { return r.Metrics.ConversionRate }},
+	{Title: "ROAS", Kind: kindDecimal, Value: func(r Row) float64 { return r.Metrics.ROAS }},
+	{Title: "Assisted purchase", Kind: kindInteger, Value: func(r Row) float64 { return r.Metrics.AssistedPurchase }},
+	{Title: "Direct purchase", Kind: kindInteger, Value: func(r Row) float64 { return r.Metrics.DirectPurchase }},
+}
+
+// format renders the cell of the column for text outputs.
+func (c column) format(row Row, locale Locale) string {
+	switch c.Kind {
+	case kindInteger:
+		return locale.Number(c.Value(row), 0)
+	case kindDecimal:
+		return locale.Number(c.Value(row), 2)
+	case kindCurrency:
+		return locale.Currency(c.Value(row))
+	case kindPercent:
+		return locale.Percent(c.Value(row))
+	default:
+		return c.Text(row)
+	}
+}
+
+// Flatten turns the account tree into report rows. The hierarchical layout keeps a subtotal row for every
+// level, the flat layout keeps only ads with their parents' names repeated.
+func Flatten(accounts []repository.AccountInsight, layout string) []Row {
+	hierarchical := layout != LayoutFlat
+
+	var rows []Row
+	for _, account := range accounts {
+		if hierarchical {
+			rows = append(rows, Row{Level: LevelAccount, AccountName: account.AccountName, Metrics: account.Metrics})
+		}
+		for _, campaign := range account.Campaigns {
+			if hierarchical {
+				rows = append(rows, Row{
+					Level:       LevelCampaign,
+					AccountName: account.AccountName,
+					Campaign:    campaign.CampaignName,
+					Status:      campaign.CampaignStatus,
+					Metrics:     campaign.Metrics,
+				})
+			}
+			for _, adGroup := range campaign.AdGroups {
+				if hierarchical {
+					rows = append(rows, Row{
+						Level:       LevelAdGroup,
+						AccountName: account.AccountName,
+						Campaign:    campaign.CampaignName,
+						AdGroup:     adGroup.AdGroupName,
+						Status:      adGroup.AdGroupStatus,
+						Metrics:     adGroup.Metrics,
+					})
+				}
+				for _, ad := range adGroup.Ads {
+					rows = append(rows, Row{
+						Level:       LevelAd,
+						AccountName: account.AccountName,
+						Campaign:    campaign.CampaignName,
+						AdGroup:     adGroup.AdGroupName,
+						Ad:          ad.AdName,
+						Status:      ad.AdStatus,
+						Metrics:     ad.Metrics,
+					})
+				}
+			}
+		}
+	}
+
+	return rows
+}
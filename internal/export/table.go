@@ -0,0 +1,33 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"text/tabwriter"
+)
+
+// RenderTable lays the rows out as an aligned plain text table, for terminals.
+func RenderTable(rows []Row, locale Locale) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.Title
+	}
+	writer.Write([]byte(strings.Join(header, "\t") + "\t\n"))
+
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for i, c := range columns {
+			record[i] = c.format(row, locale)
+		}
+		writer.Write([]byte(strings.Join(record, "\t") + "\t\n"))
+	}
+
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
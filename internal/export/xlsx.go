@@ -0,0 +1,161 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Cell style indexes into the cellXfs list of xlsxStyles.
+const (
+	styleText = iota
+	styleHeader
+	styleInteger
+	styleDecimal
+	styleCurrency
+	stylePercent
+)
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+</Types>`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Insights" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="2"><numFmt numFmtId="164" formatCode="%s"/><numFmt numFmtId="165" formatCode="0.00&quot;%%&quot;"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="6">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+<xf numFmtId="3" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="4" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+</cellXfs>
+<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>
+</styleSheet>`
+
+// RenderXLSX writes a single-sheet workbook. Numbers stay numeric so merchants can keep working with them;
+// the currency symbol comes from the number format.
+func RenderXLSX(rows []Row, locale Locale) ([]byte, error) {
+	sheet := renderSheet(rows)
+
+	parts := []struct {
+		Name string
+		Body string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", fmt.Sprintf(xlsxStyles, escapeXML(locale.xlsxCurrencyFormat()))},
+		{"xl/worksheets/sheet1.xml", sheet},
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, part := range parts {
+		w, err := archive.Create(part.Name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(part.Body)); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func renderSheet(rows []Row) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	b.WriteString(`<row r="1">`)
+	for i, c := range columns {
+		writeTextCell(&b, cellRef(i, 1), c.Title, styleHeader)
+	}
+	b.WriteString(`</row>`)
+
+	for n, row := range rows {
+		line := n + 2
+		fmt.Fprintf(&b, `<row r="%d">`, line)
+		for i, c := range columns {
+			ref := cellRef(i, line)
+			switch c.Kind {
+			case kindText:
+				writeTextCell(&b, ref, c.Text(row), styleText)
+			case kindInteger:
+				writeNumberCell(&b, ref, c.Value(row), styleInteger)
+			case kindDecimal:
+				writeNumberCell(&b, ref, c.Value(row), styleDecimal)
+			case kindCurrency:
+				writeNumberCell(&b, ref, c.Value(row), styleCurrency)
+			case kindPercent:
+				writeNumberCell(&b, ref, c.Value(row), stylePercent)
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+
+	b.WriteString(`</sheetData></worksheet>`)
+
+	return b.String()
+}
+
+func writeTextCell(b *strings.Builder, ref string, text string, style int) {
+	fmt.Fprintf(b, `<c r="%s" t="inlineStr" s="%d"><is><t>%s</t></is></c>`, ref, style, escapeXML(text))
+}
+
+func writeNumberCell(b *strings.Builder, ref string, value float64, style int) {
+	fmt.Fprintf(b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, style, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// cellRef converts a zero based column index and a one based row number to an A1 reference.
+func cellRef(col int, row int) string {
+	name := ""
+	for col >= 0 {
+		name = string(rune('A'+col%26)) + name
+		col = col/26 - 1
+	}
+
+	return name + strconv.Itoa(row)
+}
+
+func escapeXML(text string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(text))
+
+	return b.String()
+}
@@ -0,0 +1,80 @@
+package funcservice
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/minhlong/go-aws-boilerplate/pkg/failure"
+	"github.com/pkg/errors"
+	"os"
+)
+
+// Attributes the handler adds to a job it moves to the dead letter queue.
+const (
+	FailureKindAttribute   = "failureKind"
+	FailureReasonAttribute = "failureReason"
+)
+
+// SendToDeadLetter moves the messages of a job that failed permanently to INSIGHT_JOB_DLQ_URL, keeping their
+// body and attributes and adding the failure kind and reason.
+func SendToDeadLetter(ctx context.Context, records []events.SQSMessage, kind failure.Kind, reason string) error {
+	deadLetterQueueUrl, ok := os.LookupEnv("INSIGHT_JOB_DLQ_URL")
+	if !ok {
+		return errors.New("INSIGHT_JOB_DLQ_URL is missing")
+	}
+
+	for _, record := range records {
+		attributes := make(map[string]*sqs.MessageAttributeValue, len(record.MessageAttributes)+2)
+		for name, attribute := range record.MessageAttributes {
+			attributes[name] = &sqs.MessageAttributeValue{
+				DataType:    aws.String(attribute.DataType),
+				StringValue: attribute.StringValue,
+				BinaryValue: attribute.BinaryValue,
+			}
+		}
+		attributes[FailureKindAttribute] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(string(kind)),
+		}
+		attributes[FailureReasonAttribute] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(reason),
+		}
+
+		_, err := sqsClient.SendMessageWithContext(ctx, &sqs.SendMessageInput{
+			MessageBody:       aws.String(record.Body),
+			QueueUrl:          aws.String(deadLetterQueueUrl),
+			MessageAttributes: attributes,
+		})
+		if err != nil {
+			return errors.WithMessagef(err, "can not dead letter message %s", record.MessageId)
+		}
+	}
+
+	return nil
+}
+
+// permanentSendCodes are SQS error codes of sends that fail the same way on every retry.
+var permanentSendCodes = map[string]bool{
+	sqs.ErrCodeQueueDoesNotExist:      true,
+	sqs.ErrCodeInvalidMessageContents: true,
+	sqs.ErrCodeUnsupportedOperation:   true,
+	"AccessDenied":                    true,
+	"AccessDeniedException":           true,
+	"InvalidClientTokenId":            true,
+	"InvalidParameterValue":           true,
+	"MissingParameter":                true,
+}
+
+// classifySendError marks a failed SQS send as permanent when its code is known to fail on every retry, e.g. a
+// missing queue or denied access, and as transient otherwise.
+func classifySendError(err error, reason string) error {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && permanentSendCodes[awsErr.Code()] {
+		return failure.Permanent(err, reason)
+	}
+
+	return failure.Transient(err, reason)
+}
@@ -0,0 +1,35 @@
+package funcservice
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/minhlong/go-aws-boilerplate/pkg/failure"
+	"testing"
+)
+
+func TestClassifySendError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want failure.Kind
+	}{
+		{name: "unknown error", err: errors.New("connection reset"), want: failure.KindTransient},
+		{name: "unknown code", err: awserr.New("InternalError", "internal", nil), want: failure.KindTransient},
+		{name: "throttled", err: awserr.New("ThrottlingException", "slow down", nil), want: failure.KindTransient},
+		{name: "cancelled", err: awserr.New(request.CanceledErrorCode, "cancelled", nil), want: failure.KindTransient},
+		{name: "missing queue", err: awserr.New(sqs.ErrCodeQueueDoesNotExist, "no queue", nil), want: failure.KindPermanent},
+		{name: "denied", err: awserr.New("AccessDenied", "denied", nil), want: failure.KindPermanent},
+		{name: "invalid contents", err: awserr.New(sqs.ErrCodeInvalidMessageContents, "bad body", nil), want: failure.KindPermanent},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := classifySendError(test.err, "can not send notification")
+			if got := failure.KindOf(err); got != test.want {
+				t.Errorf("classifySendError() kind = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
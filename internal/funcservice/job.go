@@ -0,0 +1,46 @@
+package funcservice
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	util "github.com/minhlong/go-aws-boilerplate/pkg"
+	"github.com/minhlong/go-aws-boilerplate/pkg/tracing"
+	"github.com/pkg/errors"
+	"strconv"
+)
+
+// SendInsightJob puts a request on the insight-async-job queue, the same queue the insight handler consumes.
+func SendInsightJob(ctx context.Context, request repository.RequestInput) error {
+	insightJobQueueUrl := util.MustGetEnv("INSIGHT_JOB_QUEUE_URL")
+
+	if request.Version == 0 {
+		request.Version = repository.RequestVersion
+	}
+	message, err := json.Marshal(request)
+	if err != nil {
+		return errors.WithMessage(err, "can not encode insight job")
+	}
+
+	// The insight handler continues the trace from these attributes
+	attributes := map[string]*sqs.MessageAttributeValue{
+		"shopId": {
+			DataType:    aws.String("Number"),
+			StringValue: aws.String(strconv.FormatInt(request.ShopID, 10)),
+		},
+	}
+	tracing.InjectSQS(ctx, attributes)
+
+	_, err = sqsClient.SendMessageWithContext(ctx, &sqs.SendMessageInput{
+		MessageBody:       aws.String(string(message)),
+		QueueUrl:          aws.String(insightJobQueueUrl),
+		MessageAttributes: attributes,
+	})
+	if err != nil {
+		return errors.WithMessage(err, "can not send insight job")
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package funcservice
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	util "github.com/minhlong/go-aws-boilerplate/pkg"
+	"github.com/minhlong/go-aws-boilerplate/pkg/tracing"
+	"github.com/pkg/errors"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// Sink delivers notifications. The notifications go to the websocket service queue unless SetSink replaced it,
+// local tools print them instead.
+type Sink interface {
+	Send(ctx context.Context, notification repository.InAppNotification, message []byte) error
+}
+
+var sink Sink = queueSink{}
+
+func SetSink(s Sink) {
+	sink = s
+}
+
+// queueSink sends to WEBSOCKET_NOTIFICATION_QUEUE_URL, the websocket service pushes the message to the shop.
+type queueSink struct{}
+
+func (queueSink) Send(ctx context.Context, notification repository.InAppNotification, message []byte) error {
+	websocketNotificationQueueUrl := util.MustGetEnv("WEBSOCKET_NOTIFICATION_QUEUE_URL")
+
+	attributes := map[string]*sqs.MessageAttributeValue{
+		"shopId": {
+			DataType:    aws.String("Number"),
+			StringValue: aws.String(strconv.FormatInt(notification.ShopId, 10)),
+		},
+	}
+	tracing.InjectSQS(ctx, attributes)
+
+	_, err := sqsClient.SendMessageWithContext(ctx, &sqs.SendMessageInput{
+		MessageGroupId:         aws.String(notification.MessageID),
+		MessageDeduplicationId: aws.String(strconv.FormatInt(notification.Timestamp.UnixNano(), 10)),
+		MessageBody:            aws.String(string(message)),
+		QueueUrl:               aws.String(websocketNotificationQueueUrl),
+		MessageAttributes:      attributes,
+	})
+	if err != nil {
+		return classifySendError(err, "can not send notification")
+	}
+
+	return nil
+}
+
+// WriterSink writes every notification as a JSON line, to stdout or a file.
+type WriterSink struct {
+	mu     sync.Mutex
+	Writer io.Writer
+}
+
+func (w *WriterSink) Send(ctx context.Context, notification repository.InAppNotification, message []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := w.Writer.Write(append(message, '\n')); err != nil {
+		return errors.WithMessage(err, "can not write notification")
+	}
+
+	return nil
+}
@@ -3,12 +3,13 @@ package funcservice
 import (
 	"context"
 	"encoding/json"
-	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/minhlong/go-aws-boilerplate/internal/repository"
-	util "github.com/minhlong/go-aws-boilerplate/pkg"
-	"github.com/pkg/errors"
+	"github.com/minhlong/go-aws-boilerplate/pkg/metrics"
+	"github.com/minhlong/go-aws-boilerplate/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"strconv"
 	"time"
 )
@@ -23,13 +24,11 @@ func init() {
 }
 
 func SendInAppNotification(ctx context.Context, shopID int64, messageBody interface{}, requestID string, msg string) error {
-	websocketNotificationQueueUrl := util.MustGetEnv("WEBSOCKET_NOTIFICATION_QUEUE_URL")
-
 	now := time.Now()
-	messageId := "shop:insights:" + requestID
-	message, _ := json.Marshal(repository.InAppNotification{
+
+	return sendNotification(ctx, repository.InAppNotification{
 		ShopId:    shopID,
-		MessageID: messageId,
+		MessageID: "shop:insights:" + requestID,
 		Type:      "SA",
 		Topic:     "shop:insights",
 		MessageAttributes: map[string]interface{}{
@@ -40,22 +39,132 @@ func SendInAppNotification(ctx context.Context, shopID int64, messageBody interf
 		Message:   msg,
 		Subject:   "Get shop insights",
 	})
+}
+
+// SendReportNotification delivers a scheduled report to its recipients through the notification service.
+func SendReportNotification(ctx context.Context, shopID int64, scheduleID string, recipients []string, reference *repository.ExportReference) error {
+	now := time.Now()
+
+	return sendNotification(ctx, repository.InAppNotification{
+		ShopId:    shopID,
+		MessageID: "shop:reports:" + scheduleID,
+		Type:      "SA",
+		Topic:     "shop:reports",
+		MessageAttributes: map[string]interface{}{
+			"data":       reference,
+			"scheduleID": scheduleID,
+			"recipients": recipients,
+		},
+		Timestamp: now,
+		Message:   "Report is ready",
+		Subject:   "Scheduled shop insights report",
+	})
+}
+
+// SendAnomalyNotification warns the shop about metrics that left their usual range.
+func SendAnomalyNotification(ctx context.Context, shopID int64, anomalies []repository.Anomaly) error {
+	now := time.Now()
+
+	return sendNotification(ctx, repository.InAppNotification{
+		ShopId:    shopID,
+		MessageID: "shop:anomalies:" + strconv.FormatInt(shopID, 10),
+		Type:      "SA",
+		Topic:     "shop:anomalies",
+		MessageAttributes: map[string]interface{}{
+			"data": anomalies,
+		},
+		Timestamp: now,
+		Message:   "Unusual activity detected",
+		Subject:   "Shop metric anomalies",
+	})
+}
+
+// SendPacingNotification warns the shop about budgets that are off track.
+func SendPacingNotification(ctx context.Context, shopID int64, alerts []repository.BudgetPacing) error {
+	now := time.Now()
 
-	_, err := sqsClient.SendMessageWithContext(ctx, &sqs.SendMessageInput{
-		MessageGroupId:         aws.String(messageId),
-		MessageDeduplicationId: aws.String(strconv.FormatInt(now.UnixNano(), 10)),
-		MessageBody:            aws.String(string(message)),
-		QueueUrl:               aws.String(websocketNotificationQueueUrl),
-		MessageAttributes: map[string]*sqs.MessageAttributeValue{
-			"shopId": {
-				DataType:    aws.String("Number"),
-				StringValue: aws.String(strconv.FormatInt(shopID, 10)),
-			},
+	return sendNotification(ctx, repository.InAppNotification{
+		ShopId:    shopID,
+		MessageID: "shop:budgets:" + strconv.FormatInt(shopID, 10),
+		Type:      "SA",
+		Topic:     "shop:budgets",
+		MessageAttributes: map[string]interface{}{
+			"data": alerts,
 		},
+		Timestamp: now,
+		Message:   "Budget pacing alert",
+		Subject:   "Shop budget pacing",
 	})
+}
+
+// SendAlertNotification delivers the rules that fired for the shop.
+func SendAlertNotification(ctx context.Context, shopID int64, firings []repository.RuleFiring) error {
+	now := time.Now()
+
+	return sendNotification(ctx, repository.InAppNotification{
+		ShopId:    shopID,
+		MessageID: "shop:alerts:" + strconv.FormatInt(shopID, 10),
+		Type:      "SA",
+		Topic:     "shop:alerts",
+		MessageAttributes: map[string]interface{}{
+			"data": firings,
+		},
+		Timestamp: now,
+		Message:   "Alert rules triggered",
+		Subject:   "Shop alert rules",
+	})
+}
+
+// SendUtmAuditNotification delivers the UTM audit report to the shop.
+func SendUtmAuditNotification(ctx context.Context, shopID int64, report *repository.UtmAuditReport) error {
+	now := time.Now()
+
+	return sendNotification(ctx, repository.InAppNotification{
+		ShopId:    shopID,
+		MessageID: "shop:utm-audit:" + strconv.FormatInt(shopID, 10),
+		Type:      "SA",
+		Topic:     "shop:utm-audit",
+		MessageAttributes: map[string]interface{}{
+			"data": report,
+		},
+		Timestamp: now,
+		Message:   "Success",
+		Subject:   "UTM parameter audit",
+	})
+}
+
+// SendLiveInsightNotification pushes the latest day totals of changed ads to dashboards subscribed to the shop.
+func SendLiveInsightNotification(ctx context.Context, shopID int64, metrics []repository.DailyMetric) error {
+	now := time.Now()
+
+	return sendNotification(ctx, repository.InAppNotification{
+		ShopId:    shopID,
+		MessageID: "shop:insights:live:" + strconv.FormatInt(shopID, 10),
+		Type:      "SA",
+		Topic:     "shop:insights:live",
+		MessageAttributes: map[string]interface{}{
+			"data": metrics,
+		},
+		Timestamp: now,
+		Message:   "Success",
+		Subject:   "Live shop insights",
+	})
+}
+
+func sendNotification(ctx context.Context, notification repository.InAppNotification) error {
+	ctx, span := tracing.Start(ctx, "notification.send", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(
+		attribute.String("notification.topic", notification.Topic),
+		attribute.Int64("shop.id", notification.ShopId),
+	))
+
+	message, _ := json.Marshal(notification)
+
+	err := sink.Send(ctx, notification, message)
+	metrics.Emit(ctx, "NotificationPayloadSize", float64(len(message)), metrics.Bytes)
 	if err != nil {
-		return errors.WithMessage(err, "can not send notification")
+		metrics.Emit(ctx, "NotificationFailed", 1, metrics.Count)
 	}
+	tracing.End(span, err)
 
-	return nil
+	return err
 }
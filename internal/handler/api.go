@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/internal/schema"
+	"github.com/minhlong/go-aws-boilerplate/internal/service"
+	"github.com/minhlong/go-aws-boilerplate/pkg/failure"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"go.uber.org/zap"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiRoute answers one API Gateway route for the shop the authorizer resolved, with a status code and a JSON body.
+type apiRoute func(ctx context.Context, shopID int64, request events.APIGatewayProxyRequest) (int, interface{})
+
+// apiRoutes are keyed by method and path as declared in serverless.yml, the local server serves the same table.
+var apiRoutes = map[string]apiRoute{
+	http.MethodGet + " /get-insight":  getInsight,
+	http.MethodGet + " /schedules":    listSchedules,
+	http.MethodPost + " /schedules":   saveSchedule,
+	http.MethodDelete + " /schedules": deleteSchedule,
+	http.MethodGet + " /budgets":      listBudgets,
+	http.MethodPost + " /budgets":     saveBudget,
+	http.MethodDelete + " /budgets":   deleteBudget,
+}
+
+// corsAllowedHeaders mirrors the headers of slsconfig/cors.yml.
+var corsAllowedHeaders = []string{
+	"Content-Type",
+	"Authorization",
+	"X-Amz-Date",
+	"X-Api-Key",
+	"X-Amz-Security-Token",
+	"X-Amz-User-Agent",
+	"X-App-ID",
+	"X-App-Version",
+	"X-App-Build-Number",
+}
+
+func corsHeaders() map[string]string {
+	methods := map[string]bool{http.MethodOptions: true}
+	for key := range apiRoutes {
+		method, _, _ := strings.Cut(key, " ")
+		methods[method] = true
+	}
+	allowed := make([]string, 0, len(methods))
+	for method := range methods {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+
+	return map[string]string{
+		"Access-Control-Allow-Origin":  "*",
+		"Access-Control-Allow-Headers": strings.Join(corsAllowedHeaders, ","),
+		"Access-Control-Allow-Methods": strings.Join(allowed, ","),
+		"Content-Type":                 "application/json",
+	}
+}
+
+// HandleAPIRequest answers an API Gateway proxy request, preflight requests included. Routes are only served to
+// requests carrying the shop of the user authorizer.
+func HandleAPIRequest(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	path := request.Resource
+	if path == "" {
+		path = request.Path
+	}
+
+	var (
+		status int
+		body   interface{}
+	)
+	route, ok := apiRoutes[request.HTTPMethod+" "+path]
+	switch {
+	case request.HTTPMethod == http.MethodOptions:
+		status = http.StatusNoContent
+	case !ok:
+		status, body = http.StatusNotFound, apiError("route not found")
+	default:
+		shopID, err := authorizedShop(request)
+		if err != nil {
+			status, body = http.StatusUnauthorized, apiError(err.Error())
+			break
+		}
+		status, body = route(logging.With(ctx, zap.Int64("shopID", shopID)), shopID, request)
+	}
+
+	response := events.APIGatewayProxyResponse{StatusCode: status, Headers: corsHeaders()}
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			logging.L(ctx).Error("can not encode response", zap.Error(err))
+			return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError, Headers: corsHeaders()}, nil
+		}
+		response.Body = string(encoded)
+	}
+
+	return response, nil
+}
+
+// getInsight returns the insights synchronously, the same body the insight notification carries. The request is
+// the JSON RequestInput body, or for a plain GET the query parameters sid, platform, cur, acc, since, until,
+// preset, tz, attribution and reconcile, today in tz without a range. The sid is optional and must be the authorized shop when given.
+func getInsight(ctx context.Context, shopID int64, apiRequest events.APIGatewayProxyRequest) (int, interface{}) {
+	request, err := insightRequest(apiRequest)
+	if err != nil {
+		return http.StatusBadRequest, apiError(failure.ReasonOf(err))
+	}
+	if request.ShopID != 0 && request.ShopID != shopID {
+		return http.StatusForbidden, apiError(errForbidden.Error())
+	}
+	request.ShopID = shopID
+	if err := schema.Validate(*request); err != nil {
+		return http.StatusBadRequest, apiError(failure.ReasonOf(err))
+	}
+	ctx = logging.With(ctx, zap.String("platform", request.Platform))
+
+	repo, err := repository.NewMongoDb(ctx, request.ShopID)
+	if err != nil {
+		logging.L(ctx).Error("can not init mongo connection", zap.Error(err))
+		return errorStatus(err), apiError(failure.ReasonOf(err))
+	}
+
+	response, err := loadInsights(ctx, request, repo, cacheTTL())
+	if err != nil {
+		return errorStatus(err), apiError(failure.ReasonOf(err))
+	}
+
+	return http.StatusOK, response
+}
+
+func insightRequest(apiRequest events.APIGatewayProxyRequest) (*repository.RequestInput, error) {
+	if strings.TrimSpace(apiRequest.Body) != "" {
+		return schema.Upgrade([]byte(apiRequest.Body))
+	}
+
+	query := apiRequest.QueryStringParameters
+	request := &repository.RequestInput{
+		Version:      repository.RequestVersion,
+		Platform:     query["platform"],
+		ShopCurrency: query["cur"],
+		Reconcile:    query["reconcile"] == "true",
+	}
+	if sid := query["sid"]; sid != "" {
+		shopID, err := strconv.ParseInt(sid, 10, 64)
+		if err != nil {
+			return nil, failure.Validationf("sid %q is not a number", sid)
+		}
+		request.ShopID = shopID
+	}
+	if accounts := query["acc"]; accounts != "" {
+		for _, id := range strings.Split(accounts, ",") {
+			request.Accounts = append(request.Accounts, repository.Account{ID: strings.TrimSpace(id)})
+		}
+	}
+	if models := query["attribution"]; models != "" {
+		request.Attribution = &repository.AttributionOptions{Models: strings.Split(models, ",")}
+	}
+
+	now := time.Now()
+	request.StartSyncTime = now
+	loc := time.UTC
+	if tz := query["tz"]; tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return nil, failure.Validationf("tz %q is not an IANA timezone", tz)
+		}
+	}
+	if preset := query["preset"]; preset != "" {
+		since, until, err := service.ResolveDatePreset(preset, now, loc)
+		if err != nil {
+			return nil, failure.Validation(err, "")
+		}
+		request.Since, request.Until = since, until
+
+		return request, nil
+	}
+	for name, target := range map[string]*time.Time{"since": &request.Since, "until": &request.Until} {
+		value := query[name]
+		if value == "" {
+			continue
+		}
+		day, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return nil, failure.Validationf("%s %q is not a YYYY-MM-DD date", name, value)
+		}
+		*target = day
+	}
+	if request.Since.IsZero() && request.Until.IsZero() {
+		// Without a range the shop's current day is returned, days are dated at UTC midnight
+		request.Since, request.Until, _ = service.ResolveDatePreset(service.PresetToday, now, loc)
+	}
+
+	return request, nil
+}
+
+// errorStatus maps the failure kinds to HTTP, a transient failure is worth retrying by the client.
+func errorStatus(err error) int {
+	switch failure.KindOf(err) {
+	case failure.KindValidation:
+		return http.StatusBadRequest
+	case failure.KindTransient:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func apiError(message string) map[string]string {
+	return map[string]string{"error": message}
+}
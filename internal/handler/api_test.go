@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/internal/service"
+	"github.com/minhlong/go-aws-boilerplate/pkg/failure"
+	"testing"
+	"time"
+)
+
+func TestInsightRequestDates(t *testing.T) {
+	now := time.Now()
+	day := func(value string) time.Time {
+		parsed, _ := time.Parse("2006-01-02", value)
+		return parsed
+	}
+	today := func(tz string) time.Time {
+		loc, _ := time.LoadLocation(tz)
+		since, _, _ := service.ResolveDatePreset(service.PresetToday, now, loc)
+		return since
+	}
+
+	tests := []struct {
+		name      string
+		query     map[string]string
+		wantSince time.Time
+		wantUntil time.Time
+		wantErr   bool
+	}{
+		{name: "range", query: map[string]string{"since": "2024-01-01", "until": "2024-01-31"}, wantSince: day("2024-01-01"), wantUntil: day("2024-01-31")},
+		{name: "no range is today", query: map[string]string{}, wantSince: today("UTC"), wantUntil: today("UTC")},
+		{name: "no range in timezone", query: map[string]string{"tz": "Pacific/Kiritimati"}, wantSince: today("Pacific/Kiritimati"), wantUntil: today("Pacific/Kiritimati")},
+		{name: "bad date", query: map[string]string{"since": "01/01/2024"}, wantErr: true},
+		{name: "bad timezone", query: map[string]string{"tz": "Mars/Base"}, wantErr: true},
+		{name: "bad preset", query: map[string]string{"preset": "last_7_days"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, err := insightRequest(events.APIGatewayProxyRequest{QueryStringParameters: tt.query})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("insightRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			since, until := request.DateRange()
+			if !since.Equal(tt.wantSince) || !until.Equal(tt.wantUntil) {
+				t.Errorf("DateRange() = %s..%s, want %s..%s", since, until, tt.wantSince, tt.wantUntil)
+			}
+			if since.Hour() != 0 || since.Minute() != 0 || since.Location() != time.UTC {
+				t.Errorf("since %s is not a UTC midnight", since)
+			}
+		})
+	}
+}
+
+func TestPreviewRequestRefusesWrites(t *testing.T) {
+	for _, jobType := range []string{repository.JobRollup, repository.JobSubscribe} {
+		t.Run(jobType, func(t *testing.T) {
+			err := PreviewRequest(context.Background(), &repository.RequestInput{ShopID: 12, JobType: jobType})
+			if failure.KindOf(err) != failure.KindValidation {
+				t.Errorf("PreviewRequest() error = %v, want a validation failure", err)
+			}
+		})
+	}
+}
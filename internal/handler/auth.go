@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+// authorizerShopKey is the context key the user authorizer (slsconfig/authorizers.yml) stores the shop under.
+const authorizerShopKey = "sid"
+
+var (
+	errUnauthorized = errors.New("unauthorized")
+	errForbidden    = errors.New("forbidden")
+)
+
+// authorizedShop reads the shop the authorizer resolved for the caller. Requests never choose their shop.
+func authorizedShop(request events.APIGatewayProxyRequest) (int64, error) {
+	switch value := request.RequestContext.Authorizer[authorizerShopKey].(type) {
+	case string:
+		shopID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || shopID <= 0 {
+			return 0, errUnauthorized
+		}
+		return shopID, nil
+	case json.Number:
+		shopID, err := value.Int64()
+		if err != nil || shopID <= 0 {
+			return 0, errUnauthorized
+		}
+		return shopID, nil
+	case float64:
+		if value <= 0 || value != float64(int64(value)) {
+			return 0, errUnauthorized
+		}
+		return int64(value), nil
+	default:
+		return 0, errUnauthorized
+	}
+}
+
+// Authorizer resolves the authorizer context of a request served outside API Gateway. It returns errUnauthorized
+// when the caller is not authenticated and errForbidden when the authorizer denies it.
+type Authorizer func(ctx context.Context, request events.APIGatewayProxyRequest) (map[string]interface{}, error)
+
+// LambdaAuthorizer invokes the same authorizer function API Gateway uses, so the local server trusts exactly
+// the callers the deployed API trusts.
+func LambdaAuthorizer(functionName string) Authorizer {
+	client := lambda.New(session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	})))
+
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (map[string]interface{}, error) {
+		if request.Headers["Authorization"] == "" {
+			return nil, errUnauthorized
+		}
+
+		payload, err := json.Marshal(events.APIGatewayCustomAuthorizerRequestTypeRequest{
+			Type:                  "REQUEST",
+			MethodArn:             request.HTTPMethod + " " + request.Path,
+			Resource:              request.Resource,
+			Path:                  request.Path,
+			HTTPMethod:            request.HTTPMethod,
+			Headers:               request.Headers,
+			QueryStringParameters: request.QueryStringParameters,
+		})
+		if err != nil {
+			return nil, errors.WithMessage(err, "can not encode authorizer request")
+		}
+
+		output, err := client.InvokeWithContext(ctx, &lambda.InvokeInput{
+			FunctionName: aws.String(functionName),
+			Payload:      payload,
+		})
+		if err != nil {
+			return nil, errors.WithMessage(err, "can not invoke authorizer")
+		}
+		if output.FunctionError != nil {
+			// API Gateway answers 401 when the authorizer fails with "Unauthorized"
+			return nil, errUnauthorized
+		}
+
+		var response events.APIGatewayCustomAuthorizerResponse
+		decoder := json.NewDecoder(strings.NewReader(string(output.Payload)))
+		decoder.UseNumber()
+		if err := decoder.Decode(&response); err != nil {
+			return nil, errors.WithMessage(err, "can not decode authorizer response")
+		}
+		if !allowed(response.PolicyDocument) {
+			return nil, errForbidden
+		}
+
+		return response.Context, nil
+	}
+}
+
+// allowed follows API Gateway: any explicit Deny wins, otherwise one Allow is needed.
+func allowed(policy events.APIGatewayCustomAuthorizerPolicy) bool {
+	allow := false
+	for _, statement := range policy.Statement {
+		switch {
+		case strings.EqualFold(statement.Effect, "Deny"):
+			return false
+		case strings.EqualFold(statement.Effect, "Allow"):
+			allow = true
+		}
+	}
+
+	return allow
+}
+
+// ShopAuthorizer authorizes every request as one shop, for local development against a single shop's data.
+func ShopAuthorizer(shopID int64) Authorizer {
+	return func(context.Context, events.APIGatewayProxyRequest) (map[string]interface{}, error) {
+		return map[string]interface{}{authorizerShopKey: strconv.FormatInt(shopID, 10)}, nil
+	}
+}
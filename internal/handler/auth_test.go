@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/events"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func authorizedRequest(context map[string]interface{}) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		RequestContext: events.APIGatewayProxyRequestContext{Authorizer: context},
+	}
+}
+
+func TestAuthorizedShop(t *testing.T) {
+	tests := []struct {
+		name    string
+		context map[string]interface{}
+		want    int64
+		wantErr bool
+	}{
+		{name: "string", context: map[string]interface{}{"sid": "12"}, want: 12},
+		{name: "number", context: map[string]interface{}{"sid": float64(12)}, want: 12},
+		{name: "json number", context: map[string]interface{}{"sid": json.Number("9007199254740993")}, want: 9007199254740993},
+		{name: "no context", context: nil, wantErr: true},
+		{name: "other key", context: map[string]interface{}{"principalId": "12"}, wantErr: true},
+		{name: "not a number", context: map[string]interface{}{"sid": "shop"}, wantErr: true},
+		{name: "zero", context: map[string]interface{}{"sid": "0"}, wantErr: true},
+		{name: "fraction", context: map[string]interface{}{"sid": 1.5}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := authorizedShop(authorizedRequest(tt.context))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("authorizedShop() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("authorizedShop() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	statement := func(effect string) events.IAMPolicyStatement {
+		return events.IAMPolicyStatement{Action: []string{"execute-api:Invoke"}, Effect: effect, Resource: []string{"*"}}
+	}
+
+	tests := []struct {
+		name       string
+		statements []events.IAMPolicyStatement
+		want       bool
+	}{
+		{name: "allow", statements: []events.IAMPolicyStatement{statement("Allow")}, want: true},
+		{name: "deny", statements: []events.IAMPolicyStatement{statement("Deny")}},
+		{name: "deny wins", statements: []events.IAMPolicyStatement{statement("Allow"), statement("Deny")}},
+		{name: "empty", statements: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allowed(events.APIGatewayCustomAuthorizerPolicy{Statement: tt.statements}); got != tt.want {
+				t.Errorf("allowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleAPIRequestAuthorization(t *testing.T) {
+	tests := []struct {
+		name    string
+		request events.APIGatewayProxyRequest
+		status  int
+	}{
+		{
+			name:    "preflight needs no authorizer",
+			request: events.APIGatewayProxyRequest{HTTPMethod: http.MethodOptions, Path: "/get-insight"},
+			status:  http.StatusNoContent,
+		},
+		{
+			name:    "no authorizer context",
+			request: events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet, Path: "/get-insight", QueryStringParameters: map[string]string{"sid": "12"}},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name: "sid of another shop",
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:            http.MethodGet,
+				Path:                  "/get-insight",
+				QueryStringParameters: map[string]string{"sid": "13", "reconcile": "true"},
+				RequestContext:        events.APIGatewayProxyRequestContext{Authorizer: map[string]interface{}{"sid": "12"}},
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name: "body for another shop",
+			request: events.APIGatewayProxyRequest{
+				HTTPMethod:     http.MethodGet,
+				Path:           "/get-insight",
+				Body:           `{"v":2,"sid":13,"platform":"pinterest"}`,
+				RequestContext: events.APIGatewayProxyRequestContext{Authorizer: map[string]interface{}{"sid": "12"}},
+			},
+			status: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := HandleAPIRequest(context.Background(), tt.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d (%s)", response.StatusCode, tt.status, response.Body)
+			}
+		})
+	}
+}
+
+func TestHTTPHandlerAuthorizer(t *testing.T) {
+	deny := func(err error) Authorizer {
+		return func(context.Context, events.APIGatewayProxyRequest) (map[string]interface{}, error) {
+			return nil, err
+		}
+	}
+
+	tests := []struct {
+		name      string
+		authorize Authorizer
+		method    string
+		target    string
+		status    int
+	}{
+		{name: "unauthenticated", authorize: deny(errUnauthorized), method: http.MethodGet, target: "/get-insight", status: http.StatusUnauthorized},
+		{name: "denied", authorize: deny(errForbidden), method: http.MethodGet, target: "/get-insight", status: http.StatusForbidden},
+		{name: "preflight", authorize: deny(errUnauthorized), method: http.MethodOptions, target: "/get-insight", status: http.StatusNoContent},
+		{name: "other shop", authorize: ShopAuthorizer(12), method: http.MethodGet, target: "/get-insight?sid=13", status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			NewHTTPHandler(tt.authorize).ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.target, strings.NewReader("")))
+			if recorder.Code != tt.status {
+				t.Errorf("status = %d, want %d (%s)", recorder.Code, tt.status, recorder.Body.String())
+			}
+			if recorder.Header().Get("Access-Control-Allow-Origin") != "*" {
+				t.Error("missing CORS headers")
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/internal/service"
+	"github.com/minhlong/go-aws-boilerplate/pkg/failure"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// listBudgets returns the budgets of the shop, recurring and month specific ones.
+func listBudgets(ctx context.Context, shopID int64, _ events.APIGatewayProxyRequest) (int, interface{}) {
+	repo, errC := repository.NewBudgetRepository(ctx)
+	if errC != nil {
+		logging.L(ctx).Error("can not init mongo connection", zap.Error(errC))
+		return errorStatus(errC), apiError(failure.ReasonOf(errC))
+	}
+
+	budgets, errL := repo.ListByShop(ctx, shopID)
+	if errL != nil {
+		logging.L(ctx).Error("can not list budgets", zap.Error(errL))
+		return errorStatus(errL), apiError(failure.ReasonOf(errL))
+	}
+	if budgets == nil {
+		budgets = []repository.Budget{}
+	}
+
+	return http.StatusOK, budgets
+}
+
+// saveBudget creates the Budget of the JSON body for the shop, or replaces it when the body has an id.
+func saveBudget(ctx context.Context, shopID int64, request events.APIGatewayProxyRequest) (int, interface{}) {
+	var budget repository.Budget
+	if err := json.Unmarshal([]byte(request.Body), &budget); err != nil {
+		return http.StatusBadRequest, apiError("body is not a budget: " + err.Error())
+	}
+	if budget.ShopID != 0 && budget.ShopID != shopID {
+		return http.StatusForbidden, apiError(errForbidden.Error())
+	}
+	budget.ShopID = shopID
+
+	repo, errC := repository.NewBudgetRepository(ctx)
+	if errC != nil {
+		logging.L(ctx).Error("can not init mongo connection", zap.Error(errC))
+		return errorStatus(errC), apiError(failure.ReasonOf(errC))
+	}
+
+	if errS := service.SaveBudget(ctx, repo, &budget); errS != nil {
+		if failure.KindOf(errS) != failure.KindValidation {
+			logging.L(ctx).Error("can not save budget", zap.Error(errS))
+		}
+		return errorStatus(errS), apiError(failure.ReasonOf(errS))
+	}
+
+	return http.StatusOK, budget
+}
+
+// deleteBudget removes the budget of the id query parameter.
+func deleteBudget(ctx context.Context, shopID int64, request events.APIGatewayProxyRequest) (int, interface{}) {
+	id, errI := primitive.ObjectIDFromHex(request.QueryStringParameters["id"])
+	if errI != nil {
+		return http.StatusBadRequest, apiError("id is not a budget id")
+	}
+
+	repo, errC := repository.NewBudgetRepository(ctx)
+	if errC != nil {
+		logging.L(ctx).Error("can not init mongo connection", zap.Error(errC))
+		return errorStatus(errC), apiError(failure.ReasonOf(errC))
+	}
+
+	if errD := repo.Delete(ctx, shopID, id); errD != nil {
+		if errors.Is(errD, repository.ErrBudgetNotFound) {
+			return http.StatusNotFound, apiError(errD.Error())
+		}
+		logging.L(ctx).Error("can not delete budget", zap.Error(errD))
+		return errorStatus(errD), apiError(failure.ReasonOf(errD))
+	}
+
+	return http.StatusNoContent, nil
+}
@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// HandleFunctionEvent serves both triggers of the insight function, API Gateway requests and SQS jobs.
+func HandleFunctionEvent(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var probe struct {
+		HTTPMethod string `json:"httpMethod"`
+	}
+	if err := json.Unmarshal(payload, &probe); err == nil && probe.HTTPMethod != "" {
+		var request events.APIGatewayProxyRequest
+		if err := json.Unmarshal(payload, &request); err != nil {
+			return nil, err
+		}
+
+		return HandleAPIRequest(ctx, request)
+	}
+
+	var event events.SQSEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+
+	return nil, HandleLambdaEvent(ctx, event)
+}
@@ -4,37 +4,374 @@ import (
 	"context"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/minhlong/go-aws-boilerplate/internal/funcservice"
+	"github.com/minhlong/go-aws-boilerplate/internal/platform"
 	"github.com/minhlong/go-aws-boilerplate/internal/repository"
 	"github.com/minhlong/go-aws-boilerplate/internal/service"
+	"github.com/minhlong/go-aws-boilerplate/internal/storage"
+	"github.com/minhlong/go-aws-boilerplate/pkg/failure"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"github.com/minhlong/go-aws-boilerplate/pkg/metrics"
+	"github.com/minhlong/go-aws-boilerplate/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"os"
+	"time"
 )
 
 func HandleLambdaEvent(ctx context.Context, event events.SQSEvent) (errC error) {
+	// Continue the trace of the producer, a job is a single message
+	if len(event.Records) > 0 {
+		ctx = tracing.ExtractSQS(ctx, event.Records[0].MessageAttributes)
+	}
+	ctx, span := tracing.Start(ctx, "handler.HandleLambdaEvent", trace.WithSpanKind(trace.SpanKindConsumer))
+	start := time.Now()
+	defer func() {
+		metrics.Duration(ctx, "JobDuration", start)
+		failed := errC
+		if failed != nil {
+			metrics.Emit(ctx, "JobFailed", 1, metrics.Count)
+			errC = settle(ctx, event, failed)
+		} else {
+			metrics.Emit(ctx, "JobSucceeded", 1, metrics.Count)
+		}
+		tracing.End(span, failed)
+		tracing.Flush(ctx)
+	}()
+
 	// Parse request
+	_, parseSpan := tracing.Start(ctx, "handler.ParseRequest")
 	request, errP := ParseRequest(event)
+	tracing.End(parseSpan, errP)
 	if errP != nil {
+		logging.L(ctx).Error("can not parse request", zap.Error(errP))
 		return errP
 	}
+	span.SetAttributes(
+		attribute.Int64("shop.id", request.ShopID),
+		attribute.String("job.type", request.JobType),
+		attribute.String("platform", request.Platform),
+	)
+	jobType := request.JobType
+	if jobType == "" {
+		jobType = repository.JobInsights
+	}
+	ctx = metrics.WithDimensions(ctx, request.Platform, jobType)
+	ctx = logging.With(ctx,
+		zap.Int64("shopID", request.ShopID),
+		zap.String("jobID", event.Records[0].MessageId),
+		zap.String("jobType", request.JobType),
+		zap.String("platform", request.Platform),
+	)
+
+	return HandleRequest(ctx, request)
+}
+
+// HandleRequest runs a parsed and validated job, the part of the Lambda handler local tools share.
+func HandleRequest(ctx context.Context, request *repository.RequestInput) error {
+	return runRequest(ctx, request, false)
+}
+
+// PreviewRequest runs a job without writing anything but its notifications: platform data is not synced, the
+// insight cache is neither read nor written, alert rules are not evaluated and exports go to a local directory.
+// Jobs that only write are refused.
+func PreviewRequest(ctx context.Context, request *repository.RequestInput) error {
+	switch request.JobType {
+	case repository.JobRollup, repository.JobSubscribe:
+		return failure.Validationf("the %s job writes data and can not be previewed", request.JobType)
+	}
+
+	return runRequest(ctx, request, true)
+}
 
+func runRequest(ctx context.Context, request *repository.RequestInput, readOnly bool) error {
 	// Init mongo connection
 	repo, errC := repository.NewMongoDb(ctx, request.ShopID)
 	if errC != nil {
-		zap.L().Error("can not init mongo connection", zap.Error(errC))
+		logging.L(ctx).Error("can not init mongo connection", zap.Error(errC))
 		return errC
 	}
 
+	switch request.JobType {
+	case repository.JobAnomalies:
+		return handleAnomalies(ctx, request, repo)
+	case repository.JobPacing:
+		return handlePacing(ctx, request, repo)
+	case repository.JobUtmAudit:
+		return handleUtmAudit(ctx, request, repo)
+	case repository.JobRollup:
+		return handleRollup(ctx, request, repo)
+	case repository.JobSubscribe:
+		return handleSubscribe(ctx, request, repo)
+	default:
+		return handleInsights(ctx, request, repo, readOnly)
+	}
+}
+
+// settle decides what becomes of the message of a failed job. Invalid requests are dropped, transient failures
+// are returned so SQS delivers the message again, and permanent failures are moved to the dead letter queue with
+// their reason. A permanent failure stays in the retry path when it can not be dead lettered.
+func settle(ctx context.Context, event events.SQSEvent, err error) error {
+	kind := failure.KindOf(err)
+	switch kind {
+	case failure.KindValidation:
+		metrics.Emit(ctx, "JobDropped", 1, metrics.Count)
+		logging.L(ctx).Warn("invalid request dropped", zap.Error(err))
+		return nil
+	case failure.KindPermanent:
+		if errD := funcservice.SendToDeadLetter(ctx, event.Records, kind, failure.ReasonOf(err)); errD != nil {
+			logging.L(ctx).Error("can not dead letter job", zap.Error(errD))
+			return err
+		}
+		metrics.Emit(ctx, "JobDeadLettered", 1, metrics.Count)
+		logging.L(ctx).Error("job dead lettered", zap.Error(err))
+		return nil
+	default:
+		metrics.Emit(ctx, "JobRetried", 1, metrics.Count)
+		return err
+	}
+}
+
+func handleInsights(ctx context.Context, request *repository.RequestInput, repo *repository.MongodbRepository, readOnly bool) error {
+	// Fill missing or stale days from the ad platform, stored data is still served when that fails
+	if request.AccessToken != "" && !readOnly {
+		syncPlatformData(ctx, request, repo)
+	}
+
 	// Get data
-	result, errD := service.GetInsights(ctx, *request, repo)
+	ttl := cacheTTL()
+	if readOnly {
+		ttl = 0
+	}
+	response, errD := loadInsights(ctx, request, repo, ttl)
 	if errD != nil {
-		zap.L().Error("can not aggregate data", zap.Error(errD))
 		return errD
 	}
+	messageBody := insightBody(request, response)
+
+	// Render export file when requested, the notification then carries the download reference
+	if request.Export != nil {
+		var (
+			store storage.ObjectStore
+			errS  error
+		)
+		if readOnly {
+			store = storage.NewLocalStore(storage.LocalDir())
+		} else {
+			store, errS = storage.NewObjectStore()
+		}
+		if errS != nil {
+			logging.L(ctx).Error("can not init object store", zap.Error(errS))
+			return errS
+		}
+
+		reference, errE := service.ExportInsights(ctx, *request, response.Accounts, store)
+		if errE != nil {
+			logging.L(ctx).Error("can not export data", zap.Error(errE))
+			return errE
+		}
+		messageBody = reference
+
+		if request.ScheduleID != "" {
+			errR := funcservice.SendReportNotification(ctx, request.ShopID, request.ScheduleID, request.Recipients, reference)
+			if errR != nil {
+				logging.L(ctx).Error("can not deliver scheduled report", zap.Error(errR))
+				return errR
+			}
+		}
+	}
 
 	// Trigger notification
-	errW := funcservice.SendInAppNotification(ctx, request.ShopID, result, "insight-request", "Success")
+	errW := funcservice.SendInAppNotification(ctx, request.ShopID, messageBody, "insight-request", "Success")
 	if errW != nil {
+		logging.L(ctx).Error("can not send insight notification", zap.Error(errW))
+		return errW
+	}
+
+	// Rules run last, a failure here is logged only so the job is not retried and the insights sent twice
+	if !readOnly {
+		evaluateRules(ctx, request, repo)
+	}
+
+	return nil
+}
+
+// insightBody is the insight notification body: the InsightResponse envelope for requests of version 3 and
+// later, the bare account array older producers read.
+func insightBody(request *repository.RequestInput, response repository.InsightResponse) interface{} {
+	if request.BareResult {
+		return response.Accounts
+	}
+
+	return response
+}
+
+// loadInsights aggregates the request, through the cache when ttl is set, and reconciles it with the store orders
+// when asked. The result always comes in the InsightResponse envelope, whatever extras are present.
+func loadInsights(ctx context.Context, request *repository.RequestInput, repo *repository.MongodbRepository, ttl time.Duration) (repository.InsightResponse, error) {
+	response := repository.InsightResponse{Version: repository.InsightResponseVersion}
+
+	var errD error
+	if ttl > 0 {
+		response.Accounts, response.Cache, errD = service.GetCachedInsights(ctx, *request, repo, ttl)
+	} else {
+		response.Accounts, errD = service.GetInsights(ctx, *request, repo)
+	}
+	if errD != nil {
+		logging.L(ctx).Error("can not aggregate data", zap.Error(errD))
+		return response, errD
+	}
+	if response.Accounts == nil {
+		response.Accounts = []repository.AccountInsight{}
+	}
+
+	if request.Reconcile {
+		var errR error
+		response.Reconciliation, errR = service.ReconcileOrders(ctx, *request, repo, response.Accounts)
+		if errR != nil {
+			logging.L(ctx).Error("can not reconcile store orders", zap.Error(errR))
+			return response, errR
+		}
+	}
+
+	return response, nil
+}
+
+// cacheTTL reads INSIGHT_CACHE_TTL (e.g. "15m"), caching is off when it is unset or invalid.
+func cacheTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("INSIGHT_CACHE_TTL"))
+	if err != nil {
+		return 0
+	}
+
+	return ttl
+}
+
+func syncPlatformData(ctx context.Context, request *repository.RequestInput, repo *repository.MongodbRepository) {
+	client, errP := platform.NewClient(request.Platform, request.AccessToken)
+	if errP != nil {
+		logging.L(ctx).Warn("can not sync platform data", zap.Error(errP))
+		return
+	}
+
+	if _, errS := service.SyncPlatformData(ctx, *request, repo, client, time.Now().UTC(), service.DefaultSyncOptions); errS != nil {
+		logging.L(ctx).Error("can not sync platform data", zap.Error(errS))
+	}
+}
+
+func evaluateRules(ctx context.Context, request *repository.RequestInput, repo *repository.MongodbRepository) {
+	rules, errC := repository.NewRuleRepository(ctx)
+	if errC != nil {
+		logging.L(ctx).Error("can not init mongo connection", zap.Error(errC))
+		return
+	}
+
+	now := time.Now()
+	firings, errE := service.EvaluateRules(ctx, *request, repo, rules, now)
+	if errE != nil {
+		logging.L(ctx).Error("can not evaluate alert rules", zap.Error(errE))
+		return
+	}
+	if len(firings) == 0 {
+		return
+	}
+
+	if errW := funcservice.SendAlertNotification(ctx, request.ShopID, firings); errW != nil {
+		logging.L(ctx).Error("can not send alert notification", zap.Error(errW))
+		// Without a notification the cooldown would only hide the alert, the next job fires it again
+		if errR := service.ReleaseFirings(ctx, rules, firings, now); errR != nil {
+			logging.L(ctx).Error("can not release alert firings", zap.Error(errR))
+		}
+	}
+}
+
+func handleAnomalies(ctx context.Context, request *repository.RequestInput, repo *repository.MongodbRepository) error {
+	options := service.DefaultAnomalyOptions
+
+	anomalies, errD := service.DetectAnomalies(ctx, *request, repo, options)
+	if errD != nil {
+		logging.L(ctx).Error("can not detect anomalies", zap.Error(errD))
+		return errD
+	}
+
+	if !service.ShouldNotify(anomalies, options) {
+		return nil
+	}
+
+	errW := funcservice.SendAnomalyNotification(ctx, request.ShopID, anomalies)
+	if errW != nil {
+		logging.L(ctx).Error("can not send anomaly notification", zap.Error(errW))
+		return errW
+	}
+
+	return nil
+}
+
+func handlePacing(ctx context.Context, request *repository.RequestInput, repo *repository.MongodbRepository) error {
+	budgets, errC := repository.NewBudgetRepository(ctx)
+	if errC != nil {
+		logging.L(ctx).Error("can not init mongo connection", zap.Error(errC))
+		return errC
+	}
+
+	pacing, errD := service.BudgetPacing(ctx, *request, repo, budgets, service.DefaultPacingOptions)
+	if errD != nil {
+		logging.L(ctx).Error("can not compute budget pacing", zap.Error(errD))
 		return errD
 	}
 
+	alerts := service.PacingAlerts(pacing)
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	errW := funcservice.SendPacingNotification(ctx, request.ShopID, alerts)
+	if errW != nil {
+		logging.L(ctx).Error("can not send pacing notification", zap.Error(errW))
+		return errW
+	}
+
+	return nil
+}
+
+func handleUtmAudit(ctx context.Context, request *repository.RequestInput, repo *repository.MongodbRepository) error {
+	report, errD := service.AuditUTM(ctx, *request, repo)
+	if errD != nil {
+		logging.L(ctx).Error("can not audit utm parameters", zap.Error(errD))
+		return errD
+	}
+
+	errW := funcservice.SendUtmAuditNotification(ctx, request.ShopID, report)
+	if errW != nil {
+		logging.L(ctx).Error("can not send utm audit notification", zap.Error(errW))
+		return errW
+	}
+
+	return nil
+}
+
+func handleRollup(ctx context.Context, request *repository.RequestInput, repo *repository.MongodbRepository) error {
+	errR := service.RefreshRollup(ctx, *request, repo)
+	if errR != nil {
+		logging.L(ctx).Error("can not refresh rollup", zap.Error(errR))
+		return errR
+	}
+
+	return nil
+}
+
+// handleSubscribe registers a dashboard for live updates, 30 minutes unless the request asks otherwise.
+func handleSubscribe(ctx context.Context, request *repository.RequestInput, repo *repository.MongodbRepository) error {
+	duration := 30 * time.Minute
+	if request.SubscribeMinutes > 0 {
+		duration = time.Duration(request.SubscribeMinutes) * time.Minute
+	}
+
+	errS := service.SubscribeLiveInsights(ctx, repo, duration)
+	if errS != nil {
+		logging.L(ctx).Error("can not subscribe to live insights", zap.Error(errS))
+		return errS
+	}
+
 	return nil
 }
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/internal/schema"
+	"testing"
+)
+
+func TestInsightBody(t *testing.T) {
+	accounts := []repository.AccountInsight{{AccountName: "Main", Metrics: repository.Metrics{Spend: 12.5}}}
+	response := repository.InsightResponse{Version: repository.InsightResponseVersion, Accounts: accounts}
+
+	tests := []struct {
+		name     string
+		body     string
+		envelope bool
+	}{
+		{name: "version 1", body: `{"sid": 12, "start_sync_time": "2024-04-01T00:00:00Z"}`},
+		{name: "version 2", body: `{"v": 2, "sid": 12}`},
+		{name: "version 3 opts into the envelope", body: `{"v": 3, "sid": 12}`, envelope: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := schema.Upgrade([]byte(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			switch body := insightBody(request, response).(type) {
+			case repository.InsightResponse:
+				if !test.envelope {
+					t.Errorf("insightBody() = envelope, want the bare account array")
+				}
+			case []repository.AccountInsight:
+				if test.envelope {
+					t.Errorf("insightBody() = bare account array, want the envelope")
+				}
+				if len(body) != 1 || body[0].AccountName != "Main" {
+					t.Errorf("insightBody() = %+v, want the response accounts", body)
+				}
+			default:
+				t.Fatalf("insightBody() = %T", body)
+			}
+		})
+	}
+}
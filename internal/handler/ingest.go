@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/minhlong/go-aws-boilerplate/internal/platform"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/internal/service"
+	"github.com/minhlong/go-aws-boilerplate/pkg/failure"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"github.com/minhlong/go-aws-boilerplate/pkg/metrics"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// HandleIngestEvent accepts either an SQS event whose records each carry a batch, or a batch invoked directly.
+func HandleIngestEvent(ctx context.Context, payload json.RawMessage) ([]repository.IngestResult, error) {
+	batches, errP := ParseIngestEvent(payload)
+	if errP != nil {
+		logging.L(ctx).Error("can not parse ingest event", zap.Error(errP))
+		return nil, errP
+	}
+
+	results := make([]repository.IngestResult, 0, len(batches))
+	for _, batch := range batches {
+		ctx := logging.With(ctx, zap.Int64("shopID", batch.ShopID), zap.String("platform", batch.Platform))
+		ctx = metrics.WithDimensions(ctx, batch.Platform, "ingest")
+
+		repo, errC := repository.NewMongoDb(ctx, batch.ShopID)
+		if errC != nil {
+			logging.L(ctx).Error("can not init mongo connection", zap.Error(errC))
+			return nil, errC
+		}
+
+		result, errI := service.Ingest(ctx, batch, repo)
+		if errI != nil {
+			logging.L(ctx).Error("can not ingest rows", zap.Error(errI))
+			return nil, errI
+		}
+		metrics.Emit(ctx, "RowsIngested", float64(result.Received-len(result.Rejected)), metrics.Count)
+		metrics.Emit(ctx, "RowsRejected", float64(len(result.Rejected)), metrics.Count)
+		if len(result.Rejected) > 0 {
+			logging.L(ctx).Warn("rows rejected", zap.Any("rejected", result.Rejected))
+		}
+		results = append(results, *result)
+	}
+
+	return results, nil
+}
+
+func ParseIngestEvent(payload json.RawMessage) ([]repository.IngestBatch, error) {
+	var event events.SQSEvent
+	if err := json.Unmarshal(payload, &event); err == nil && len(event.Records) > 0 {
+		batches := make([]repository.IngestBatch, 0, len(event.Records))
+		for _, record := range event.Records {
+			batch, err := decodeBatch([]byte(record.Body))
+			if err != nil {
+				return nil, errors.WithMessagef(err, "record %s", record.MessageId)
+			}
+			batches = append(batches, *batch)
+		}
+		return batches, nil
+	}
+
+	batch, err := decodeBatch(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return []repository.IngestBatch{*batch}, nil
+}
+
+func decodeBatch(body []byte) (*repository.IngestBatch, error) {
+	var batch repository.IngestBatch
+
+	// Keep numbers as written so large ids are not rounded through float64
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&batch); err != nil {
+		return nil, failure.Validation(err, "can not decode ingest batch")
+	}
+
+	if batch.ShopID <= 0 {
+		return nil, failure.Validationf("sid is required")
+	}
+	if !platform.Supported(batch.Platform) {
+		return nil, failure.Validationf("platform %s is not supported", batch.Platform)
+	}
+
+	return &batch, nil
+}
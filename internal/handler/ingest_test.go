@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/minhlong/go-aws-boilerplate/pkg/failure"
+	"testing"
+)
+
+func TestParseIngestEvent(t *testing.T) {
+	sqs := func(body string) string {
+		encoded, _ := json.Marshal(body)
+		return `{"Records":[{"messageId":"m1","body":` + string(encoded) + `}]}`
+	}
+
+	tests := []struct {
+		name    string
+		payload string
+		batches int
+		invalid bool
+	}{
+		{name: "direct batch", payload: `{"sid":12,"platform":"pinterest","rows":[{"ad_id":"1"}]}`, batches: 1},
+		{name: "platform defaults to pinterest", payload: `{"sid":12,"rows":[]}`, batches: 1},
+		{name: "sqs batch", payload: sqs(`{"sid":12,"platform":"pinterest","rows":[]}`), batches: 1},
+		{name: "malformed batch", payload: `{"sid":"twelve","rows":[]}`, invalid: true},
+		{name: "malformed sqs body", payload: sqs(`{"sid":12,"rows":`), invalid: true},
+		{name: "missing shop", payload: `{"platform":"pinterest","rows":[]}`, invalid: true},
+		{name: "unsupported platform", payload: `{"sid":12,"platform":"tiktok","rows":[]}`, invalid: true},
+		{name: "unsupported platform in sqs body", payload: sqs(`{"sid":12,"platform":"snapchat","rows":[]}`), invalid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			batches, err := ParseIngestEvent(json.RawMessage(test.payload))
+			if test.invalid {
+				if failure.KindOf(err) != failure.KindValidation {
+					t.Errorf("ParseIngestEvent() error = %v, want a validation failure", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseIngestEvent() error = %v", err)
+			}
+			if len(batches) != test.batches {
+				t.Errorf("ParseIngestEvent() = %d batches, want %d", len(batches), test.batches)
+			}
+		})
+	}
+}
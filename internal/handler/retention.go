@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/internal/service"
+	"github.com/minhlong/go-aws-boilerplate/internal/storage"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"go.uber.org/zap"
+	"os"
+	"time"
+)
+
+// HandleRetentionEvent archives expired raw data of every shop and creates the shop indexes new shops are
+// missing. A failing shop is logged and skipped, the next run picks it up again.
+func HandleRetentionEvent(ctx context.Context, _ events.CloudWatchEvent) error {
+	plans, errC := repository.NewPlanRepository(ctx)
+	if errC != nil {
+		logging.L(ctx).Error("can not init mongo connection", zap.Error(errC))
+		return errC
+	}
+
+	shopPlans, errL := plans.List(ctx)
+	if errL != nil {
+		logging.L(ctx).Error("can not list shop plans", zap.Error(errL))
+		return errL
+	}
+
+	mode := os.Getenv("ARCHIVE_MODE")
+	if mode == "" {
+		mode = repository.ArchiveCollection
+	}
+
+	var store storage.ObjectStore
+	if mode == repository.ArchiveObjectStore {
+		var errS error
+		store, errS = storage.NewObjectStore()
+		if errS != nil {
+			logging.L(ctx).Error("can not init object store", zap.Error(errS))
+			return errS
+		}
+	}
+
+	now := time.Now().UTC()
+	for _, plan := range shopPlans {
+		ctx := logging.With(ctx, zap.Int64("shopID", plan.ShopID))
+
+		repo, errC := repository.NewMongoDb(ctx, plan.ShopID)
+		if errC != nil {
+			logging.L(ctx).Error("can not init mongo connection", zap.Error(errC))
+			return errC
+		}
+
+		// Missing indexes slow queries down but do not break them
+		if errI := repo.EnsureIndexes(ctx); errI != nil {
+			logging.L(ctx).Warn("can not ensure shop indexes", zap.Error(errI))
+		}
+
+		if _, errA := service.ApplyRetention(ctx, plan, repo, plans, store, mode, now); errA != nil {
+			logging.L(ctx).Error("can not apply retention", zap.Error(errA))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/internal/service"
+	"github.com/minhlong/go-aws-boilerplate/pkg/failure"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"github.com/minhlong/go-aws-boilerplate/pkg/tracing"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// HandleScheduleEvent enqueues the insight jobs of the report schedules that are due.
+func HandleScheduleEvent(ctx context.Context, event events.CloudWatchEvent) (errH error) {
+	ctx, span := tracing.Start(ctx, "handler.HandleScheduleEvent")
+	defer func() {
+		tracing.End(span, errH)
+		tracing.Flush(ctx)
+	}()
+
+	repo, errC := repository.NewScheduleRepository(ctx)
+	if errC != nil {
+		logging.L(ctx).Error("can not init mongo connection", zap.Error(errC))
+		return errC
+	}
+
+	now := event.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	enqueued, errR := service.RunDueSchedules(ctx, repo, now.UTC())
+	if errR != nil {
+		logging.L(ctx).Error("can not run due schedules", zap.Error(errR))
+		return errR
+	}
+	logging.L(ctx).Info("scheduled reports enqueued", zap.Int("count", enqueued))
+
+	return nil
+}
+
+// listSchedules returns the report schedules of the shop.
+func listSchedules(ctx context.Context, shopID int64, _ events.APIGatewayProxyRequest) (int, interface{}) {
+	repo, errC := repository.NewScheduleRepository(ctx)
+	if errC != nil {
+		logging.L(ctx).Error("can not init mongo connection", zap.Error(errC))
+		return errorStatus(errC), apiError(failure.ReasonOf(errC))
+	}
+
+	schedules, errL := repo.ListByShop(ctx, shopID)
+	if errL != nil {
+		logging.L(ctx).Error("can not list schedules", zap.Error(errL))
+		return errorStatus(errL), apiError(failure.ReasonOf(errL))
+	}
+	if schedules == nil {
+		schedules = []repository.ReportSchedule{}
+	}
+
+	return http.StatusOK, schedules
+}
+
+// saveSchedule creates the ReportSchedule of the JSON body for the shop, or replaces it when the body has an id.
+func saveSchedule(ctx context.Context, shopID int64, request events.APIGatewayProxyRequest) (int, interface{}) {
+	var schedule repository.ReportSchedule
+	if err := json.Unmarshal([]byte(request.Body), &schedule); err != nil {
+		return http.StatusBadRequest, apiError("body is not a schedule: " + err.Error())
+	}
+	if schedule.ShopID != 0 && schedule.ShopID != shopID {
+		return http.StatusForbidden, apiError(errForbidden.Error())
+	}
+	schedule.ShopID = shopID
+
+	repo, errC := repository.NewScheduleRepository(ctx)
+	if errC != nil {
+		logging.L(ctx).Error("can not init mongo connection", zap.Error(errC))
+		return errorStatus(errC), apiError(failure.ReasonOf(errC))
+	}
+
+	if errS := service.SaveSchedule(ctx, repo, &schedule, time.Now()); errS != nil {
+		if failure.KindOf(errS) != failure.KindValidation {
+			logging.L(ctx).Error("can not save schedule", zap.Error(errS))
+		}
+		return errorStatus(errS), apiError(failure.ReasonOf(errS))
+	}
+
+	return http.StatusOK, schedule
+}
+
+// deleteSchedule removes the schedule of the id query parameter.
+func deleteSchedule(ctx context.Context, shopID int64, request events.APIGatewayProxyRequest) (int, interface{}) {
+	id, errI := primitive.ObjectIDFromHex(request.QueryStringParameters["id"])
+	if errI != nil {
+		return http.StatusBadRequest, apiError("id is not a schedule id")
+	}
+
+	repo, errC := repository.NewScheduleRepository(ctx)
+	if errC != nil {
+		logging.L(ctx).Error("can not init mongo connection", zap.Error(errC))
+		return errorStatus(errC), apiError(failure.ReasonOf(errC))
+	}
+
+	if errD := repo.Delete(ctx, shopID, id); errD != nil {
+		if errors.Is(errD, repository.ErrScheduleNotFound) {
+			return http.StatusNotFound, apiError(errD.Error())
+		}
+		logging.L(ctx).Error("can not delete schedule", zap.Error(errD))
+		return errorStatus(errD), apiError(failure.ReasonOf(errD))
+	}
+
+	return http.StatusNoContent, nil
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/events"
+	"net/http"
+	"testing"
+)
+
+func TestScheduleRoutes(t *testing.T) {
+	authorized := events.APIGatewayProxyRequestContext{Authorizer: map[string]interface{}{"sid": "12"}}
+
+	tests := []struct {
+		name    string
+		request events.APIGatewayProxyRequest
+		status  int
+	}{
+		{
+			name:    "unauthenticated",
+			request: events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet, Path: "/schedules"},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "body is not a schedule",
+			request: events.APIGatewayProxyRequest{HTTPMethod: http.MethodPost, Path: "/schedules", Body: "[]", RequestContext: authorized},
+			status:  http.StatusBadRequest,
+		},
+		{
+			name:    "schedule of another shop",
+			request: events.APIGatewayProxyRequest{HTTPMethod: http.MethodPost, Path: "/schedules", Body: `{"sid":13}`, RequestContext: authorized},
+			status:  http.StatusForbidden,
+		},
+		{
+			name:    "delete without id",
+			request: events.APIGatewayProxyRequest{HTTPMethod: http.MethodDelete, Path: "/schedules", RequestContext: authorized},
+			status:  http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := HandleAPIRequest(context.Background(), tt.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d (%s)", response.StatusCode, tt.status, response.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+)
+
+// maxRequestBody is the API Gateway payload limit.
+const maxRequestBody = 10 << 20
+
+// NewHTTPHandler serves the API Gateway routes over plain net/http, for development and container deployments.
+// Requests are translated to the proxy event API Gateway sends, so both paths share contracts and CORS headers.
+// The authorizer fills the authorizer context API Gateway would, requests it rejects never reach the routes.
+func NewHTTPHandler(authorize Authorizer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody))
+		if err != nil {
+			http.Error(w, "can not read request body", http.StatusBadRequest)
+			return
+		}
+
+		request := events.APIGatewayProxyRequest{
+			Resource:                        r.URL.Path,
+			Path:                            r.URL.Path,
+			HTTPMethod:                      r.Method,
+			Headers:                         map[string]string{},
+			MultiValueHeaders:               map[string][]string(r.Header),
+			QueryStringParameters:           map[string]string{},
+			MultiValueQueryStringParameters: map[string][]string(r.URL.Query()),
+			Body:                            string(body),
+		}
+		for name := range r.Header {
+			request.Headers[name] = r.Header.Get(name)
+		}
+		for name, values := range r.URL.Query() {
+			request.QueryStringParameters[name] = values[0]
+		}
+
+		if r.Method != http.MethodOptions {
+			request.RequestContext.Authorizer, err = authorize(r.Context(), request)
+			switch {
+			case errors.Is(err, errUnauthorized):
+				writeError(w, http.StatusUnauthorized, err)
+				return
+			case errors.Is(err, errForbidden):
+				writeError(w, http.StatusForbidden, err)
+				return
+			case err != nil:
+				logging.L(r.Context()).Error("can not authorize request", zap.Error(err))
+				writeError(w, http.StatusInternalServerError, errors.New("can not authorize request"))
+				return
+			}
+		}
+
+		response, err := HandleAPIRequest(r.Context(), request)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		for name, value := range response.Headers {
+			w.Header().Set(name, value)
+		}
+		for name, values := range response.MultiValueHeaders {
+			for _, value := range values {
+				w.Header().Add(name, value)
+			}
+		}
+		w.WriteHeader(response.StatusCode)
+
+		responseBody := []byte(response.Body)
+		if response.IsBase64Encoded {
+			if responseBody, err = base64.StdEncoding.DecodeString(response.Body); err != nil {
+				return
+			}
+		}
+		w.Write(responseBody)
+	})
+}
+
+// writeError answers like API Gateway does when its authorizer rejects a request.
+func writeError(w http.ResponseWriter, status int, err error) {
+	for name, value := range corsHeaders() {
+		w.Header().Set(name, value)
+	}
+	w.WriteHeader(status)
+	body, _ := json.Marshal(apiError(err.Error()))
+	w.Write(body)
+}
@@ -0,0 +1,107 @@
+package platform
+
+import (
+	"context"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/pkg/errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const Pinterest = "pinterest"
+
+// Client pulls per day ad performance from an ad platform, shaped as the rows stored in the shop collection.
+type Client interface {
+	DailyRows(ctx context.Context, accountID string, since time.Time, until time.Time) ([]repository.AdRow, error)
+	// RowFields are the bson fields of the rows DailyRows fills, stored rows keep their other fields.
+	RowFields() []string
+}
+
+// NewClient returns the client for the platform, authenticated with the shop's access token.
+func NewClient(platform string, accessToken string) (Client, error) {
+	switch platform {
+	case "", Pinterest:
+		return NewPinterestClient(accessToken), nil
+	default:
+		return nil, errors.Errorf("platform %q is not supported", platform)
+	}
+}
+
+// Supported tells whether requests for the platform can be served, an empty platform is Pinterest.
+func Supported(platform string) bool {
+	switch platform {
+	case "", Pinterest:
+		return true
+	default:
+		return false
+	}
+}
+
+// Retry tuning for rate limited and failing calls. Waits stay well below the 29 second API Gateway and insight
+// function timeout, a longer Retry-After fails the call instead.
+var (
+	maxRetries    = 5
+	baseBackoff   = 500 * time.Millisecond
+	maxBackoff    = 8 * time.Second
+	maxRetryAfter = 10 * time.Second
+)
+
+// doWithRetry sends the request built by newRequest, retrying on 429 and 5xx responses. A Retry-After header
+// is honored up to maxRetryAfter, otherwise the wait doubles each attempt with jitter. The last response is
+// returned when the wait would exceed maxRetryAfter or the context deadline.
+func doWithRetry(ctx context.Context, httpClient *http.Client, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		request, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		response, err := httpClient.Do(request.WithContext(ctx))
+		retryable := err != nil || response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500
+		if !retryable {
+			return response, nil
+		}
+		if attempt >= maxRetries {
+			if err != nil {
+				return nil, errors.WithMessage(err, "platform request failed")
+			}
+			return response, nil
+		}
+
+		wait := backoff(attempt)
+		if err == nil {
+			if seconds, errA := strconv.Atoi(response.Header.Get("Retry-After")); errA == nil {
+				wait = time.Duration(seconds) * time.Second
+			}
+			if wait > maxRetryAfter {
+				return response, nil
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			if err != nil {
+				return nil, errors.WithMessage(err, "platform request failed")
+			}
+			return response, nil
+		}
+		if err == nil {
+			response.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func backoff(attempt int) time.Duration {
+	wait := baseBackoff << attempt
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
@@ -0,0 +1,230 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	pinterestDefaultURL = "https://api.pinterest.com/v5"
+	pinterestPageSize   = 100
+	// pinterestMaxAdIDs is the most ad ids the analytics endpoint takes in one call
+	pinterestMaxAdIDs = 100
+	microDollar       = 1e6
+)
+
+var pinterestColumns = []string{
+	"SPEND_IN_MICRO_DOLLAR",
+	"IMPRESSION_1",
+	"CLICKTHROUGH_1",
+	"TOTAL_CHECKOUT",
+	"TOTAL_CHECKOUT_VALUE_IN_MICRO_DOLLAR",
+	"TOTAL_ADD_TO_CART",
+}
+
+type PinterestClient struct {
+	BaseURL     string
+	AccessToken string
+	HTTPClient  *http.Client
+}
+
+// NewPinterestClient talks to PINTEREST_API_URL when set, which lets a local stub stand in for the API.
+func NewPinterestClient(accessToken string) *PinterestClient {
+	baseURL, ok := os.LookupEnv("PINTEREST_API_URL")
+	if !ok {
+		baseURL = pinterestDefaultURL
+	}
+
+	return &PinterestClient{
+		BaseURL:     strings.TrimRight(baseURL, "/"),
+		AccessToken: accessToken,
+		HTTPClient:  &http.Client{Timeout: 20 * time.Second},
+	}
+}
+
+type pinterestEntity struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Status         string `json:"status"`
+	CampaignID     string `json:"campaign_id"`
+	AdGroupID      string `json:"ad_group_id"`
+	DestinationURL string `json:"destination_url"`
+}
+
+type pinterestPage struct {
+	Items    []pinterestEntity `json:"items"`
+	Bookmark *string           `json:"bookmark"`
+}
+
+type pinterestAccount struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func (p *PinterestClient) DailyRows(ctx context.Context, accountID string, since time.Time, until time.Time) ([]repository.AdRow, error) {
+	var account pinterestAccount
+	if err := p.get(ctx, "/ad_accounts/"+url.PathEscape(accountID), nil, &account); err != nil {
+		return nil, errors.WithMessage(err, "can not load ad account")
+	}
+
+	campaigns, err := p.list(ctx, accountID, "campaigns")
+	if err != nil {
+		return nil, err
+	}
+	adGroups, err := p.list(ctx, accountID, "ad_groups")
+	if err != nil {
+		return nil, err
+	}
+	ads, err := p.list(ctx, accountID, "ads")
+	if err != nil {
+		return nil, err
+	}
+
+	adsByID := map[string]pinterestEntity{}
+	adIDs := make([]string, 0, len(ads))
+	for _, ad := range ads {
+		adsByID[ad.ID] = ad
+		adIDs = append(adIDs, ad.ID)
+	}
+
+	var rows []repository.AdRow
+	for start := 0; start < len(adIDs); start += pinterestMaxAdIDs {
+		end := start + pinterestMaxAdIDs
+		if end > len(adIDs) {
+			end = len(adIDs)
+		}
+
+		query := url.Values{
+			"start_date":  {since.Format("2006-01-02")},
+			"end_date":    {until.Format("2006-01-02")},
+			"ad_ids":      {strings.Join(adIDs[start:end], ",")},
+			"columns":     {strings.Join(pinterestColumns, ",")},
+			"granularity": {"DAY"},
+		}
+		var analytics []map[string]interface{}
+		if err := p.get(ctx, "/ad_accounts/"+url.PathEscape(accountID)+"/ads/analytics", query, &analytics); err != nil {
+			return nil, errors.WithMessage(err, "can not load ads analytics")
+		}
+
+		for _, metrics := range analytics {
+			ad := adsByID[fmt.Sprint(metrics["AD_ID"])]
+			date, err := time.Parse("2006-01-02", fmt.Sprint(metrics["DATE"]))
+			if err != nil {
+				return nil, errors.WithMessage(err, "invalid analytics date")
+			}
+
+			campaign := campaigns[ad.CampaignID]
+			adGroup := adGroups[ad.AdGroupID]
+			rows = append(rows, repository.AdRow{
+				Date:           date,
+				AdID:           ad.ID,
+				AdName:         ad.Name,
+				AdStatus:       statusOrInactive(ad.Status),
+				AdSetID:        ad.AdGroupID,
+				AdSetName:      adGroup.Name,
+				AdSetStatus:    statusOrInactive(adGroup.Status),
+				CampaignID:     ad.CampaignID,
+				CampaignName:   campaign.Name,
+				CampaignStatus: statusOrInactive(campaign.Status),
+				AdAccountID:    accountID,
+				AdAccountName:  account.Name,
+				Platform:       Pinterest,
+				DestinationURL: ad.DestinationURL,
+				Spend:          metricFloat(metrics, "SPEND_IN_MICRO_DOLLAR") / microDollar,
+				Impressions:    int64(metricFloat(metrics, "IMPRESSION_1")),
+				Clicks:         int64(metricFloat(metrics, "CLICKTHROUGH_1")),
+				Purchases:      metricFloat(metrics, "TOTAL_CHECKOUT"),
+				PurchasesValue: metricFloat(metrics, "TOTAL_CHECKOUT_VALUE_IN_MICRO_DOLLAR") / microDollar,
+				AddToCart:      metricFloat(metrics, "TOTAL_ADD_TO_CART"),
+			})
+		}
+	}
+
+	return rows, nil
+}
+
+// RowFields leaves out the assisted and direct purchases and valid_parameters, Pinterest does not report them.
+func (p *PinterestClient) RowFields() []string {
+	return []string{
+		"ad_name", "ad_status", "adset_id", "adset_name", "adset_status", "campaign_id", "campaign_name",
+		"campaign_status", "ad_account_id", "ad_account_name", "platform", "destination_url", "spend",
+		"impressions", "clicks", "purchases", "purchases_value", "add_to_cart",
+	}
+}
+
+// list reads every page of an account's campaigns, ad_groups or ads, keyed by id.
+func (p *PinterestClient) list(ctx context.Context, accountID string, kind string) (map[string]pinterestEntity, error) {
+	entities := map[string]pinterestEntity{}
+
+	bookmark := ""
+	for {
+		query := url.Values{"page_size": {fmt.Sprint(pinterestPageSize)}}
+		if bookmark != "" {
+			query.Set("bookmark", bookmark)
+		}
+
+		var page pinterestPage
+		if err := p.get(ctx, "/ad_accounts/"+url.PathEscape(accountID)+"/"+kind, query, &page); err != nil {
+			return nil, errors.WithMessagef(err, "can not list %s", kind)
+		}
+		for _, item := range page.Items {
+			entities[item.ID] = item
+		}
+
+		if page.Bookmark == nil || *page.Bookmark == "" {
+			return entities, nil
+		}
+		bookmark = *page.Bookmark
+	}
+}
+
+func (p *PinterestClient) get(ctx context.Context, path string, query url.Values, target interface{}) error {
+	endpoint := p.BaseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	response, err := doWithRetry(ctx, p.HTTPClient, func() (*http.Request, error) {
+		request, err := http.NewRequest(http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Authorization", "Bearer "+p.AccessToken)
+		request.Header.Set("Accept", "application/json")
+		return request, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return errors.Errorf("pinterest responded %d: %s", response.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return json.NewDecoder(response.Body).Decode(target)
+}
+
+func metricFloat(metrics map[string]interface{}, name string) float64 {
+	value, _ := metrics[name].(float64)
+
+	return value
+}
+
+func statusOrInactive(status string) string {
+	if status == "" {
+		return "INACTIVE"
+	}
+
+	return strings.ToUpper(status)
+}
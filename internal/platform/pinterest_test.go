@@ -0,0 +1,252 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func fastRetries(t *testing.T) {
+	previousBase, previousMax := baseBackoff, maxBackoff
+	baseBackoff, maxBackoff = time.Millisecond, 2*time.Millisecond
+	t.Cleanup(func() {
+		baseBackoff, maxBackoff = previousBase, previousMax
+	})
+}
+
+func writeJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func TestPinterestDailyRows(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		bookmark := r.URL.Query().Get("bookmark")
+		switch r.URL.Path {
+		case "/ad_accounts/a1":
+			writeJSON(w, map[string]string{"id": "a1", "name": "Shop"})
+		case "/ad_accounts/a1/campaigns":
+			writeJSON(w, map[string]interface{}{"items": []map[string]string{{"id": "c1", "name": "Spring", "status": "active"}}})
+		case "/ad_accounts/a1/ad_groups":
+			writeJSON(w, map[string]interface{}{"items": []map[string]string{{"id": "g1", "name": "Group"}}})
+		case "/ad_accounts/a1/ads":
+			// Two pages, the second one ends the listing with an empty bookmark
+			if bookmark == "" {
+				writeJSON(w, map[string]interface{}{
+					"items":    []map[string]string{{"id": "ad1", "name": "First", "campaign_id": "c1", "ad_group_id": "g1", "status": "ACTIVE"}},
+					"bookmark": "next",
+				})
+				return
+			}
+			if bookmark != "next" {
+				t.Errorf("bookmark = %q, want next", bookmark)
+			}
+			writeJSON(w, map[string]interface{}{
+				"items":    []map[string]string{{"id": "ad2", "name": "Second", "campaign_id": "c1", "ad_group_id": "g1"}},
+				"bookmark": "",
+			})
+		case "/ad_accounts/a1/ads/analytics":
+			query := r.URL.Query()
+			if query.Get("ad_ids") != "ad1,ad2" && query.Get("ad_ids") != "ad2,ad1" {
+				t.Errorf("ad_ids = %q, want both ads", query.Get("ad_ids"))
+			}
+			if query.Get("start_date") != "2024-04-01" || query.Get("end_date") != "2024-04-02" {
+				t.Errorf("dates = %s..%s, want 2024-04-01..2024-04-02", query.Get("start_date"), query.Get("end_date"))
+			}
+			writeJSON(w, []map[string]interface{}{
+				{"AD_ID": "ad1", "DATE": "2024-04-01", "SPEND_IN_MICRO_DOLLAR": 12500000, "IMPRESSION_1": 1000, "CLICKTHROUGH_1": 20, "TOTAL_CHECKOUT": 2, "TOTAL_CHECKOUT_VALUE_IN_MICRO_DOLLAR": 50000000},
+				{"AD_ID": "ad2", "DATE": "2024-04-02", "SPEND_IN_MICRO_DOLLAR": 1000000},
+			})
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := &PinterestClient{BaseURL: server.URL, AccessToken: "token", HTTPClient: server.Client()}
+	rows, err := client.DailyRows(context.Background(), "a1", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("DailyRows() error = %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("DailyRows() returned %d rows, want 2", len(rows))
+	}
+	if got := atomic.LoadInt32(&requests); got != 6 {
+		t.Errorf("sent %d requests, want 6", got)
+	}
+
+	first := rows[0]
+	if first.AdID != "ad1" || first.CampaignName != "Spring" || first.CampaignStatus != "ACTIVE" || first.AdSetName != "Group" {
+		t.Errorf("first row = %+v, want ad1 of campaign Spring and ad group Group", first)
+	}
+	if first.AdSetStatus != "INACTIVE" || first.AdAccountName != "Shop" || first.Platform != Pinterest {
+		t.Errorf("first row = %+v, want an inactive ad group of account Shop", first)
+	}
+	if first.Spend != 12.5 || first.Impressions != 1000 || first.Clicks != 20 || first.Purchases != 2 || first.PurchasesValue != 50 {
+		t.Errorf("first row metrics = %+v", first)
+	}
+	if !first.Date.Equal(time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("first row date = %s, want 2024-04-01", first.Date)
+	}
+	if rows[1].AdID != "ad2" || rows[1].AdStatus != "INACTIVE" || rows[1].Spend != 1 {
+		t.Errorf("second row = %+v, want inactive ad2 with 1 spent", rows[1])
+	}
+}
+
+func TestDoWithRetry(t *testing.T) {
+	fastRetries(t)
+
+	tests := []struct {
+		name      string
+		responses []func(w http.ResponseWriter)
+		status    int
+		attempts  int32
+		minWait   time.Duration
+	}{
+		{
+			name: "success",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusOK) },
+			},
+			status:   http.StatusOK,
+			attempts: 1,
+		},
+		{
+			name: "429 waits for Retry-After",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) {
+					w.Header().Set("Retry-After", "1")
+					w.WriteHeader(http.StatusTooManyRequests)
+				},
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusOK) },
+			},
+			status:   http.StatusOK,
+			attempts: 2,
+			minWait:  time.Second,
+		},
+		{
+			name: "Retry-After above the cap is not waited for",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) {
+					w.Header().Set("Retry-After", "60")
+					w.WriteHeader(http.StatusTooManyRequests)
+				},
+			},
+			status:   http.StatusTooManyRequests,
+			attempts: 1,
+		},
+		{
+			name: "5xx is retried",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusBadGateway) },
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusServiceUnavailable) },
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusOK) },
+			},
+			status:   http.StatusOK,
+			attempts: 3,
+		},
+		{
+			name: "5xx gives up after maxRetries",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusInternalServerError) },
+			},
+			status:   http.StatusInternalServerError,
+			attempts: int32(maxRetries) + 1,
+		},
+		{
+			name: "4xx is not retried",
+			responses: []func(w http.ResponseWriter){
+				func(w http.ResponseWriter) { w.WriteHeader(http.StatusBadRequest) },
+			},
+			status:   http.StatusBadRequest,
+			attempts: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				i := int(atomic.AddInt32(&attempts, 1)) - 1
+				if i >= len(test.responses) {
+					i = len(test.responses) - 1
+				}
+				test.responses[i](w)
+			}))
+			defer server.Close()
+
+			started := time.Now()
+			response, err := doWithRetry(context.Background(), server.Client(), func() (*http.Request, error) {
+				return http.NewRequest(http.MethodGet, server.URL, nil)
+			})
+			if err != nil {
+				t.Fatalf("doWithRetry() error = %v", err)
+			}
+			response.Body.Close()
+
+			if response.StatusCode != test.status {
+				t.Errorf("status = %d, want %d", response.StatusCode, test.status)
+			}
+			if got := atomic.LoadInt32(&attempts); got != test.attempts {
+				t.Errorf("attempts = %d, want %d", got, test.attempts)
+			}
+			if elapsed := time.Since(started); elapsed < test.minWait {
+				t.Errorf("returned after %s, want at least %s", elapsed, test.minWait)
+			}
+		})
+	}
+}
+
+func TestDoWithRetryStopsAtDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	started := time.Now()
+	response, err := doWithRetry(ctx, server.Client(), func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, server.URL, nil)
+	})
+	if err != nil {
+		t.Fatalf("doWithRetry() error = %v", err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", response.StatusCode, http.StatusTooManyRequests)
+	}
+	if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+		t.Errorf("waited %s past a Retry-After beyond the deadline", elapsed)
+	}
+}
+
+func TestPinterestGetReportsErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"message": "no access"}`))
+	}))
+	defer server.Close()
+
+	client := &PinterestClient{BaseURL: server.URL, HTTPClient: server.Client()}
+	_, err := client.DailyRows(context.Background(), "a1", time.Now(), time.Now())
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("DailyRows() error = %v, want the 403 response", err)
+	}
+}
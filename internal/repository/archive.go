@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const (
+	planCollection = "shop_plans"
+
+	ArchiveCollection  = "collection"
+	ArchiveObjectStore = "object_store"
+)
+
+type PlanRepository struct {
+	Collection *mongo.Collection
+}
+
+func NewPlanRepository(ctx context.Context) (*PlanRepository, error) {
+	database, err := getDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PlanRepository{
+		Collection: database.Collection(planCollection),
+	}, nil
+}
+
+func (p *PlanRepository) List(ctx context.Context) ([]ShopPlan, error) {
+	var plans []ShopPlan
+	err := withRetry(ctx, func() error {
+		cursor, errF := p.Collection.Find(ctx, bson.M{})
+		if errF != nil {
+			return errF
+		}
+
+		return cursor.All(ctx, &plans)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return plans, nil
+}
+
+// SetArchivedBefore records that the shop's raw data before the given day now lives in its archives.
+func (p *PlanRepository) SetArchivedBefore(ctx context.Context, shopID int64, mode string, before time.Time) error {
+	return withRetry(ctx, func() error {
+		_, errW := p.Collection.UpdateOne(ctx, bson.M{"shop_id": shopID}, bson.M{
+			"$set": bson.M{
+				"archive_mode":    mode,
+				"archived_before": before,
+			},
+		})
+		return errW
+	})
+}
+
+func monthArchiveName(shopID int64, month time.Time) string {
+	return fmt.Sprintf("archive_%d_%s", shopID, month.Format("200601"))
+}
+
+func monthMatch(month time.Time) bson.M {
+	return bson.M{
+		"date": bson.M{
+			"$gte": month,
+			"$lt":  month.AddDate(0, 1, 0),
+		},
+	}
+}
+
+// OldestDate returns the date of the oldest raw document, zero when the collection is empty.
+func (m *MongodbRepository) OldestDate(ctx context.Context) (time.Time, error) {
+	return m.boundaryDate(ctx, 1)
+}
+
+// NewestDate returns the date of the newest raw document, zero when the collection is empty.
+func (m *MongodbRepository) NewestDate(ctx context.Context) (time.Time, error) {
+	return m.boundaryDate(ctx, -1)
+}
+
+func (m *MongodbRepository) boundaryDate(ctx context.Context, order int) (time.Time, error) {
+	var boundary struct {
+		Date time.Time `bson:"date"`
+	}
+	err := m.CollectionName.FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.M{"date": order})).Decode(&boundary)
+	if err == mongo.ErrNoDocuments {
+		return time.Time{}, nil
+	}
+
+	return boundary.Date, err
+}
+
+// ArchiveMonthToCollection copies a month of raw documents into its archive collection.
+// Copies merge on _id so an interrupted run can be repeated.
+func (m *MongodbRepository) ArchiveMonthToCollection(ctx context.Context, month time.Time) error {
+	pipeLine := []bson.M{
+		{"$match": monthMatch(month)},
+		{
+			"$merge": bson.M{
+				"into":           monthArchiveName(m.ShopID, month),
+				"on":             "_id",
+				"whenMatched":    "replace",
+				"whenNotMatched": "insert",
+			},
+		},
+	}
+
+	return m.aggregate(ctx, m.CollectionName, pipeLine, nil)
+}
+
+// RawMonth returns a month of raw documents as stored.
+func (m *MongodbRepository) RawMonth(ctx context.Context, month time.Time) ([]bson.Raw, error) {
+	cursor, err := m.CollectionName.Find(ctx, monthMatch(month))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var documents []bson.Raw
+	for cursor.Next(ctx) {
+		documents = append(documents, append(bson.Raw(nil), cursor.Current...))
+	}
+
+	return documents, cursor.Err()
+}
+
+func (m *MongodbRepository) DeleteRawMonth(ctx context.Context, month time.Time) (int64, error) {
+	result, err := m.CollectionName.DeleteMany(ctx, monthMatch(month))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (m *MongodbRepository) archiveState(ctx context.Context) (*ShopPlan, error) {
+	var plan ShopPlan
+	err := withRetry(ctx, func() error {
+		return m.database.Collection(planCollection).FindOne(ctx, bson.M{"shop_id": m.ShopID}).Decode(&plan)
+	})
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &plan, nil
+}
+
+// archiveStages extends a raw read reaching before the shop's archive boundary. Collection archives are
+// unioned month by month; object store archives are not queryable, their kept rollups stand in for them.
+func (m *MongodbRepository) archiveStages(ctx context.Context, since time.Time, until time.Time) ([]bson.M, error) {
+	// No plan keeps less than a month, recent reads skip the lookup
+	if since.After(time.Now().UTC().AddDate(0, -1, 0)) {
+		return nil, nil
+	}
+
+	plan, err := m.archiveState(ctx)
+	if err != nil || plan == nil || plan.ArchivedBefore.IsZero() || !since.Before(plan.ArchivedBefore) {
+		return nil, err
+	}
+
+	archivedUntil := plan.ArchivedBefore.AddDate(0, 0, -1)
+	if until.Before(archivedUntil) {
+		archivedUntil = until
+	}
+
+	if plan.ArchiveMode != ArchiveCollection {
+		return []bson.M{
+			{
+				"$unionWith": bson.M{
+					"coll":     m.Rollup.Name(),
+					"pipeline": bson.A{dateMatch(since, archivedUntil)},
+				},
+			},
+		}, nil
+	}
+
+	var stages []bson.M
+	for month := time.Date(since.Year(), since.Month(), 1, 0, 0, 0, 0, time.UTC); !month.After(archivedUntil); month = month.AddDate(0, 1, 0) {
+		stages = append(stages, bson.M{
+			"$unionWith": bson.M{
+				"coll":     monthArchiveName(m.ShopID, month),
+				"pipeline": bson.A{dateMatch(since, archivedUntil)},
+			},
+		})
+	}
+
+	return stages, nil
+}
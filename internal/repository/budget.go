@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const budgetCollection = "budgets"
+
+type BudgetRepository struct {
+	Collection *mongo.Collection
+}
+
+func NewBudgetRepository(ctx context.Context) (*BudgetRepository, error) {
+	database, err := getDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BudgetRepository{
+		Collection: database.Collection(budgetCollection),
+	}, nil
+}
+
+// ErrBudgetNotFound is returned when a budget does not exist or belongs to another shop.
+var ErrBudgetNotFound = errors.New("budget not found")
+
+// Save creates the budget, or replaces it when it has an id. A shop can only replace its own budgets.
+func (b *BudgetRepository) Save(ctx context.Context, budget *Budget) error {
+	if budget.ID.IsZero() {
+		budget.ID = primitive.NewObjectID()
+	}
+
+	err := withRetry(ctx, func() error {
+		_, errW := b.Collection.ReplaceOne(ctx, bson.M{"_id": budget.ID, "shop_id": budget.ShopID}, budget, options.Replace().SetUpsert(true))
+		return errW
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		// The id is taken by a budget of another shop
+		return ErrBudgetNotFound
+	}
+
+	return err
+}
+
+func (b *BudgetRepository) Delete(ctx context.Context, shopID int64, id primitive.ObjectID) error {
+	var result *mongo.DeleteResult
+	err := withRetry(ctx, func() error {
+		var errW error
+		result, errW = b.Collection.DeleteOne(ctx, bson.M{"_id": id, "shop_id": shopID})
+		return errW
+	})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrBudgetNotFound
+	}
+
+	return nil
+}
+
+func (b *BudgetRepository) ListByShop(ctx context.Context, shopID int64) ([]Budget, error) {
+	var budgets []Budget
+	err := withRetry(ctx, func() error {
+		cursor, errF := b.Collection.Find(ctx, bson.M{"shop_id": shopID})
+		if errF != nil {
+			return errF
+		}
+
+		return cursor.All(ctx, &budgets)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return budgets, nil
+}
+
+// ForMonth returns the shop's budgets that apply to the month, both recurring and month specific ones.
+func (b *BudgetRepository) ForMonth(ctx context.Context, shopID int64, month string) ([]Budget, error) {
+	var budgets []Budget
+	err := withRetry(ctx, func() error {
+		cursor, errF := b.Collection.Find(ctx, bson.M{
+			"shop_id": shopID,
+			"month":   bson.M{"$in": bson.A{month, nil, ""}},
+		})
+		if errF != nil {
+			return errF
+		}
+
+		return cursor.All(ctx, &budgets)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return budgets, nil
+}
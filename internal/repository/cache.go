@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const cacheCollection = "insight_cache"
+
+// cacheIndexes let Mongo drop expired entries and serve the per shop invalidation. Entries still waiting for the
+// TTL monitor are skipped by the expires_at check on read.
+var cacheIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	{Keys: bson.D{{Key: "shop_id", Value: 1}}},
+}
+
+type CachedInsights struct {
+	Key       string    `bson:"_id"`
+	ShopID    int64     `bson:"shop_id"`
+	Payload   []byte    `bson:"payload"`
+	CreatedAt time.Time `bson:"created_at"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+func (m *MongodbRepository) cache() *mongo.Collection {
+	return m.database.Collection(cacheCollection)
+}
+
+// CachedInsights returns the unexpired entry for the key, or nil.
+func (m *MongodbRepository) CachedInsights(ctx context.Context, key string, now time.Time) (*CachedInsights, error) {
+	var entry CachedInsights
+	err := withRetry(ctx, func() error {
+		return m.cache().FindOne(ctx, bson.M{
+			"_id":        key,
+			"shop_id":    m.ShopID,
+			"expires_at": bson.M{"$gt": now},
+		}).Decode(&entry)
+	})
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+func (m *MongodbRepository) CacheInsights(ctx context.Context, key string, payload []byte, now time.Time, ttl time.Duration) error {
+	entry := CachedInsights{
+		Key:       key,
+		ShopID:    m.ShopID,
+		Payload:   payload,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	return withRetry(ctx, func() error {
+		_, errW := m.cache().ReplaceOne(ctx, bson.M{"_id": key}, entry, options.Replace().SetUpsert(true))
+		return errW
+	})
+}
+
+// InvalidateInsightCache drops every cached result of the shop, called whenever its data changes.
+func (m *MongodbRepository) InvalidateInsightCache(ctx context.Context) error {
+	return withRetry(ctx, func() error {
+		_, errW := m.cache().DeleteMany(ctx, bson.M{"shop_id": m.ShopID})
+		return errW
+	})
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"testing"
+	"time"
+)
+
+// mockRepository is a per shop repository of shop 12 on the mock deployment, commands get the mocked responses.
+func mockRepository(mt *mtest.T) *MongodbRepository {
+	return &MongodbRepository{
+		database:       mt.DB,
+		CollectionName: newTenantCollection(mt.DB.Collection("acction_12"), 12, false),
+		Rollup:         newTenantCollection(mt.DB.Collection("rollup_12"), 12, false),
+		RollupCoverage: newTenantCollection(mt.DB.Collection("rollup_coverage_12"), 12, false),
+		ShopID:         12,
+	}
+}
+
+func TestCachedInsights(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	ctx := context.Background()
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	namespace := mtest.TestDb + "." + cacheCollection
+
+	checkFilter := func(mt *mtest.T) {
+		filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+		if got := filter.Lookup("shop_id").AsInt64(); got != 12 {
+			t.Errorf("filter shop_id = %d, want 12", got)
+		}
+		if got := filter.Lookup("expires_at", "$gt").Time().UTC(); !got.Equal(now) {
+			t.Errorf("filter expires_at $gt = %v, want %v", got, now)
+		}
+	}
+
+	mt.Run("hit", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: "key"},
+			{Key: "shop_id", Value: int64(12)},
+			{Key: "payload", Value: []byte(`[{"id":"a1"}]`)},
+			{Key: "created_at", Value: now.Add(-time.Minute)},
+			{Key: "expires_at", Value: now.Add(4 * time.Minute)},
+		}))
+
+		entry, err := mockRepository(mt).CachedInsights(ctx, "key", now)
+		if err != nil {
+			t.Fatalf("CachedInsights() error = %v", err)
+		}
+		if entry == nil || string(entry.Payload) != `[{"id":"a1"}]` {
+			t.Fatalf("CachedInsights() = %+v, want the cached payload", entry)
+		}
+		checkFilter(mt)
+	})
+
+	mt.Run("expired", func(mt *mtest.T) {
+		// The expires_at filter leaves out entries the TTL monitor did not drop yet
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch))
+
+		entry, err := mockRepository(mt).CachedInsights(ctx, "key", now)
+		if err != nil || entry != nil {
+			t.Fatalf("CachedInsights() = %+v, %v, want a miss", entry, err)
+		}
+		checkFilter(mt)
+	})
+
+	mt.Run("write expires after the ttl", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+
+		if err := mockRepository(mt).CacheInsights(ctx, "key", []byte(`[]`), now, 5*time.Minute); err != nil {
+			t.Fatalf("CacheInsights() error = %v", err)
+		}
+		update := mt.GetStartedEvent().Command.Lookup("updates", "0").Document()
+		if got := update.Lookup("u", "expires_at").Time().UTC(); !got.Equal(now.Add(5 * time.Minute)) {
+			t.Errorf("expires_at = %v, want %v", got, now.Add(5*time.Minute))
+		}
+		if !update.Lookup("upsert").Boolean() {
+			t.Error("cache write is not an upsert")
+		}
+	})
+}
+
+func TestUpsertAdRowsInvalidatesCache(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("invalidate", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 3}),
+		)
+
+		writes := []AdRowWrite{{
+			Row:    AdRow{AdID: "1", Date: time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+			Fields: []string{"spend"},
+		}}
+		if _, err := mockRepository(mt).UpsertAdRows(context.Background(), writes); err != nil {
+			t.Fatalf("UpsertAdRows() error = %v", err)
+		}
+
+		events := mt.GetAllStartedEvents()
+		if len(events) == 0 {
+			t.Fatal("no command sent")
+		}
+		last := events[len(events)-1]
+		if last.CommandName != "delete" || last.Command.Lookup("delete").StringValue() != cacheCollection {
+			t.Fatalf("last command = %s, want a delete on %s", last.Command, cacheCollection)
+		}
+		if got := last.Command.Lookup("deletes", "0", "q", "shop_id").AsInt64(); got != 12 {
+			t.Errorf("invalidated shop_id = %d, want 12", got)
+		}
+	})
+}
@@ -0,0 +1,294 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/minhlong/go-aws-boilerplate/pkg/failure"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.uber.org/zap"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without touching the cluster while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("mongo circuit breaker is open")
+
+const (
+	// A Lambda container serves one invocation at a time, a small pool avoids exhausting Atlas connection limits
+	// when many containers run at once.
+	defaultMaxPoolSize            = 10
+	defaultServerSelectionTimeout = 5 * time.Second
+	defaultRetryAttempts          = 3
+	retryBaseBackoff              = 100 * time.Millisecond
+	retryMaxBackoff               = 2 * time.Second
+	defaultBreakerFailures        = 5
+	defaultBreakerCooldown        = 30 * time.Second
+)
+
+// connectionManager owns the process wide client. The client is created once and reused by every invocation,
+// the driver monitors the cluster and reconnects on its own so the client is never torn down while in use.
+type connectionManager struct {
+	mu      sync.Mutex
+	client  *mongo.Client
+	uri     string
+	breaker *circuitBreaker
+}
+
+var connections = &connectionManager{
+	breaker: &circuitBreaker{
+		threshold: envInt("MONGO_BREAKER_FAILURES", defaultBreakerFailures),
+		cooldown:  envDuration("MONGO_BREAKER_COOLDOWN", defaultBreakerCooldown),
+	},
+}
+
+func (c *connectionManager) get(ctx context.Context, connectionUri string) (*mongo.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client != nil && c.uri == connectionUri {
+		return c.client, nil
+	}
+
+	var client *mongo.Client
+	err := withRetry(ctx, func() error {
+		var errC error
+		client, errC = connect(ctx, connectionUri)
+		return errC
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A different URI only happens in tools switching clusters, the previous client is no longer handed out
+	if c.client != nil {
+		go c.client.Disconnect(context.Background())
+	}
+	c.client, c.uri = client, connectionUri
+
+	return client, nil
+}
+
+func (c *connectionManager) close(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client == nil {
+		return nil
+	}
+	err := c.client.Disconnect(ctx)
+	c.client, c.uri = nil, ""
+
+	return err
+}
+
+func connect(ctx context.Context, connectionUri string) (*mongo.Client, error) {
+	appName := os.Getenv("AWS_REGION") + ":" + os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
+	clientOptions := options.Client().ApplyURI(connectionUri).
+		SetAppName(appName).
+		SetMaxPoolSize(uint64(envInt("MONGO_MAX_POOL_SIZE", defaultMaxPoolSize))).
+		SetMinPoolSize(uint64(envInt("MONGO_MIN_POOL_SIZE", 0))).
+		SetServerSelectionTimeout(envDuration("MONGO_SERVER_SELECTION_TIMEOUT", defaultServerSelectionTimeout)).
+		SetRetryReads(true).
+		SetRetryWrites(true).
+		SetMonitor(newCommandMonitor())
+
+	client, err := mongo.Connect(ctx, clientOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// The cluster is checked once on connect, not on every invocation
+	if err := client.Ping(ctx, readpref.Primary()); err != nil {
+		client.Disconnect(context.Background())
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// CloseConnections disconnects the process wide client, for tools and workers shutting down.
+func CloseConnections(ctx context.Context) error {
+	return connections.close(ctx)
+}
+
+// withRetry runs an operation through the circuit breaker and retries transient failures with a jittered backoff.
+func withRetry(ctx context.Context, operation func() error) error {
+	attempts := envInt("MONGO_RETRY_ATTEMPTS", defaultRetryAttempts)
+	for attempt := 0; ; attempt++ {
+		if !connections.breaker.allow() {
+			return ErrCircuitOpen
+		}
+
+		err := operation()
+		transient := err != nil && ctx.Err() == nil && isTransient(err)
+		connections.breaker.record(ctx, transient)
+		if !transient || attempt+1 >= attempts {
+			return err
+		}
+
+		logging.L(ctx).Warn("retrying mongo operation", zap.Int("attempt", attempt+1), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryBackoff(attempt)):
+		}
+	}
+}
+
+// isTransient tells network errors, timeouts and errors labelled retryable by the server apart from errors
+// that fail again on retry, such as an invalid pipeline.
+func isTransient(err error) bool {
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) {
+		return true
+	}
+
+	var labeled mongo.LabeledError
+	if errors.As(err, &labeled) {
+		return labeled.HasErrorLabel("RetryableWriteError") || labeled.HasErrorLabel("TransientTransactionError")
+	}
+
+	return false
+}
+
+// permanentCodes are server error codes of requests that fail the same way on every retry: malformed or
+// invalid commands and pipelines, denied access, duplicate keys and conflicting indexes.
+var permanentCodes = []int{
+	2,     // BadValue
+	9,     // FailedToParse
+	13,    // Unauthorized
+	14,    // TypeMismatch
+	18,    // AuthenticationFailed
+	20,    // IllegalOperation
+	22,    // InvalidBSON
+	40,    // ConflictingUpdateOperators
+	52,    // DollarPrefixedFieldName
+	66,    // ImmutableField
+	67,    // CannotCreateIndex
+	72,    // InvalidOptions
+	85,    // IndexOptionsConflict
+	86,    // IndexKeySpecsConflict
+	121,   // DocumentValidationFailure
+	166,   // CommandNotSupportedOnView
+	168,   // InvalidPipelineOperator
+	11000, // DuplicateKey
+	40324, // Unrecognized pipeline stage name
+}
+
+// isPermanent tells server errors known to fail again on retry apart from everything else.
+func isPermanent(err error) bool {
+	var serverError mongo.ServerError
+	if !errors.As(err, &serverError) {
+		return false
+	}
+	for _, code := range permanentCodes {
+		if serverError.HasErrorCode(code) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// classify marks a driver error as permanent when its code is known to fail on every retry, and as transient
+// otherwise, so an unknown failure is retried and only dead lettered once SQS runs out of receives.
+func classify(err error, reason string) error {
+	if isPermanent(err) {
+		return failure.Permanent(err, reason)
+	}
+
+	return failure.Transient(err, reason)
+}
+
+func retryBackoff(attempt int) time.Duration {
+	wait := retryBaseBackoff << attempt
+	if wait > retryMaxBackoff {
+		wait = retryMaxBackoff
+	}
+
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// circuitBreaker opens after a run of transient failures and lets a single trial through once the cooldown passed.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	trial     bool
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if time.Since(b.openedAt) < b.cooldown || b.trial {
+		return false
+	}
+	b.trial = true
+
+	return true
+}
+
+func (b *circuitBreaker) record(ctx context.Context, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		if b.failures == b.threshold {
+			logging.L(ctx).Error("mongo circuit breaker opened", zap.Duration("cooldown", b.cooldown))
+		}
+		b.openedAt = time.Now()
+	}
+}
+
+// analyticsReadPreference sends analytics reads to secondaries when available, off the primary that takes the
+// ingestion and sync writes. MONGO_ANALYTICS_READ_PREFERENCE overrides the mode, e.g. "primary" for deployments
+// that can not accept replication lag on insights read right after a sync.
+func analyticsReadPreference() *readpref.ReadPref {
+	mode, err := readpref.ModeFromString(os.Getenv("MONGO_ANALYTICS_READ_PREFERENCE"))
+	if err != nil {
+		return readpref.SecondaryPreferred()
+	}
+
+	pref, err := readpref.New(mode)
+	if err != nil {
+		return readpref.SecondaryPreferred()
+	}
+
+	return pref
+}
+
+func envInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value < 0 {
+		return fallback
+	}
+
+	return value
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+
+	return value
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/minhlong/go-aws-boilerplate/pkg/failure"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"testing"
+	"time"
+)
+
+func TestAnalyticsReadPreference(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  readpref.Mode
+	}{
+		{name: "unset prefers secondaries", want: readpref.SecondaryPreferredMode},
+		{name: "invalid prefers secondaries", value: "nearest-ish", want: readpref.SecondaryPreferredMode},
+		{name: "primary when configured", value: "primary", want: readpref.PrimaryMode},
+		{name: "nearest", value: "nearest", want: readpref.NearestMode},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("MONGO_ANALYTICS_READ_PREFERENCE", test.value)
+			if got := analyticsReadPreference().Mode(); got != test.want {
+				t.Errorf("analyticsReadPreference() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want failure.Kind
+	}{
+		{name: "unknown error", err: errors.New("something broke"), want: failure.KindTransient},
+		{name: "open circuit", err: ErrCircuitOpen, want: failure.KindTransient},
+		{name: "network error", err: mongo.CommandError{Code: 6, Labels: []string{"NetworkError"}}, want: failure.KindTransient},
+		{name: "unknown server code", err: mongo.CommandError{Code: 91, Name: "ShutdownInProgress"}, want: failure.KindTransient},
+		{name: "invalid pipeline", err: mongo.CommandError{Code: 40324, Name: "Location40324"}, want: failure.KindPermanent},
+		{name: "unauthorized", err: mongo.CommandError{Code: 13, Name: "Unauthorized"}, want: failure.KindPermanent},
+		{name: "wrapped bad value", err: fmt.Errorf("aggregate: %w", mongo.CommandError{Code: 2, Name: "BadValue"}), want: failure.KindPermanent},
+		{
+			name: "duplicate key write",
+			err:  mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "E11000 duplicate key"}}},
+			want: failure.KindPermanent,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := classify(test.err, "can not aggregate insights")
+			if got := failure.KindOf(err); got != test.want {
+				t.Errorf("classify() kind = %s, want %s", got, test.want)
+			}
+			if got := failure.ReasonOf(err); got != "can not aggregate insights" {
+				t.Errorf("classify() reason = %q", got)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	type step struct {
+		// wait before the step, failed is recorded after an allowed call
+		wait    time.Duration
+		allowed bool
+		failed  bool
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "stays closed below the threshold",
+			steps: []step{
+				{allowed: true, failed: true},
+				{allowed: true, failed: false},
+				{allowed: true, failed: true},
+				{allowed: true, failed: false},
+			},
+		},
+		{
+			name: "opens at the threshold",
+			steps: []step{
+				{allowed: true, failed: true},
+				{allowed: true, failed: true},
+				{allowed: false},
+				{allowed: false},
+			},
+		},
+		{
+			name: "lets one trial through after the cooldown and closes on success",
+			steps: []step{
+				{allowed: true, failed: true},
+				{allowed: true, failed: true},
+				{wait: 60 * time.Millisecond, allowed: true, failed: false},
+				{allowed: true, failed: false},
+			},
+		},
+		{
+			name: "a failed trial opens it again",
+			steps: []step{
+				{allowed: true, failed: true},
+				{allowed: true, failed: true},
+				{wait: 60 * time.Millisecond, allowed: true, failed: true},
+				{allowed: false},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			breaker := &circuitBreaker{threshold: 2, cooldown: 50 * time.Millisecond}
+			for i, step := range test.steps {
+				time.Sleep(step.wait)
+				if got := breaker.allow(); got != step.allowed {
+					t.Fatalf("step %d: allow() = %v, want %v", i, got, step.allowed)
+				}
+				if step.allowed {
+					breaker.record(ctx, step.failed)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerSingleTrial(t *testing.T) {
+	breaker := &circuitBreaker{threshold: 1, cooldown: time.Millisecond}
+	breaker.record(context.Background(), true)
+	time.Sleep(5 * time.Millisecond)
+
+	if !breaker.allow() {
+		t.Fatal("allow() = false after the cooldown, want a trial")
+	}
+	if breaker.allow() {
+		t.Error("allow() = true while the trial runs, want one trial only")
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	networkError := mongo.CommandError{Code: 6, Labels: []string{"NetworkError"}}
+	invalidPipeline := mongo.CommandError{Code: 40324, Name: "Location40324"}
+
+	tests := []struct {
+		name     string
+		errs     []error
+		attempts int
+		fails    bool
+	}{
+		{name: "success", errs: []error{nil}, attempts: 1},
+		{name: "transient failure is retried", errs: []error{networkError, nil}, attempts: 2},
+		{name: "permanent failure is not retried", errs: []error{invalidPipeline}, attempts: 1, fails: true},
+		{name: "gives up after the attempts", errs: []error{networkError, networkError, networkError, nil}, attempts: 3, fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts := 0
+			err := withRetry(context.Background(), func() error {
+				err := test.errs[attempts]
+				attempts++
+				return err
+			})
+			if (err != nil) != test.fails {
+				t.Errorf("withRetry() error = %v, want failure %v", err, test.fails)
+			}
+			if attempts != test.attempts {
+				t.Errorf("withRetry() made %d attempts, want %d", attempts, test.attempts)
+			}
+			// Leave the process wide breaker closed for the next case
+			connections.breaker.record(context.Background(), false)
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const (
+	sharedCoverageCollection = "rollup_coverage"
+	// Recent days are restated by producers that do not write through UpsertAdRows, their rollups are only
+	// trusted for rollupMaxAge.
+	rollupRecentDays = 3
+	rollupMaxAge     = 6 * time.Hour
+)
+
+// coverageIndexes keep one coverage document per day.
+var coverageIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "date", Value: 1}}, Options: options.Index().SetUnique(true)},
+}
+
+// rollupDay tracks how current a day's rollup is. RolledAt is when the last refresh of the day started,
+// WrittenAt when rows of the day were last written through UpsertAdRows.
+type rollupDay struct {
+	Date      time.Time `bson:"date"`
+	RolledAt  time.Time `bson:"rolled_at"`
+	WrittenAt time.Time `bson:"written_at"`
+}
+
+// markRolled records that the rollups of every day between since and until hold the raw rows as of rolledAt.
+func (m *MongodbRepository) markRolled(ctx context.Context, since time.Time, until time.Time, rolledAt time.Time) error {
+	return m.markDays(ctx, daysBetween(since, until), "rolled_at", rolledAt)
+}
+
+// markWritten records that rows of the days were written at writtenAt, their rollups are stale until refreshed.
+func (m *MongodbRepository) markWritten(ctx context.Context, days []time.Time, writtenAt time.Time) error {
+	return m.markDays(ctx, days, "written_at", writtenAt)
+}
+
+func (m *MongodbRepository) markDays(ctx context.Context, days []time.Time, field string, at time.Time) error {
+	if len(days) == 0 {
+		return nil
+	}
+
+	filters := make([]bson.M, 0, len(days))
+	updates := make([]bson.M, 0, len(days))
+	for _, day := range days {
+		filters = append(filters, bson.M{"date": day})
+		updates = append(updates, bson.M{"$max": bson.M{field: at}})
+	}
+	_, err := m.RollupCoverage.UpsertMany(ctx, filters, updates)
+
+	return err
+}
+
+// rollupCoverage returns the coverage of the days between since and until that have any.
+func (m *MongodbRepository) rollupCoverage(ctx context.Context, since time.Time, until time.Time) (map[time.Time]rollupDay, error) {
+	cursor, err := m.RollupCoverage.Find(ctx, bson.M{"date": bson.M{"$gte": since, "$lte": until}})
+	if err != nil {
+		return nil, err
+	}
+
+	var days []rollupDay
+	if err := cursor.All(ctx, &days); err != nil {
+		return nil, err
+	}
+
+	coverage := make(map[time.Time]rollupDay, len(days))
+	for _, day := range days {
+		coverage[day.Date.UTC()] = day
+	}
+
+	return coverage, nil
+}
+
+// splitCoverage sorts the days between since and until into those the rollups can serve and those to read raw:
+// days never rolled up, written since their last refresh, or recent and rolled up longer than rollupMaxAge ago.
+func splitCoverage(coverage map[time.Time]rollupDay, since time.Time, until time.Time, now time.Time) ([]time.Time, []time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	recentFrom := today.AddDate(0, 0, -rollupRecentDays)
+
+	var covered, uncovered []time.Time
+	for _, day := range daysBetween(since, until) {
+		rolled, ok := coverage[day]
+		fresh := ok && !rolled.RolledAt.IsZero() && !rolled.WrittenAt.After(rolled.RolledAt) &&
+			(day.Before(recentFrom) || now.Sub(rolled.RolledAt) <= rollupMaxAge)
+		if fresh {
+			covered = append(covered, day)
+		} else {
+			uncovered = append(uncovered, day)
+		}
+	}
+
+	return covered, uncovered
+}
+
+// daysBetween lists the midnights (UTC) from since to until, both included.
+func daysBetween(since time.Time, until time.Time) []time.Time {
+	since = since.UTC()
+	day := time.Date(since.Year(), since.Month(), since.Day(), 0, 0, 0, 0, time.UTC)
+	if day.Before(since) {
+		day = day.AddDate(0, 0, 1)
+	}
+
+	var days []time.Time
+	for ; !day.After(until); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+
+	return days
+}
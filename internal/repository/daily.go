@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"time"
+)
+
+const (
+	LevelAccount  = "account"
+	LevelCampaign = "campaign"
+	LevelAdGroup  = "ad_group"
+	LevelAd       = "ad"
+)
+
+var levelFields = map[string]struct {
+	ID   string
+	Name string
+}{
+	LevelAccount:  {ID: "$ad_account_id", Name: "$ad_account_name"},
+	LevelCampaign: {ID: "$campaign_id", Name: "$campaign_name"},
+	LevelAd:       {ID: "$ad_id", Name: "$ad_name"},
+}
+
+// DailyMetrics returns one row per entity of the given level and per day between since and until.
+func (m *MongodbRepository) DailyMetrics(ctx context.Context, level string, since time.Time, until time.Time) ([]DailyMetric, error) {
+	return m.dailyMetrics(ctx, level, bson.M{
+		"date": bson.M{
+			"$gte": since,
+			"$lte": until,
+		},
+	})
+}
+
+// AdDayMetrics returns the day totals of the given ads on the given days.
+func (m *MongodbRepository) AdDayMetrics(ctx context.Context, adIDs []string, dates []time.Time) ([]DailyMetric, error) {
+	return m.dailyMetrics(ctx, LevelAd, bson.M{
+		"ad_id": bson.M{"$in": adIDs},
+		"date":  bson.M{"$in": dates},
+	})
+}
+
+func (m *MongodbRepository) dailyMetrics(ctx context.Context, level string, match bson.M) ([]DailyMetric, error) {
+	fields, ok := levelFields[level]
+	if !ok {
+		fields = levelFields[LevelAd]
+	}
+
+	pipeLine := []bson.M{
+		{
+			"$match": match,
+		},
+		{
+			"$group": bson.M{
+				"_id": bson.D{
+					{Key: "entity_id", Value: fields.ID},
+					{Key: "date", Value: "$date"},
+				},
+				"entity_id":   bson.M{"$first": fields.ID},
+				"entity_name": bson.M{"$first": fields.Name},
+				"campaign_id": bson.M{"$first": "$campaign_id"},
+				"account_id":  bson.M{"$first": "$ad_account_id"},
+				"date":        bson.M{"$first": "$date"},
+				"spend":       bson.M{"$sum": "$spend"},
+				"clicks":      bson.M{"$sum": "$clicks"},
+				"impressions": bson.M{"$sum": "$impressions"},
+				"purchases": bson.M{"$sum": bson.M{
+					"$ifNull": bson.A{bson.M{"$toDouble": "$purchases"}, 0},
+				}},
+				"purchases_value": bson.M{"$sum": bson.M{
+					"$toDouble": bson.M{"$ifNull": bson.A{"$purchases_value", 0}},
+				}},
+			},
+		},
+		{
+			"$sort": bson.D{
+				{Key: "entity_id", Value: 1},
+				{Key: "date", Value: 1},
+			},
+		},
+	}
+
+	var metrics []DailyMetric
+	if err := m.aggregate(ctx, m.CollectionName, pipeLine, &metrics); err != nil {
+		return nil, err
+	}
+
+	return metrics, nil
+}
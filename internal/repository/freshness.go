@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"time"
+)
+
+// DayFreshness returns, for each day an account has rows between since and until, when it was last written.
+// Rows written by producers that do not set updated_at map to the zero time.
+func (m *MongodbRepository) DayFreshness(ctx context.Context, accountID string, since time.Time, until time.Time) (map[time.Time]time.Time, error) {
+	pipeLine := []bson.M{
+		{
+			"$match": bson.M{
+				"ad_account_id": accountID,
+				"date": bson.M{
+					"$gte": since,
+					"$lte": until,
+				},
+			},
+		},
+		{
+			"$group": bson.M{
+				"_id":        "$date",
+				"updated_at": bson.M{"$max": "$updated_at"},
+			},
+		},
+	}
+
+	var days []struct {
+		Date      time.Time `bson:"_id"`
+		UpdatedAt time.Time `bson:"updated_at"`
+	}
+	if err := m.aggregate(ctx, m.CollectionName, pipeLine, &days); err != nil {
+		return nil, err
+	}
+
+	freshness := make(map[time.Time]time.Time, len(days))
+	for _, day := range days {
+		freshness[day.Date.UTC()] = day.UpdatedAt
+	}
+
+	return freshness, nil
+}
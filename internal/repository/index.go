@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"github.com/minhlong/go-aws-boilerplate/pkg/metrics"
+	"github.com/minhlong/go-aws-boilerplate/pkg/tracing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// shopIndexes serve the date range match every insight query starts with, and the per ad, account and
+// campaign lookups of ingestion and sync.
+var shopIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "date", Value: 1}}},
+	{Keys: bson.D{{Key: "ad_id", Value: 1}, {Key: "date", Value: 1}}},
+	{Keys: bson.D{{Key: "ad_account_id", Value: 1}, {Key: "date", Value: 1}}},
+	{Keys: bson.D{{Key: "campaign_id", Value: 1}, {Key: "date", Value: 1}}},
+}
+
+// sharedRawIndexes keep raw document ids unique per shop in the shared layout, layout migrations merge on them.
+var sharedRawIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+}
+
+// indexBuildTimeout bounds the background index build started on first use.
+const indexBuildTimeout = 5 * time.Minute
+
+// ensuredCollections remembers the collections whose indexes were checked by this process.
+var ensuredCollections sync.Map
+
+// indexes lists the index models of each collection of the repository: the shop indexes on the raw and rollup
+// collections, the unique (shop_id, _id) raw index of the shared layout, the rollup coverage index and the result
+// cache indexes. The cache is one collection for every shop in both layouts, its entries carry their shop_id.
+func (m *MongodbRepository) indexes() map[*TenantCollection][]mongo.IndexModel {
+	raw := shopIndexes
+	if m.CollectionName.Shared() {
+		raw = append(append([]mongo.IndexModel(nil), shopIndexes...), sharedRawIndexes...)
+	}
+
+	return map[*TenantCollection][]mongo.IndexModel{
+		m.CollectionName: raw,
+		m.Rollup:         shopIndexes,
+		m.RollupCoverage: coverageIndexes,
+		newTenantCollection(m.cache(), m.ShopID, false): cacheIndexes,
+	}
+}
+
+// EnsureIndexes creates the indexes of every collection of the repository and waits for them. It is run by the
+// retention job, layout migrations and cmd/ensure-indexes.
+func (m *MongodbRepository) EnsureIndexes(ctx context.Context) error {
+	for collection, models := range m.indexes() {
+		if err := collection.CreateIndexes(ctx, models); err != nil {
+			return err
+		}
+		ensuredCollections.Store(collection.Name(), true)
+	}
+
+	return nil
+}
+
+// ensureIndexesOnFirstUse starts the index build of the collections this process did not check yet. The build
+// runs in the background on a detached context, building an index on a large collection must neither hold up
+// nor be cancelled with the invocation. A failed build is logged and tried again on the next use.
+func (m *MongodbRepository) ensureIndexesOnFirstUse() {
+	for collection, models := range m.indexes() {
+		if _, loaded := ensuredCollections.LoadOrStore(collection.Name(), true); loaded {
+			continue
+		}
+
+		go func(collection *TenantCollection, models []mongo.IndexModel) {
+			ctx, cancel := context.WithTimeout(context.Background(), indexBuildTimeout)
+			defer cancel()
+
+			if err := collection.CreateIndexes(ctx, models); err != nil {
+				ensuredCollections.Delete(collection.Name())
+				logging.L(ctx).Warn("can not ensure indexes", zap.String("collection", collection.Name()), zap.Error(err))
+			}
+		}(collection, models)
+	}
+}
+
+// aggregate runs a pipeline, retrying transient failures, and decodes every result into results, a pointer to a
+// slice. Pipelines writing through $merge or $out pass nil results, their cursor is only closed. AggregationTime
+// covers running the pipeline and draining the cursor. In diagnostic mode the query plan is logged first and a
+// collection scan is warned about.
+func (m *MongodbRepository) aggregate(ctx context.Context, collection *TenantCollection, pipeLine []bson.M, results interface{}) error {
+	if m.Diagnostics {
+		m.explain(ctx, collection, pipeLine)
+	}
+
+	// Analytics reads may be sent to a secondary when configured, pipelines writing through $merge or $out stay
+	// on the primary
+	if !writesOutput(pipeLine) {
+		collection = collection.WithReadPreference(analyticsReadPreference())
+	}
+
+	ctx, span := tracing.Start(ctx, "repository.aggregate", trace.WithAttributes(
+		attribute.String("db.mongodb.collection", collection.Name()),
+		attribute.Int("pipeline.stages", len(pipeLine)),
+	))
+	start := time.Now()
+	cursor, err := collection.Aggregate(ctx, pipeLine)
+	if err == nil {
+		if results != nil {
+			err = cursor.All(ctx, results)
+		} else {
+			err = cursor.Close(ctx)
+		}
+	}
+	tracing.End(span, err)
+	metrics.Duration(ctx, "AggregationTime", start)
+
+	return err
+}
+
+func writesOutput(pipeLine []bson.M) bool {
+	if len(pipeLine) == 0 {
+		return false
+	}
+	last := pipeLine[len(pipeLine)-1]
+	_, merge := last["$merge"]
+	_, out := last["$out"]
+
+	return merge || out
+}
+
+// explain logs the query plan of a pipeline. Only the planner runs, an execution stats explain would run the
+// whole pipeline a second time.
+func (m *MongodbRepository) explain(ctx context.Context, collection *TenantCollection, pipeLine []bson.M) {
+	command := bson.D{
+		{Key: "explain", Value: bson.D{
+			{Key: "aggregate", Value: collection.Name()},
+			{Key: "pipeline", Value: collection.Pipeline(pipeLine)},
+			{Key: "cursor", Value: bson.D{}},
+		}},
+		{Key: "verbosity", Value: "queryPlanner"},
+	}
+
+	var plan bson.M
+	err := withRetry(ctx, func() error {
+		return m.database.RunCommand(ctx, command).Decode(&plan)
+	})
+	if err != nil {
+		logging.L(ctx).Warn("can not explain pipeline", zap.String("collection", collection.Name()), zap.Error(err))
+		return
+	}
+
+	if hasStage(plan, "COLLSCAN") {
+		logging.L(ctx).Warn("pipeline falls back to a collection scan", zap.String("collection", collection.Name()), zap.Any("plan", plan))
+		return
+	}
+	logging.L(ctx).Debug("pipeline plan", zap.String("collection", collection.Name()), zap.Any("plan", plan))
+}
+
+// hasStage looks for a plan stage anywhere in an explain output.
+func hasStage(node interface{}, stage string) bool {
+	switch value := node.(type) {
+	case bson.M:
+		if value["stage"] == stage {
+			return true
+		}
+		for _, child := range value {
+			if hasStage(child, stage) {
+				return true
+			}
+		}
+	case bson.D:
+		return hasStage(value.Map(), stage)
+	case bson.A:
+		for _, child := range value {
+			if hasStage(child, stage) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+func TestWritesOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		pipeLine []bson.M
+		want     bool
+	}{
+		{name: "empty"},
+		{name: "read", pipeLine: []bson.M{{"$match": bson.M{}}, {"$group": bson.M{"_id": "$ad_id"}}}},
+		{name: "merge", pipeLine: []bson.M{{"$match": bson.M{}}, {"$merge": bson.M{"into": "rollup"}}}, want: true},
+		{name: "out", pipeLine: []bson.M{{"$out": "archive"}}, want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := writesOutput(test.pipeLine); got != test.want {
+				t.Errorf("writesOutput() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHasStage(t *testing.T) {
+	indexed := bson.M{"queryPlanner": bson.M{"winningPlan": bson.M{"stage": "FETCH", "inputStage": bson.M{"stage": "IXSCAN"}}}}
+	scanned := bson.M{"stages": bson.A{
+		bson.M{"$cursor": bson.M{"queryPlanner": bson.D{{Key: "winningPlan", Value: bson.M{"stage": "COLLSCAN"}}}}},
+	}}
+
+	tests := []struct {
+		name string
+		plan interface{}
+		want bool
+	}{
+		{name: "index scan", plan: indexed},
+		{name: "collection scan in a pipeline stage", plan: scanned, want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := hasStage(test.plan, "COLLSCAN"); got != test.want {
+				t.Errorf("hasStage() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+// AdRowWrite is a row to store with the fields its writer owns. Fields are bson names of AdRow.
+type AdRowWrite struct {
+	Row    AdRow
+	Fields []string
+}
+
+// UpsertAdRows writes rows keyed by (ad_id, date). A stored row only gets the write's fields and updated_at,
+// fields owned by other writers, such as the assisted and direct purchases, are kept. The other fields are only
+// written when the row is inserted. Replaying rows writes the same values but moves updated_at, which day
+// freshness is read from. The written days are marked stale in the rollup coverage until their rollups are
+// refreshed, and the shop's cached insight results are dropped.
+func (m *MongodbRepository) UpsertAdRows(ctx context.Context, writes []AdRowWrite) (*mongo.BulkWriteResult, error) {
+	if len(writes) == 0 {
+		return &mongo.BulkWriteResult{}, nil
+	}
+
+	filters := make([]bson.M, 0, len(writes))
+	updates := make([]bson.M, 0, len(writes))
+	seen := map[time.Time]bool{}
+	var days []time.Time
+	for _, write := range writes {
+		update, err := adRowUpdate(write)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, bson.M{"ad_id": write.Row.AdID, "date": write.Row.Date})
+		updates = append(updates, update)
+		if day := write.Row.Date.UTC(); !seen[day] {
+			seen[day] = true
+			days = append(days, day)
+		}
+	}
+
+	result, err := m.CollectionName.UpsertMany(ctx, filters, updates)
+	if err != nil {
+		return result, err
+	}
+
+	if err := m.markWritten(ctx, days, time.Now().UTC()); err != nil {
+		return result, err
+	}
+
+	return result, m.InvalidateInsightCache(ctx)
+}
+
+// adRowUpdate sets the write's fields and updated_at, and the rest of the row on insert only.
+func adRowUpdate(write AdRowWrite) (bson.M, error) {
+	raw, err := bson.Marshal(write.Row)
+	if err != nil {
+		return nil, err
+	}
+	var document bson.M
+	if err := bson.Unmarshal(raw, &document); err != nil {
+		return nil, err
+	}
+
+	owned := map[string]bool{"updated_at": true}
+	for _, field := range write.Fields {
+		owned[field] = true
+	}
+
+	set, setOnInsert := bson.M{}, bson.M{}
+	for field, value := range document {
+		switch {
+		case field == "ad_id" || field == "date":
+			// Copied from the filter on insert
+		case owned[field]:
+			set[field] = value
+		default:
+			setOnInsert[field] = value
+		}
+	}
+
+	update := bson.M{"$set": set}
+	if len(setOnInsert) > 0 {
+		update["$setOnInsert"] = setOnInsert
+	}
+
+	return update, nil
+}
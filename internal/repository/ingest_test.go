@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+	"time"
+)
+
+func TestAdRowUpdate(t *testing.T) {
+	row := AdRow{
+		AdID:             "1",
+		Date:             time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC),
+		Spend:            12.5,
+		AssistedPurchase: 3,
+		UpdatedAt:        time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC),
+	}
+
+	update, err := adRowUpdate(AdRowWrite{Row: row, Fields: []string{"spend"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set, _ := update["$set"].(bson.M)
+	setOnInsert, _ := update["$setOnInsert"].(bson.M)
+	tests := []struct {
+		field     string
+		inSet     bool
+		inInserts bool
+	}{
+		{field: "spend", inSet: true},
+		{field: "updated_at", inSet: true},
+		{field: "assisted_purchase", inInserts: true},
+		{field: "valid_parameters", inInserts: true},
+		{field: "ad_id"},
+		{field: "date"},
+	}
+	for _, tt := range tests {
+		_, inSet := set[tt.field]
+		_, inInserts := setOnInsert[tt.field]
+		if inSet != tt.inSet || inInserts != tt.inInserts {
+			t.Errorf("%s: in $set %v, in $setOnInsert %v, want %v and %v", tt.field, inSet, inInserts, tt.inSet, tt.inInserts)
+		}
+	}
+	if set["spend"] != 12.5 {
+		t.Errorf("spend = %v, want 12.5", set["spend"])
+	}
+}
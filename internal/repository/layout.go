@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CopyRawTo copies the shop's raw documents into another layout's collection, adding the shop field when the
+// target is shared and dropping it otherwise. Documents merge on _id, within the shop in a shared target, so a
+// copy can be repeated. The target's indexes must exist: a shared target merges on its unique (shop_id, _id)
+// index, and a document whose _id is taken by another shop fails the copy rather than replacing it.
+func (m *MongodbRepository) CopyRawTo(ctx context.Context, target *MongodbRepository) error {
+	err := m.aggregate(ctx, m.CollectionName, copyStages(m.ShopID, target.CollectionName), nil)
+	if mongo.IsDuplicateKeyError(err) {
+		return errors.WithMessage(err, "raw documents of another shop have the same ids")
+	}
+
+	return err
+}
+
+func copyStages(shopID int64, target *TenantCollection) []bson.M {
+	reshape := bson.M{"$unset": tenantField}
+	on := interface{}("_id")
+	if target.Shared() {
+		reshape = bson.M{"$set": bson.M{tenantField: shopID}}
+		on = bson.A{tenantField, "_id"}
+	}
+
+	return []bson.M{
+		reshape,
+		{
+			"$merge": bson.M{
+				"into":           target.Name(),
+				"on":             on,
+				"whenMatched":    "replace",
+				"whenNotMatched": "insert",
+			},
+		},
+	}
+}
+
+func (m *MongodbRepository) CountRaw(ctx context.Context) (int64, error) {
+	return m.CollectionName.CountDocuments(ctx, bson.M{})
+}
+
+// DropShopData removes the shop's raw and rollup documents, and the rollup coverage, from this layout.
+func (m *MongodbRepository) DropShopData(ctx context.Context) error {
+	if err := m.CollectionName.Drop(ctx); err != nil {
+		return err
+	}
+	if err := m.Rollup.Drop(ctx); err != nil {
+		return err
+	}
+
+	return m.RollupCoverage.Drop(ctx)
+}
@@ -1,19 +1,66 @@
 package repository
 
-import "time"
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Job types carried by RequestInput.JobType, an empty type is an insight request.
+const (
+	JobInsights  = "insights"
+	JobAnomalies = "anomalies"
+	JobPacing    = "pacing"
+	JobUtmAudit  = "utm_audit"
+	JobRollup    = "rollup"
+	JobSubscribe = "subscribe"
+)
+
+// RequestVersion is the RequestInput schema version producers of this code base send. Messages without a
+// version are version 1, the shape from before the version field existed. Version 3 opts into the
+// InsightResponse envelope on the insight notification, older versions keep the bare account array.
+const RequestVersion = 3
 
 type RequestInput struct {
-	ShopID            int64     `json:"sid"`
-	ShopCurrency      string    `json:"cur"`
-	Accounts          []Account `json:"acc"`
-	IAcc              int       `json:"i_acc"`
-	ProgressiveImport bool      `json:"progressive"`
-	AccessToken       string    `json:"access_token"`
-	ConsumerID        int64     `json:"consumer_id"`
-	Name              string    `json:"name"`
-	ShopName          string    `json:"shop_name"`
-	StartSyncTime     time.Time `json:"start_sync_time"`
-	Platform          string    `json:"platform"`
+	Version           int                 `json:"v,omitempty"`
+	ShopID            int64               `json:"sid"`
+	ShopCurrency      string              `json:"cur"`
+	Accounts          []Account           `json:"acc"`
+	IAcc              int                 `json:"i_acc"`
+	ProgressiveImport bool                `json:"progressive"`
+	AccessToken       string              `json:"access_token"`
+	ConsumerID        int64               `json:"consumer_id"`
+	Name              string              `json:"name"`
+	ShopName          string              `json:"shop_name"`
+	StartSyncTime     time.Time           `json:"start_sync_time"`
+	Platform          string              `json:"platform"`
+	Export            *Export             `json:"export,omitempty"`
+	Since             time.Time           `json:"since,omitempty"`
+	Until             time.Time           `json:"until,omitempty"`
+	ScheduleID        string              `json:"schedule_id,omitempty"`
+	Recipients        []string            `json:"recipients,omitempty"`
+	JobType           string              `json:"job_type,omitempty"`
+	Attribution       *AttributionOptions `json:"attribution,omitempty"`
+	Reconcile         bool                `json:"reconcile,omitempty"`
+	SubscribeMinutes  int                 `json:"subscribe_minutes,omitempty"`
+	// BareResult is set when upgrading a message older than version 3, its producer reads the insight
+	// notification as the bare account array.
+	BareResult bool `json:"bare_result,omitempty"`
+}
+
+// AttributionOptions selects the attribution models computed next to the platform numbers.
+// AssistedWeight is the share of an assisted purchase credited by the weighted model, half a purchase when absent.
+type AttributionOptions struct {
+	Models         []string `json:"models"`
+	AssistedWeight *float64 `json:"assisted_weight,omitempty"`
+}
+
+// DateRange returns the inclusive period to aggregate, the single StartSyncTime day when no range is given.
+func (r RequestInput) DateRange() (time.Time, time.Time) {
+	if r.Since.IsZero() || r.Until.IsZero() {
+		return r.StartSyncTime, r.StartSyncTime
+	}
+
+	return r.Since, r.Until
 }
 
 type Account struct {
@@ -35,3 +82,345 @@ type InAppNotification struct {
 	Message           interface{}            `json:"message,omitempty"`
 	Subject           string                 `json:"subject,omitempty"`
 }
+
+type Metrics struct {
+	Clicks           int64   `json:"clicks" bson:"clicks"`
+	Spend            float64 `json:"spend" bson:"spend"`
+	Impressions      int64   `json:"impressions" bson:"impressions"`
+	AddToCart        float64 `json:"add_to_cart" bson:"add_to_cart"`
+	Purchases        float64 `json:"purchases" bson:"purchases"`
+	PurchasesValue   float64 `json:"purchases_value" bson:"purchases_value"`
+	AssistedPurchase float64 `json:"assisted_purchase" bson:"assisted_purchase"`
+	DirectPurchase   float64 `json:"direct_purchase" bson:"direct_purchase"`
+	CTR              float64 `json:"ctr" bson:"ctr"`
+	CostPerATC       float64 `json:"cost_per_atc" bson:"cost_per_atc"`
+	CostPerPurchase  float64 `json:"cost_per_purchase" bson:"cost_per_purchase"`
+	ConversionRate   float64 `json:"conversion_rate" bson:"conversion_rate"`
+	ROAS             float64 `json:"roas" bson:"roas"`
+
+	Attribution   map[string]AttributedMetrics `json:"attribution,omitempty" bson:"-"`
+	StoreVerified *VerifiedMetrics             `json:"store_verified,omitempty" bson:"-"`
+}
+
+// VerifiedMetrics are the purchases confirmed by the shop's own orders.
+type VerifiedMetrics struct {
+	Purchases float64 `json:"purchases"`
+	Revenue   float64 `json:"revenue"`
+	ROAS      float64 `json:"roas"`
+}
+
+// AttributedMetrics are the conversion metrics recomputed under one attribution model.
+type AttributedMetrics struct {
+	Purchases       float64 `json:"purchases"`
+	PurchasesValue  float64 `json:"purchases_value"`
+	ROAS            float64 `json:"roas"`
+	CostPerPurchase float64 `json:"cost_per_purchase"`
+	ConversionRate  float64 `json:"conversion_rate"`
+}
+
+type AdInsight struct {
+	AdID            string `json:"ad_id" bson:"ad_id"`
+	AdName          string `json:"ad_name" bson:"ad_name"`
+	AdStatus        string `json:"ad_status" bson:"ad_status"`
+	ValidParameters bool   `json:"valid_parameters" bson:"valid_parameters"`
+	Metrics         `bson:",inline"`
+}
+
+type AdGroupInsight struct {
+	AdGroupID     string      `json:"ad_group_id" bson:"ad_group_id"`
+	AdGroupName   string      `json:"ad_group_name" bson:"ad_group_name"`
+	AdGroupStatus string      `json:"ad_group_status" bson:"ad_group_status"`
+	Ads           []AdInsight `json:"ads" bson:"ads"`
+	Metrics       `bson:",inline"`
+}
+
+type CampaignInsight struct {
+	CampaignID     string           `json:"campaign_id" bson:"campaign_id"`
+	CampaignName   string           `json:"campaign_name" bson:"campaign_name"`
+	CampaignStatus string           `json:"campaign_status" bson:"campaign_status"`
+	AdGroups       []AdGroupInsight `json:"ad_groups" bson:"ad_groups"`
+	Metrics        `bson:",inline"`
+}
+
+type AccountInsight struct {
+	AccountID   string            `json:"account_id" bson:"account_id"`
+	AccountName string            `json:"account_name" bson:"account_name"`
+	Platform    string            `json:"platform" bson:"platform"`
+	Campaigns   []CampaignInsight `json:"campaigns" bson:"campaigns"`
+	Metrics     `bson:",inline"`
+}
+
+// Export asks the job to render its insights to a downloadable file.
+// Format is "csv" or "xlsx"; Layout is "hierarchical" (one row per level) or "flat" (one row per ad).
+type Export struct {
+	Format string `json:"format"`
+	Layout string `json:"layout"`
+}
+
+type ExportReference struct {
+	Key         string    `json:"key"`
+	URL         string    `json:"url"`
+	Format      string    `json:"format"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ReportSchedule is a recurring insight report defined by a shop.
+// Hour is the local hour to run at, Weekday is used by weekly schedules and MonthDay (1-28) by monthly ones.
+type ReportSchedule struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ShopID       int64              `json:"sid" bson:"shop_id"`
+	ShopName     string             `json:"shop_name" bson:"shop_name"`
+	ShopCurrency string             `json:"cur" bson:"shop_currency"`
+	Platform     string             `json:"platform" bson:"platform"`
+	Accounts     []Account          `json:"acc" bson:"accounts"`
+	Name         string             `json:"name" bson:"name"`
+	Frequency    string             `json:"frequency" bson:"frequency"`
+	Hour         int                `json:"hour" bson:"hour"`
+	Weekday      time.Weekday       `json:"weekday" bson:"weekday"`
+	MonthDay     int                `json:"month_day" bson:"month_day"`
+	Timezone     string             `json:"tz" bson:"timezone"`
+	DatePreset   string             `json:"date_preset" bson:"date_preset"`
+	Recipients   []string           `json:"recipients" bson:"recipients"`
+	Export       Export             `json:"export" bson:"export"`
+	Enabled      bool               `json:"enabled" bson:"enabled"`
+	NextRunAt    time.Time          `json:"next_run_at" bson:"next_run_at"`
+	LastRunAt    time.Time          `json:"last_run_at,omitempty" bson:"last_run_at,omitempty"`
+}
+
+// DailyMetric is one entity's (campaign or ad) totals for a single day.
+type DailyMetric struct {
+	EntityID       string    `json:"entity_id" bson:"entity_id"`
+	EntityName     string    `json:"entity_name" bson:"entity_name"`
+	CampaignID     string    `json:"campaign_id" bson:"campaign_id"`
+	AccountID      string    `json:"account_id" bson:"account_id"`
+	Date           time.Time `json:"date" bson:"date"`
+	Spend          float64   `json:"spend" bson:"spend"`
+	Clicks         int64     `json:"clicks" bson:"clicks"`
+	Impressions    int64     `json:"impressions" bson:"impressions"`
+	Purchases      float64   `json:"purchases" bson:"purchases"`
+	PurchasesValue float64   `json:"purchases_value" bson:"purchases_value"`
+}
+
+type Anomaly struct {
+	Level      string    `json:"level"`
+	EntityID   string    `json:"entity_id"`
+	EntityName string    `json:"entity_name"`
+	CampaignID string    `json:"campaign_id,omitempty"`
+	AccountID  string    `json:"account_id"`
+	Date       time.Time `json:"date"`
+	Kind       string    `json:"kind"`
+	Metric     string    `json:"metric"`
+	Value      float64   `json:"value"`
+	Median     float64   `json:"median"`
+	MAD        float64   `json:"mad"`
+	Score      float64   `json:"score"`
+	Severity   string    `json:"severity"`
+}
+
+// Budget is a monthly spend target for an account or a campaign. An empty Month applies to every month,
+// otherwise it is the "2006-01" month the amount is set for.
+type Budget struct {
+	ID       primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ShopID   int64              `json:"sid" bson:"shop_id"`
+	Level    string             `json:"level" bson:"level"`
+	EntityID string             `json:"entity_id" bson:"entity_id"`
+	Month    string             `json:"month,omitempty" bson:"month,omitempty"`
+	Amount   float64            `json:"amount" bson:"amount"`
+}
+
+type BudgetPacing struct {
+	Level          string    `json:"level"`
+	EntityID       string    `json:"entity_id"`
+	EntityName     string    `json:"entity_name"`
+	Month          string    `json:"month"`
+	AsOf           time.Time `json:"as_of"`
+	Budget         float64   `json:"budget"`
+	MonthToDate    float64   `json:"month_to_date"`
+	Projected      float64   `json:"projected"`
+	ExpectedToDate float64   `json:"expected_to_date"`
+	PacingRatio    float64   `json:"pacing_ratio"`
+	Status         string    `json:"status"`
+}
+
+// AlertRule fires when every condition holds for an entity of the rule's level over the last LookbackDays.
+type AlertRule struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ShopID        int64              `json:"sid" bson:"shop_id"`
+	Name          string             `json:"name" bson:"name"`
+	Level         string             `json:"level" bson:"level"`
+	Conditions    []RuleCondition    `json:"conditions" bson:"conditions"`
+	LookbackDays  int                `json:"lookback_days" bson:"lookback_days"`
+	Action        string             `json:"action" bson:"action"`
+	CooldownHours int                `json:"cooldown_hours" bson:"cooldown_hours"`
+	Enabled       bool               `json:"enabled" bson:"enabled"`
+}
+
+// RuleCondition compares a metric, named as in the insight response (e.g. "cost_per_purchase"), to a value.
+type RuleCondition struct {
+	Metric   string  `json:"metric" bson:"metric"`
+	Operator string  `json:"op" bson:"op"`
+	Value    float64 `json:"value" bson:"value"`
+}
+
+type RuleFiring struct {
+	RuleID     string             `json:"rule_id"`
+	RuleName   string             `json:"rule_name"`
+	Action     string             `json:"action"`
+	Level      string             `json:"level"`
+	EntityID   string             `json:"entity_id"`
+	EntityName string             `json:"entity_name"`
+	AccountID  string             `json:"account_id"`
+	CampaignID string             `json:"campaign_id,omitempty"`
+	Since      time.Time          `json:"since"`
+	Until      time.Time          `json:"until"`
+	Values     map[string]float64 `json:"values"`
+}
+
+// StoreOrder is an order from the shop's store with the tracking it arrived with.
+// AdID and CampaignID are set when an upstream system already resolved the click.
+type StoreOrder struct {
+	OrderID     string    `json:"order_id" bson:"order_id"`
+	ShopID      int64     `json:"sid" bson:"shop_id"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+	TotalPrice  float64   `json:"total_price" bson:"total_price"`
+	UtmSource   string    `json:"utm_source" bson:"utm_source"`
+	UtmMedium   string    `json:"utm_medium" bson:"utm_medium"`
+	UtmCampaign string    `json:"utm_campaign" bson:"utm_campaign"`
+	UtmContent  string    `json:"utm_content" bson:"utm_content"`
+	UtmTerm     string    `json:"utm_term" bson:"utm_term"`
+	ClickID     string    `json:"click_id" bson:"click_id"`
+	AdID        string    `json:"ad_id" bson:"ad_id"`
+	CampaignID  string    `json:"campaign_id" bson:"campaign_id"`
+}
+
+// Reconciliation compares the platform's purchases with the store orders that came from it.
+type Reconciliation struct {
+	PlatformPurchases float64  `json:"platform_purchases"`
+	PlatformRevenue   float64  `json:"platform_revenue"`
+	Orders            int      `json:"orders"`
+	Revenue           float64  `json:"revenue"`
+	MatchedOrders     int      `json:"matched_orders"`
+	MatchedRevenue    float64  `json:"matched_revenue"`
+	UnmatchedOrders   int      `json:"unmatched_orders"`
+	UnmatchedRevenue  float64  `json:"unmatched_revenue"`
+	UnmatchedOrderIDs []string `json:"unmatched_order_ids,omitempty"`
+}
+
+// InsightResponseVersion is the version of the InsightResponse shape, carried in its v field.
+const InsightResponseVersion = 1
+
+// InsightResponse is the body of every insight result: the insight tree with the response level extras, a
+// reconciliation the request asked for and the cache status when result caching is enabled.
+type InsightResponse struct {
+	Version        int              `json:"v"`
+	Accounts       []AccountInsight `json:"accounts"`
+	Reconciliation *Reconciliation  `json:"reconciliation,omitempty"`
+	Cache          *CacheInfo       `json:"cache,omitempty"`
+}
+
+type CacheInfo struct {
+	Hit      bool      `json:"hit"`
+	CachedAt time.Time `json:"cached_at"`
+	Age      float64   `json:"age_seconds"`
+}
+
+// AdTracking is an ad's tracking setup with its spend over the requested days.
+type AdTracking struct {
+	AdID            string  `json:"ad_id" bson:"ad_id"`
+	AdName          string  `json:"ad_name" bson:"ad_name"`
+	AdStatus        string  `json:"ad_status" bson:"ad_status"`
+	CampaignID      string  `json:"campaign_id" bson:"campaign_id"`
+	CampaignName    string  `json:"campaign_name" bson:"campaign_name"`
+	AccountID       string  `json:"account_id" bson:"account_id"`
+	DestinationURL  string  `json:"destination_url" bson:"destination_url"`
+	ValidParameters bool    `json:"valid_parameters" bson:"valid_parameters"`
+	Spend           float64 `json:"spend" bson:"spend"`
+}
+
+type UtmAuditAd struct {
+	AdID           string   `json:"ad_id"`
+	AdName         string   `json:"ad_name"`
+	DestinationURL string   `json:"destination_url,omitempty"`
+	Spend          float64  `json:"spend"`
+	Issues         []string `json:"issues"`
+}
+
+type UtmAuditCampaign struct {
+	CampaignID     string       `json:"campaign_id"`
+	CampaignName   string       `json:"campaign_name"`
+	AccountID      string       `json:"account_id"`
+	Spend          float64      `json:"spend"`
+	UntrackedSpend float64      `json:"untracked_spend"`
+	Ads            []UtmAuditAd `json:"ads"`
+}
+
+type UtmAuditReport struct {
+	Since                 time.Time          `json:"since"`
+	Until                 time.Time          `json:"until"`
+	ActiveAds             int                `json:"active_ads"`
+	UntrackedAds          int                `json:"untracked_ads"`
+	Spend                 float64            `json:"spend"`
+	UntrackedSpend        float64            `json:"untracked_spend"`
+	UntrackedSpendPercent float64            `json:"untracked_spend_percent"`
+	Campaigns             []UtmAuditCampaign `json:"campaigns"`
+}
+
+// IngestBatch is a set of per day ad performance rows pushed by a producer. Rows are kept raw so they
+// can be validated and normalized one by one.
+type IngestBatch struct {
+	ShopID   int64                    `json:"sid"`
+	Platform string                   `json:"platform"`
+	Rows     []map[string]interface{} `json:"rows"`
+}
+
+// AdRow is the normalized document stored in the shop collection, one per ad and day.
+type AdRow struct {
+	Date             time.Time `json:"date" bson:"date"`
+	AdID             string    `json:"ad_id" bson:"ad_id"`
+	AdName           string    `json:"ad_name" bson:"ad_name"`
+	AdStatus         string    `json:"ad_status" bson:"ad_status"`
+	AdSetID          string    `json:"adset_id" bson:"adset_id"`
+	AdSetName        string    `json:"adset_name" bson:"adset_name"`
+	AdSetStatus      string    `json:"adset_status" bson:"adset_status"`
+	CampaignID       string    `json:"campaign_id" bson:"campaign_id"`
+	CampaignName     string    `json:"campaign_name" bson:"campaign_name"`
+	CampaignStatus   string    `json:"campaign_status" bson:"campaign_status"`
+	AdAccountID      string    `json:"ad_account_id" bson:"ad_account_id"`
+	AdAccountName    string    `json:"ad_account_name" bson:"ad_account_name"`
+	Platform         string    `json:"platform" bson:"platform"`
+	Clicks           int64     `json:"clicks" bson:"clicks"`
+	Impressions      int64     `json:"impressions" bson:"impressions"`
+	Spend            float64   `json:"spend" bson:"spend"`
+	AddToCart        float64   `json:"add_to_cart" bson:"add_to_cart"`
+	Purchases        float64   `json:"purchases" bson:"purchases"`
+	PurchasesValue   float64   `json:"purchases_value" bson:"purchases_value"`
+	AssistedPurchase float64   `json:"assisted_purchase" bson:"assisted_purchase"`
+	DirectPurchase   float64   `json:"direct_purchase" bson:"direct_purchase"`
+	ValidParameters  bool      `json:"valid_parameters" bson:"valid_parameters"`
+	DestinationURL   string    `json:"destination_url,omitempty" bson:"destination_url,omitempty"`
+	UpdatedAt        time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+type RowError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+type IngestResult struct {
+	Received int        `json:"received"`
+	Upserted int64      `json:"upserted"`
+	Modified int64      `json:"modified"`
+	Rejected []RowError `json:"rejected,omitempty"`
+}
+
+// ShopPlan holds a shop's plan and how far its raw data has been archived. RetentionMonths overrides the
+// plan's default when set.
+type ShopPlan struct {
+	ShopID          int64     `json:"sid" bson:"shop_id"`
+	Plan            string    `json:"plan" bson:"plan"`
+	RetentionMonths int       `json:"retention_months,omitempty" bson:"retention_months,omitempty"`
+	ArchiveMode     string    `json:"archive_mode,omitempty" bson:"archive_mode,omitempty"`
+	ArchivedBefore  time.Time `json:"archived_before,omitempty" bson:"archived_before,omitempty"`
+}
@@ -2,96 +2,137 @@ package repository
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"github.com/minhlong/go-aws-boilerplate/pkg/failure"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"go.uber.org/zap"
 	"os"
+	"time"
 )
 
-var mongoClient *mongo.Client
-
 type MongodbRepository struct {
-	Database       *mongo.Database
-	CollectionName *mongo.Collection
+	database       *mongo.Database
+	CollectionName *TenantCollection
+	Rollup         *TenantCollection
+	RollupCoverage *TenantCollection
+	UseRollups     bool
+	Diagnostics    bool
+	ShopID         int64
 }
 
-func getMongoClient(ctx context.Context, connectionUri string) (_ *mongo.Client, err error) {
-	if mongoClient != nil {
-		if err := mongoClient.Ping(ctx, readpref.Primary()); err == nil {
-			return mongoClient, nil
-		}
-		mongoClient.Disconnect(ctx)
-	}
+func getMongoClient(ctx context.Context, connectionUri string) (*mongo.Client, error) {
+	return connections.get(ctx, connectionUri)
+}
 
-	appName := os.Getenv("AWS_REGION") + ":" + os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
-	clientOptions := options.Client().ApplyURI(connectionUri).SetAppName(appName)
+func getDatabase(ctx context.Context) (*mongo.Database, error) {
+	databaseName, ok := os.LookupEnv("DB_NAME")
+	if !ok {
+		err := failure.Permanentf("DB_NAME is missing")
 
-	mongoClient, err = mongo.NewClient(clientOptions)
-	if err != nil {
 		return nil, err
 	}
+	connectionURI, ok := os.LookupEnv("DB_URI")
+	if !ok {
+		err := failure.Permanentf("DB_URI is missing")
 
-	if err := mongoClient.Connect(ctx); err != nil {
 		return nil, err
 	}
-
-	if err := mongoClient.Ping(ctx, readpref.Primary()); err != nil {
-		return nil, err
+	mongoClient, err := getMongoClient(ctx, connectionURI)
+	if err != nil {
+		return nil, classify(err, "can not connect to mongo")
 	}
 
-	return mongoClient, nil
+	return mongoClient.Database(databaseName), nil
 }
 
 func NewMongoDb(ctx context.Context, shopID int64) (*MongodbRepository, error) {
-	databaseName, ok := os.LookupEnv("DB_NAME")
-	if !ok {
-		err := errors.New("DB_NAME is missing")
-
-		return nil, err
+	layout := os.Getenv("STORAGE_LAYOUT")
+	if layout == "" {
+		layout = LayoutPerShop
 	}
-	connectionURI, ok := os.LookupEnv("DB_URI")
-	if !ok {
-		err := errors.New("DB_URI is missing")
 
-		return nil, err
-	}
-	mongoClient, err := getMongoClient(ctx, connectionURI)
+	return NewMongoDbWithLayout(ctx, shopID, layout)
+}
+
+func NewMongoDbWithLayout(ctx context.Context, shopID int64, layout string) (*MongodbRepository, error) {
+	database, err := getDatabase(ctx)
 	if err != nil {
 		return nil, err
 	}
-	database := mongoClient.Database(databaseName)
-	tmpName := database.Collection(fmt.Sprintf("acction_%d", shopID))
+
+	var tmpName, rollup, coverage *TenantCollection
+	switch layout {
+	case LayoutPerShop:
+		tmpName = newTenantCollection(database.Collection(fmt.Sprintf("acction_%d", shopID)), shopID, false)
+		rollup = newTenantCollection(database.Collection(fmt.Sprintf("rollup_%d", shopID)), shopID, false)
+		coverage = newTenantCollection(database.Collection(fmt.Sprintf("rollup_coverage_%d", shopID)), shopID, false)
+	case LayoutShared:
+		tmpName = newTenantCollection(database.Collection(sharedRawCollection), shopID, true)
+		rollup = newTenantCollection(database.Collection(sharedRollupCollection), shopID, true)
+		coverage = newTenantCollection(database.Collection(sharedCoverageCollection), shopID, true)
+	default:
+		return nil, failure.Permanentf("unknown storage layout %s", layout)
+	}
 
 	repo := &MongodbRepository{
-		Database:       database,
+		database:       database,
 		CollectionName: tmpName,
+		Rollup:         rollup,
+		RollupCoverage: coverage,
+		UseRollups:     os.Getenv("INSIGHT_ROLLUPS") == "true",
+		Diagnostics:    os.Getenv("INSIGHT_DIAGNOSTICS") == "true",
+		ShopID:         shopID,
 	}
+	repo.ensureIndexesOnFirstUse()
 
 	return repo, nil
 }
 
-func (m *MongodbRepository) Disconnect(ctx context.Context) {
-	if mongoClient != nil {
-		mongoClient.Disconnect(ctx)
+// Disconnect releases the repository. The client is shared by the whole process and stays connected for the
+// next invocation, CloseConnections shuts it down.
+func (m *MongodbRepository) Disconnect(ctx context.Context) {}
+
+func (m *MongodbRepository) Insights(ctx context.Context, input RequestInput) ([]AccountInsight, error) {
+	since, until := input.DateRange()
+	collection, pipeLine, err := m.insightSource(ctx, since, until)
+	if err != nil {
+		return nil, classify(err, "can not load rollup coverage")
+	}
+	if collection == m.CollectionName {
+		archives, err := m.archiveStages(ctx, since, until)
+		if err != nil {
+			return nil, classify(err, "can not list archives")
+		}
+		pipeLine = append(pipeLine, archives...)
+	}
+	pipeLine = append(pipeLine, insightStages()...)
+
+	logging.L(ctx).Debug("insight pipeline", zap.Any("pipeLine", pipeLine))
+
+	var AccountInsights []AccountInsight
+	if err = m.aggregate(ctx, collection, pipeLine, &AccountInsights); err != nil {
+		return nil, classify(err, "can not aggregate insights")
 	}
+
+	return AccountInsights, nil
 }
 
-func (m *MongodbRepository) Insights(ctx context.Context, input RequestInput) ([]Account, error) {
-	match := bson.M{
-		"date": bson.M{
-			"$gte": input.StartSyncTime,
-			"$lte": input.StartSyncTime,
+func dateMatch(since time.Time, until time.Time) bson.M {
+	return bson.M{
+		"$match": bson.M{
+			"date": bson.M{
+				"$gte": since,
+				"$lte": until,
+			},
 		},
 	}
+}
 
-	pipeLine := []bson.M{
-		{
-			"$match": match,
-		},
+// insightStages groups matched per ad and day documents into the account, campaign, ad group and ad tree.
+func insightStages() []bson.M {
+	return []bson.M{
 		{
 			"$addFields": bson.M{
 				"purchases": bson.M{
@@ -102,10 +143,9 @@ func (m *MongodbRepository) Insights(ctx context.Context, input RequestInput) ([
 					},
 				},
 				"purchases_value": bson.M{
-					"$ifNull": bson.A{
-						"$purchases_value",
-						bson.M{
-							"$toDecimal": 0,
+					"$toDouble": bson.M{
+						"$ifNull": bson.A{
+							"$purchases_value", 0,
 						},
 					},
 				},
@@ -176,8 +216,8 @@ func (m *MongodbRepository) Insights(ctx context.Context, input RequestInput) ([
 		{
 			"$group": bson.M{
 				"_id": bson.D{
-					{"ad_group_id", "$ad_group_id"},
-					{"campaign_id", "$campaign_id"},
+					{Key: "ad_group_id", Value: "$ad_group_id"},
+					{Key: "campaign_id", Value: "$campaign_id"},
 				},
 				"ads": bson.M{"$push": bson.M{
 					"ad_id":           "$ad_id",
@@ -302,7 +342,7 @@ func (m *MongodbRepository) Insights(ctx context.Context, input RequestInput) ([
 						"roas": bson.M{
 							"$cond": bson.M{
 								"if":   bson.M{"$gt": bson.A{"$spend", 0}},
-								"then": bson.M{"$toDouble": bson.M{"$divide": bson.A{"$purchases", "$spend"}}},
+								"then": bson.M{"$toDouble": bson.M{"$divide": bson.A{"$purchases_value", "$spend"}}},
 								"else": bson.M{"$toDouble": 0},
 							},
 						},
@@ -438,18 +478,4 @@ func (m *MongodbRepository) Insights(ctx context.Context, input RequestInput) ([
 			},
 		},
 	}
-
-	zap.L().Info("pipeLine", zap.Any("pipeLine", pipeLine))
-
-	result, err := m.CollectionName.Aggregate(ctx, pipeLine)
-	if err != nil {
-		return nil, err
-	}
-
-	var AccountInsights []Account
-	if err = result.All(ctx, &AccountInsights); err != nil {
-		return nil, err
-	}
-
-	return AccountInsights, nil
 }
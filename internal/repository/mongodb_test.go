@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"testing"
+)
+
+func TestInsightStagesRoas(t *testing.T) {
+	want := bson.M{
+		"$cond": bson.M{
+			"if":   bson.M{"$gt": bson.A{"$spend", 0}},
+			"then": bson.M{"$toDouble": bson.M{"$divide": bson.A{"$purchases_value", "$spend"}}},
+			"else": bson.M{"$toDouble": 0},
+		},
+	}
+
+	var found int
+	var walk func(node interface{}, path string)
+	walk = func(node interface{}, path string) {
+		switch value := node.(type) {
+		case bson.M:
+			for key, child := range value {
+				if key == "roas" {
+					found++
+					if !reflect.DeepEqual(child, want) {
+						t.Errorf("roas under %s = %v, want purchases value over spend", path, child)
+					}
+					continue
+				}
+				walk(child, path+"."+key)
+			}
+		case []bson.M:
+			for _, child := range value {
+				walk(child, path)
+			}
+		case bson.A:
+			for _, child := range value {
+				walk(child, path)
+			}
+		}
+	}
+	walk(insightStages(), "pipeline")
+
+	// ad, ad group, campaign and account
+	if found < 4 {
+		t.Errorf("found %d roas expressions, want one per level", found)
+	}
+}
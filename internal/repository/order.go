@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"time"
+)
+
+const orderCollection = "orders"
+
+// Orders returns the shop's orders created on the days between since and until, that carry any tracking.
+func (m *MongodbRepository) Orders(ctx context.Context, since time.Time, until time.Time) ([]StoreOrder, error) {
+	var orders []StoreOrder
+	err := withRetry(ctx, func() error {
+		cursor, errF := m.database.Collection(orderCollection).Find(ctx, bson.M{
+			"shop_id": m.ShopID,
+			"created_at": bson.M{
+				"$gte": since,
+				"$lt":  until.AddDate(0, 0, 1),
+			},
+			"$or": bson.A{
+				bson.M{"utm_source": bson.M{"$nin": bson.A{nil, ""}}},
+				bson.M{"click_id": bson.M{"$nin": bson.A{nil, ""}}},
+				bson.M{"ad_id": bson.M{"$nin": bson.A{nil, ""}}},
+			},
+		})
+		if errF != nil {
+			return errF
+		}
+
+		return cursor.All(ctx, &orders)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
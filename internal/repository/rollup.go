@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"time"
+)
+
+// RefreshRollup recomputes the per ad and day summaries for the days between since and until from the raw
+// documents and merges them into the shop's rollup collection. Summaries keep the raw field names so the
+// insight stages read both the same way. The days are then marked as covered by the rollups as of the start of
+// the refresh, so rows written while it runs leave them stale.
+func (m *MongodbRepository) RefreshRollup(ctx context.Context, since time.Time, until time.Time) error {
+	rolledAt := time.Now().UTC()
+	pipeLine := []bson.M{
+		dateMatch(since, until),
+		{
+			"$group": bson.M{
+				// shop_id is only set in the shared layout, where it keeps shops apart in the shared rollup
+				"_id": bson.D{
+					{Key: "shop_id", Value: "$shop_id"},
+					{Key: "ad_id", Value: "$ad_id"},
+					{Key: "date", Value: "$date"},
+				},
+				"shop_id":          bson.M{"$first": "$shop_id"},
+				"ad_id":            bson.M{"$first": "$ad_id"},
+				"date":             bson.M{"$first": "$date"},
+				"ad_name":          bson.M{"$last": "$ad_name"},
+				"ad_status":        bson.M{"$last": "$ad_status"},
+				"adset_id":         bson.M{"$last": "$adset_id"},
+				"adset_name":       bson.M{"$last": "$adset_name"},
+				"adset_status":     bson.M{"$last": "$adset_status"},
+				"campaign_id":      bson.M{"$last": "$campaign_id"},
+				"campaign_name":    bson.M{"$last": "$campaign_name"},
+				"campaign_status":  bson.M{"$last": "$campaign_status"},
+				"ad_account_id":    bson.M{"$last": "$ad_account_id"},
+				"ad_account_name":  bson.M{"$last": "$ad_account_name"},
+				"valid_parameters": bson.M{"$last": "$valid_parameters"},
+				"destination_url":  bson.M{"$last": "$destination_url"},
+				"clicks":           bson.M{"$sum": "$clicks"},
+				"impressions":      bson.M{"$sum": "$impressions"},
+				"spend":            bson.M{"$sum": "$spend"},
+				"add_to_cart": bson.M{"$sum": bson.M{
+					"$ifNull": bson.A{bson.M{"$toDouble": "$add_to_cart"}, 0},
+				}},
+				"purchases": bson.M{"$sum": bson.M{
+					"$ifNull": bson.A{bson.M{"$toDouble": "$purchases"}, 0},
+				}},
+				"purchases_value": bson.M{"$sum": bson.M{
+					"$toDouble": bson.M{"$ifNull": bson.A{"$purchases_value", 0}},
+				}},
+				"assisted_purchase": bson.M{"$sum": "$assisted_purchase"},
+				"direct_purchase":   bson.M{"$sum": "$direct_purchase"},
+			},
+		},
+		{
+			"$set": bson.M{"rolled_at": "$$NOW"},
+		},
+		{
+			"$merge": bson.M{
+				"into":           m.Rollup.Name(),
+				"on":             "_id",
+				"whenMatched":    "replace",
+				"whenNotMatched": "insert",
+			},
+		},
+	}
+
+	if err := m.aggregate(ctx, m.CollectionName, pipeLine, nil); err != nil {
+		return err
+	}
+
+	return m.markRolled(ctx, since, until, rolledAt)
+}
+
+// insightSource picks the collection and leading stages Insights reads from. Whole days before today whose
+// rollups are current come from the rollups; the other days, and today, still filling up, are unioned in from
+// the raw documents. Without any current rollup day the range is read raw.
+func (m *MongodbRepository) insightSource(ctx context.Context, since time.Time, until time.Time) (*TenantCollection, []bson.M, error) {
+	raw := []bson.M{dateMatch(since, until)}
+	if !m.UseRollups || !isWholeDay(since) || !isWholeDay(until) {
+		return m.CollectionName, raw, nil
+	}
+
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if !since.Before(today) {
+		return m.CollectionName, raw, nil
+	}
+	last := until
+	if !last.Before(today) {
+		last = today.AddDate(0, 0, -1)
+	}
+
+	coverage, err := m.rollupCoverage(ctx, since, last)
+	if err != nil {
+		return nil, nil, err
+	}
+	covered, uncovered := splitCoverage(coverage, since, last, now)
+	if len(covered) == 0 {
+		return m.CollectionName, raw, nil
+	}
+
+	return m.Rollup, rollupStages(m.CollectionName.Name(), covered, uncovered, today, until), nil
+}
+
+// rollupStages match the covered days in the rollups and union the uncovered days and any days from today on
+// from the raw collection.
+func rollupStages(rawCollection string, covered []time.Time, uncovered []time.Time, today time.Time, until time.Time) []bson.M {
+	stages := []bson.M{
+		{"$match": bson.M{"date": bson.M{"$in": covered}}},
+	}
+
+	var rawMatches bson.A
+	if len(uncovered) > 0 {
+		rawMatches = append(rawMatches, bson.M{"date": bson.M{"$in": uncovered}})
+	}
+	if !until.Before(today) {
+		rawMatches = append(rawMatches, bson.M{"date": bson.M{"$gte": today, "$lte": until}})
+	}
+	if len(rawMatches) == 0 {
+		return stages
+	}
+
+	match := bson.M{"$match": rawMatches[0]}
+	if len(rawMatches) > 1 {
+		match = bson.M{"$match": bson.M{"$or": rawMatches}}
+	}
+
+	return append(stages, bson.M{
+		"$unionWith": bson.M{
+			"coll":     rawCollection,
+			"pipeline": bson.A{match},
+		},
+	})
+}
+
+func isWholeDay(t time.Time) bool {
+	t = t.UTC()
+
+	return t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0
+}
@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitCoverage(t *testing.T) {
+	now := time.Date(2024, 4, 10, 12, 0, 0, 0, time.UTC)
+	day := func(d int) time.Time {
+		return time.Date(2024, 4, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name      string
+		coverage  map[time.Time]rollupDay
+		covered   []time.Time
+		uncovered []time.Time
+	}{
+		{
+			name:      "never rolled up",
+			uncovered: []time.Time{day(1), day(2)},
+		},
+		{
+			name: "rolled up after the last write",
+			coverage: map[time.Time]rollupDay{
+				day(1): {RolledAt: day(3), WrittenAt: day(2)},
+				day(2): {RolledAt: day(3)},
+			},
+			covered: []time.Time{day(1), day(2)},
+		},
+		{
+			name: "written after the last roll up",
+			coverage: map[time.Time]rollupDay{
+				day(1): {RolledAt: day(3), WrittenAt: day(4)},
+				day(2): {RolledAt: day(3)},
+			},
+			covered:   []time.Time{day(2)},
+			uncovered: []time.Time{day(1)},
+		},
+		{
+			name: "only written, never rolled up",
+			coverage: map[time.Time]rollupDay{
+				day(1): {WrittenAt: day(2)},
+				day(2): {RolledAt: day(3)},
+			},
+			covered:   []time.Time{day(2)},
+			uncovered: []time.Time{day(1)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			covered, uncovered := splitCoverage(test.coverage, day(1), day(2), now)
+			if !reflect.DeepEqual(covered, test.covered) || !reflect.DeepEqual(uncovered, test.uncovered) {
+				t.Errorf("splitCoverage() = %v, %v, want %v, %v", covered, uncovered, test.covered, test.uncovered)
+			}
+		})
+	}
+}
+
+func TestSplitCoverageRecentDays(t *testing.T) {
+	now := time.Date(2024, 4, 10, 12, 0, 0, 0, time.UTC)
+	coverage := map[time.Time]rollupDay{
+		// Rolled up a day ago: old days keep it, recent days need a newer roll up
+		time.Date(2024, 4, 6, 0, 0, 0, 0, time.UTC): {RolledAt: now.Add(-24 * time.Hour)},
+		time.Date(2024, 4, 7, 0, 0, 0, 0, time.UTC): {RolledAt: now.Add(-24 * time.Hour)},
+		time.Date(2024, 4, 8, 0, 0, 0, 0, time.UTC): {RolledAt: now.Add(-time.Hour)},
+	}
+
+	covered, uncovered := splitCoverage(coverage, time.Date(2024, 4, 6, 0, 0, 0, 0, time.UTC), time.Date(2024, 4, 8, 0, 0, 0, 0, time.UTC), now)
+
+	wantCovered := []time.Time{time.Date(2024, 4, 6, 0, 0, 0, 0, time.UTC), time.Date(2024, 4, 8, 0, 0, 0, 0, time.UTC)}
+	wantUncovered := []time.Time{time.Date(2024, 4, 7, 0, 0, 0, 0, time.UTC)}
+	if !reflect.DeepEqual(covered, wantCovered) || !reflect.DeepEqual(uncovered, wantUncovered) {
+		t.Errorf("splitCoverage() = %v, %v, want %v, %v", covered, uncovered, wantCovered, wantUncovered)
+	}
+}
+
+func TestDaysBetween(t *testing.T) {
+	tests := []struct {
+		name  string
+		since time.Time
+		until time.Time
+		want  int
+	}{
+		{name: "one day", since: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), until: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), want: 1},
+		{name: "month", since: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), until: time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC), want: 30},
+		{name: "partial first day is left out", since: time.Date(2024, 4, 1, 6, 0, 0, 0, time.UTC), until: time.Date(2024, 4, 3, 23, 0, 0, 0, time.UTC), want: 2},
+		{name: "empty", since: time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC), until: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), want: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := daysBetween(test.since, test.until); len(got) != test.want {
+				t.Errorf("daysBetween() = %v, want %d days", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRollupStages(t *testing.T) {
+	today := time.Date(2024, 4, 10, 0, 0, 0, 0, time.UTC)
+	covered := []time.Time{time.Date(2024, 4, 8, 0, 0, 0, 0, time.UTC)}
+	uncovered := []time.Time{time.Date(2024, 4, 9, 0, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		name      string
+		uncovered []time.Time
+		until     time.Time
+		rawMatch  bson.M
+	}{
+		{
+			name:  "all covered before today",
+			until: time.Date(2024, 4, 8, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "uncovered day",
+			uncovered: uncovered,
+			until:     time.Date(2024, 4, 9, 0, 0, 0, 0, time.UTC),
+			rawMatch:  bson.M{"date": bson.M{"$in": uncovered}},
+		},
+		{
+			name:     "today",
+			until:    today,
+			rawMatch: bson.M{"date": bson.M{"$gte": today, "$lte": today}},
+		},
+		{
+			name:      "uncovered day and today",
+			uncovered: uncovered,
+			until:     today,
+			rawMatch: bson.M{"$or": bson.A{
+				bson.M{"date": bson.M{"$in": uncovered}},
+				bson.M{"date": bson.M{"$gte": today, "$lte": today}},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stages := rollupStages("acction_1", covered, test.uncovered, today, test.until)
+
+			if want := (bson.M{"$match": bson.M{"date": bson.M{"$in": covered}}}); !reflect.DeepEqual(stages[0], want) {
+				t.Errorf("first stage = %v, want %v", stages[0], want)
+			}
+			if test.rawMatch == nil {
+				if len(stages) != 1 {
+					t.Errorf("stages = %v, want the rollup match only", stages)
+				}
+				return
+			}
+			if len(stages) != 2 {
+				t.Fatalf("stages = %v, want a raw union", stages)
+			}
+			want := bson.M{"$unionWith": bson.M{"coll": "acction_1", "pipeline": bson.A{bson.M{"$match": test.rawMatch}}}}
+			if !reflect.DeepEqual(stages[1], want) {
+				t.Errorf("union = %v, want %v", stages[1], want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const (
+	ruleCollection   = "alert_rules"
+	firingCollection = "alert_firings"
+)
+
+type RuleRepository struct {
+	Rules   *mongo.Collection
+	Firings *mongo.Collection
+}
+
+func NewRuleRepository(ctx context.Context) (*RuleRepository, error) {
+	database, err := getDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RuleRepository{
+		Rules:   database.Collection(ruleCollection),
+		Firings: database.Collection(firingCollection),
+	}, nil
+}
+
+func (r *RuleRepository) Save(ctx context.Context, rule *AlertRule) error {
+	if rule.ID.IsZero() {
+		rule.ID = primitive.NewObjectID()
+	}
+
+	return withRetry(ctx, func() error {
+		_, errW := r.Rules.ReplaceOne(ctx, bson.M{"_id": rule.ID}, rule, options.Replace().SetUpsert(true))
+		return errW
+	})
+}
+
+func (r *RuleRepository) Delete(ctx context.Context, shopID int64, id primitive.ObjectID) error {
+	return withRetry(ctx, func() error {
+		_, errW := r.Rules.DeleteOne(ctx, bson.M{"_id": id, "shop_id": shopID})
+		return errW
+	})
+}
+
+func (r *RuleRepository) Enabled(ctx context.Context, shopID int64) ([]AlertRule, error) {
+	var rules []AlertRule
+	err := withRetry(ctx, func() error {
+		cursor, errF := r.Rules.Find(ctx, bson.M{"shop_id": shopID, "enabled": true})
+		if errF != nil {
+			return errF
+		}
+
+		return cursor.All(ctx, &rules)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// ClaimFiring records that a rule fired for an entity. It returns false while the previous firing of the same
+// rule and entity is still inside the cooldown, so repeated jobs do not notify twice.
+func (r *RuleRepository) ClaimFiring(ctx context.Context, ruleID primitive.ObjectID, entityID string, now time.Time, cooldown time.Duration) (bool, error) {
+	key := ruleID.Hex() + ":" + entityID
+
+	var result *mongo.UpdateResult
+	err := withRetry(ctx, func() error {
+		var errW error
+		result, errW = r.Firings.UpdateOne(ctx, bson.M{
+			"_id":      key,
+			"fired_at": bson.M{"$lte": now.Add(-cooldown)},
+		}, bson.M{
+			"$set": bson.M{"fired_at": now},
+		})
+		return errW
+	})
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount == 1 {
+		return true, nil
+	}
+
+	err = withRetry(ctx, func() error {
+		_, errW := r.Firings.InsertOne(ctx, bson.M{"_id": key, "fired_at": now})
+		return errW
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ReleaseFiring undoes a claim made at firedAt whose notification could not be sent, so the next job fires again.
+func (r *RuleRepository) ReleaseFiring(ctx context.Context, ruleID primitive.ObjectID, entityID string, firedAt time.Time) error {
+	return withRetry(ctx, func() error {
+		_, errW := r.Firings.DeleteOne(ctx, bson.M{
+			"_id":      ruleID.Hex() + ":" + entityID,
+			"fired_at": firedAt,
+		})
+		return errW
+	})
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const scheduleCollection = "report_schedules"
+
+type ScheduleRepository struct {
+	Collection *mongo.Collection
+}
+
+func NewScheduleRepository(ctx context.Context) (*ScheduleRepository, error) {
+	database, err := getDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ScheduleRepository{
+		Collection: database.Collection(scheduleCollection),
+	}, nil
+}
+
+// ErrScheduleNotFound is returned when a schedule does not exist or belongs to another shop.
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+// Save creates the schedule, or replaces it when it has an id. A shop can only replace its own schedules.
+func (s *ScheduleRepository) Save(ctx context.Context, schedule *ReportSchedule) error {
+	if schedule.ID.IsZero() {
+		schedule.ID = primitive.NewObjectID()
+	}
+
+	err := withRetry(ctx, func() error {
+		_, errW := s.Collection.ReplaceOne(ctx, bson.M{"_id": schedule.ID, "shop_id": schedule.ShopID}, schedule, options.Replace().SetUpsert(true))
+		return errW
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		// The id is taken by a schedule of another shop
+		return ErrScheduleNotFound
+	}
+
+	return err
+}
+
+func (s *ScheduleRepository) Delete(ctx context.Context, shopID int64, id primitive.ObjectID) error {
+	var result *mongo.DeleteResult
+	err := withRetry(ctx, func() error {
+		var errW error
+		result, errW = s.Collection.DeleteOne(ctx, bson.M{"_id": id, "shop_id": shopID})
+		return errW
+	})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrScheduleNotFound
+	}
+
+	return nil
+}
+
+func (s *ScheduleRepository) ListByShop(ctx context.Context, shopID int64) ([]ReportSchedule, error) {
+	var schedules []ReportSchedule
+	err := withRetry(ctx, func() error {
+		cursor, errF := s.Collection.Find(ctx, bson.M{"shop_id": shopID})
+		if errF != nil {
+			return errF
+		}
+
+		return cursor.All(ctx, &schedules)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+func (s *ScheduleRepository) Due(ctx context.Context, now time.Time) ([]ReportSchedule, error) {
+	var schedules []ReportSchedule
+	err := withRetry(ctx, func() error {
+		cursor, errF := s.Collection.Find(ctx, bson.M{
+			"enabled":     true,
+			"next_run_at": bson.M{"$lte": now},
+		})
+		if errF != nil {
+			return errF
+		}
+
+		return cursor.All(ctx, &schedules)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+// Claim moves a due schedule to its next run. It only succeeds for the caller that still sees the previous
+// next_run_at, so overlapping scheduler invocations never enqueue the same run twice.
+func (s *ScheduleRepository) Claim(ctx context.Context, schedule ReportSchedule, ranAt time.Time, nextRunAt time.Time) (bool, error) {
+	var result *mongo.UpdateResult
+	err := withRetry(ctx, func() error {
+		var errW error
+		result, errW = s.Collection.UpdateOne(ctx, bson.M{
+			"_id":         schedule.ID,
+			"next_run_at": schedule.NextRunAt,
+		}, bson.M{
+			"$set": bson.M{
+				"last_run_at": ranAt,
+				"next_run_at": nextRunAt,
+			},
+		})
+		return errW
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// Release undoes a claim whose run could not be enqueued, so the next scheduler invocation retries it. It leaves
+// the schedule alone when it was changed since the claim.
+func (s *ScheduleRepository) Release(ctx context.Context, schedule ReportSchedule, nextRunAt time.Time) error {
+	return withRetry(ctx, func() error {
+		_, errW := s.Collection.UpdateOne(ctx, bson.M{
+			"_id":         schedule.ID,
+			"next_run_at": nextRunAt,
+		}, bson.M{
+			"$set": bson.M{
+				"last_run_at": schedule.LastRunAt,
+				"next_run_at": schedule.NextRunAt,
+			},
+		})
+		return errW
+	})
+}
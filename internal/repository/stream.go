@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sync"
+	"time"
+)
+
+const (
+	subscriptionCollection = "live_subscriptions"
+	resumeTokenCollection  = "stream_resume_tokens"
+)
+
+var subscriptionIndexOnce sync.Once
+
+// ChangeEvent is the part of a change stream event the worker reads.
+type ChangeEvent struct {
+	OperationType string `bson:"operationType"`
+	Namespace     struct {
+		Collection string `bson:"coll"`
+	} `bson:"ns"`
+	FullDocument *struct {
+		ShopID int64     `bson:"shop_id"`
+		AdID   string    `bson:"ad_id"`
+		Date   time.Time `bson:"date"`
+	} `bson:"fullDocument"`
+}
+
+type StreamRepository struct {
+	Database *mongo.Database
+}
+
+func NewStreamRepository(ctx context.Context) (*StreamRepository, error) {
+	database, err := getDatabase(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StreamRepository{Database: database}, nil
+}
+
+// WatchShopData opens a change stream over the raw shop collections of both layouts, resuming after the token
+// when one is given. Rollup, cache and other collections are filtered out on the server.
+func (s *StreamRepository) WatchShopData(ctx context.Context, resumeToken bson.Raw) (*mongo.ChangeStream, error) {
+	pipeLine := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"operationType": bson.M{"$in": bson.A{"insert", "update", "replace"}},
+			"ns.coll":       bson.M{"$regex": "^" + sharedRawCollection + "(_[0-9]+)?$"},
+		}}},
+	}
+
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if resumeToken != nil {
+		opts.SetResumeAfter(resumeToken)
+	}
+
+	var stream *mongo.ChangeStream
+	err := withRetry(ctx, func() error {
+		var errW error
+		stream, errW = s.Database.Watch(ctx, pipeLine, opts)
+		return errW
+	})
+
+	return stream, err
+}
+
+func (s *StreamRepository) LoadResumeToken(ctx context.Context, worker string) (bson.Raw, error) {
+	var state struct {
+		Token bson.Raw `bson:"token"`
+	}
+	err := withRetry(ctx, func() error {
+		return s.Database.Collection(resumeTokenCollection).FindOne(ctx, bson.M{"_id": worker}).Decode(&state)
+	})
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return state.Token, nil
+}
+
+func (s *StreamRepository) SaveResumeToken(ctx context.Context, worker string, token bson.Raw) error {
+	return withRetry(ctx, func() error {
+		_, errW := s.Database.Collection(resumeTokenCollection).UpdateOne(ctx,
+			bson.M{"_id": worker},
+			bson.M{"$set": bson.M{"token": token, "updated_at": time.Now().UTC()}},
+			options.Update().SetUpsert(true),
+		)
+		return errW
+	})
+}
+
+// SubscribedShops returns the shops with a live dashboard subscription that has not expired.
+func (s *StreamRepository) SubscribedShops(ctx context.Context, now time.Time) (map[int64]bool, error) {
+	var subscriptions []struct {
+		ShopID int64 `bson:"_id"`
+	}
+	err := withRetry(ctx, func() error {
+		cursor, errF := s.Database.Collection(subscriptionCollection).Find(ctx, bson.M{"expires_at": bson.M{"$gt": now}})
+		if errF != nil {
+			return errF
+		}
+
+		return cursor.All(ctx, &subscriptions)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	shops := make(map[int64]bool, len(subscriptions))
+	for _, subscription := range subscriptions {
+		shops[subscription.ShopID] = true
+	}
+
+	return shops, nil
+}
+
+// Subscribe keeps live updates flowing to a shop until the subscription expires; dashboards renew it while open.
+func Subscribe(ctx context.Context, database *mongo.Database, shopID int64, until time.Time) error {
+	collection := database.Collection(subscriptionCollection)
+	subscriptionIndexOnce.Do(func() {
+		_, _ = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		})
+	})
+
+	return withRetry(ctx, func() error {
+		_, errW := collection.UpdateOne(ctx,
+			bson.M{"_id": shopID},
+			bson.M{"$max": bson.M{"expires_at": until}},
+			options.Update().SetUpsert(true),
+		)
+		return errW
+	})
+}
+
+func (m *MongodbRepository) Subscribe(ctx context.Context, until time.Time) error {
+	return Subscribe(ctx, m.database, m.ShopID, until)
+}
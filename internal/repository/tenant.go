@@ -0,0 +1,219 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// Storage layouts for shop data, picked with STORAGE_LAYOUT.
+const (
+	// LayoutPerShop keeps one acction_<shopID> and rollup_<shopID> collection per shop.
+	LayoutPerShop = "per_shop"
+	// LayoutShared keeps every shop in the acction and rollup collections, partitioned by shop_id.
+	LayoutShared = "shared"
+
+	sharedRawCollection    = "acction"
+	sharedRollupCollection = "rollup"
+	tenantField            = "shop_id"
+)
+
+// TenantCollection is a shop's view of a collection. In the shared layout every filter, pipeline, write and
+// index is scoped to the shop, so no query built on top of it can read or touch another shop's documents.
+// The underlying collection is not exposed. $merge and $out stages write where they name: a $merge into a
+// shared collection must merge on fields that keep shops apart, see CopyRawTo and RefreshRollup. Every call
+// runs through withRetry.
+type TenantCollection struct {
+	collection *mongo.Collection
+	shopID     int64
+	shared     bool
+}
+
+func newTenantCollection(collection *mongo.Collection, shopID int64, shared bool) *TenantCollection {
+	return &TenantCollection{collection: collection, shopID: shopID, shared: shared}
+}
+
+func (t *TenantCollection) Name() string {
+	return t.collection.Name()
+}
+
+func (t *TenantCollection) Shared() bool {
+	return t.shared
+}
+
+// Filter adds the shop condition to a filter, a copy is returned.
+func (t *TenantCollection) Filter(filter bson.M) bson.M {
+	scoped := bson.M{}
+	for key, value := range filter {
+		scoped[key] = value
+	}
+	if t.shared {
+		scoped[tenantField] = t.shopID
+	}
+
+	return scoped
+}
+
+// Pipeline starts a pipeline with the shop match and scopes the sub pipelines of its $unionWith and $lookup
+// stages, which read other collections of the same layout. A $lookup keeps its localField and foreignField and
+// gets the shop match as its pipeline, which needs MongoDB 5.0.
+func (t *TenantCollection) Pipeline(pipeLine []bson.M) []bson.M {
+	if !t.shared {
+		return pipeLine
+	}
+
+	match := bson.M{"$match": bson.M{tenantField: t.shopID}}
+	scoped := make([]bson.M, 0, len(pipeLine)+1)
+	scoped = append(scoped, match)
+	for _, stage := range pipeLine {
+		scoped = append(scoped, scopeSubPipeline(stage, match))
+	}
+
+	return scoped
+}
+
+// scopeSubPipeline starts the sub pipeline of a $unionWith or $lookup stage with match, other stages are kept.
+func scopeSubPipeline(stage bson.M, match bson.M) bson.M {
+	for _, name := range []string{"$unionWith", "$lookup"} {
+		sub, ok := stage[name].(bson.M)
+		if !ok {
+			continue
+		}
+
+		subPipeline, _ := sub["pipeline"].(bson.A)
+		scopedSub := bson.M{}
+		for key, value := range sub {
+			scopedSub[key] = value
+		}
+		scopedSub["pipeline"] = append(bson.A{match}, subPipeline...)
+
+		return bson.M{name: scopedSub}
+	}
+
+	return stage
+}
+
+// IndexKeys prefixes index keys with the shop so shared indexes stay selective per shop.
+func (t *TenantCollection) IndexKeys(keys bson.D) bson.D {
+	if !t.shared {
+		return keys
+	}
+
+	return append(bson.D{{Key: tenantField, Value: 1}}, keys...)
+}
+
+// WithReadPreference returns the same tenant collection reading with the given preference.
+func (t *TenantCollection) WithReadPreference(pref *readpref.ReadPref) *TenantCollection {
+	collection, err := t.collection.Clone(options.Collection().SetReadPreference(pref))
+	if err != nil {
+		return t
+	}
+
+	return &TenantCollection{collection: collection, shopID: t.shopID, shared: t.shared}
+}
+
+func (t *TenantCollection) Aggregate(ctx context.Context, pipeLine []bson.M) (*mongo.Cursor, error) {
+	var cursor *mongo.Cursor
+	err := withRetry(ctx, func() error {
+		var errA error
+		cursor, errA = t.collection.Aggregate(ctx, t.Pipeline(pipeLine))
+		return errA
+	})
+
+	return cursor, err
+}
+
+func (t *TenantCollection) Find(ctx context.Context, filter bson.M, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	var cursor *mongo.Cursor
+	err := withRetry(ctx, func() error {
+		var errF error
+		cursor, errF = t.collection.Find(ctx, t.Filter(filter), opts...)
+		return errF
+	})
+
+	return cursor, err
+}
+
+func (t *TenantCollection) FindOne(ctx context.Context, filter bson.M, opts ...*options.FindOneOptions) *mongo.SingleResult {
+	var result *mongo.SingleResult
+	err := withRetry(ctx, func() error {
+		result = t.collection.FindOne(ctx, t.Filter(filter), opts...)
+		return result.Err()
+	})
+	// The open circuit breaker refuses the query before it runs
+	if result == nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+
+	return result
+}
+
+func (t *TenantCollection) DeleteMany(ctx context.Context, filter bson.M) (*mongo.DeleteResult, error) {
+	var result *mongo.DeleteResult
+	err := withRetry(ctx, func() error {
+		var errD error
+		result, errD = t.collection.DeleteMany(ctx, t.Filter(filter))
+		return errD
+	})
+
+	return result, err
+}
+
+// UpsertMany applies one update per filter, inserting the document when none matches. Inserted documents get the
+// shop field of the filter in the shared layout.
+func (t *TenantCollection) UpsertMany(ctx context.Context, filters []bson.M, updates []bson.M) (*mongo.BulkWriteResult, error) {
+	models := make([]mongo.WriteModel, 0, len(filters))
+	for i, filter := range filters {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(t.Filter(filter)).
+			SetUpdate(updates[i]).
+			SetUpsert(true))
+	}
+
+	var result *mongo.BulkWriteResult
+	err := withRetry(ctx, func() error {
+		var errW error
+		result, errW = t.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		return errW
+	})
+
+	return result, err
+}
+
+func (t *TenantCollection) CreateIndexes(ctx context.Context, models []mongo.IndexModel) error {
+	scoped := make([]mongo.IndexModel, 0, len(models))
+	for _, model := range models {
+		keys, _ := model.Keys.(bson.D)
+		scoped = append(scoped, mongo.IndexModel{Keys: t.IndexKeys(keys), Options: model.Options})
+	}
+
+	return withRetry(ctx, func() error {
+		_, err := t.collection.Indexes().CreateMany(ctx, scoped)
+		return err
+	})
+}
+
+func (t *TenantCollection) CountDocuments(ctx context.Context, filter bson.M) (int64, error) {
+	var count int64
+	err := withRetry(ctx, func() error {
+		var errC error
+		count, errC = t.collection.CountDocuments(ctx, t.Filter(filter))
+		return errC
+	})
+
+	return count, err
+}
+
+// Drop removes the shop's documents: the whole collection in the per shop layout, the shop's share otherwise.
+func (t *TenantCollection) Drop(ctx context.Context) error {
+	if t.shared {
+		_, err := t.DeleteMany(ctx, bson.M{})
+		return err
+	}
+
+	return withRetry(ctx, func() error {
+		return t.collection.Drop(ctx)
+	})
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testCollection(t *testing.T, name string) *mongo.Collection {
+	// The client is never connected, collections only serve their names
+	client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client.Database("insights").Collection(name)
+}
+
+func TestTenantPipeline(t *testing.T) {
+	shared := newTenantCollection(testCollection(t, sharedRawCollection), 7, true)
+	perShop := newTenantCollection(testCollection(t, "acction_7"), 7, false)
+	match := bson.M{"$match": bson.M{tenantField: int64(7)}}
+	group := bson.M{"$group": bson.M{"_id": "$ad_id"}}
+
+	tests := []struct {
+		name       string
+		collection *TenantCollection
+		pipeLine   []bson.M
+		want       []bson.M
+	}{
+		{
+			name:       "per shop pipelines are kept",
+			collection: perShop,
+			pipeLine:   []bson.M{group},
+			want:       []bson.M{group},
+		},
+		{
+			name:       "shared pipelines start with the shop",
+			collection: shared,
+			pipeLine:   []bson.M{group},
+			want:       []bson.M{match, group},
+		},
+		{
+			name:       "unions are scoped",
+			collection: shared,
+			pipeLine:   []bson.M{{"$unionWith": bson.M{"coll": sharedRollupCollection, "pipeline": bson.A{group}}}},
+			want:       []bson.M{match, {"$unionWith": bson.M{"coll": sharedRollupCollection, "pipeline": bson.A{match, group}}}},
+		},
+		{
+			name:       "lookups are scoped",
+			collection: shared,
+			pipeLine:   []bson.M{{"$lookup": bson.M{"from": sharedRollupCollection, "localField": "ad_id", "foreignField": "ad_id", "as": "rollups"}}},
+			want: []bson.M{match, {"$lookup": bson.M{
+				"from": sharedRollupCollection, "localField": "ad_id", "foreignField": "ad_id", "as": "rollups", "pipeline": bson.A{match},
+			}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.collection.Pipeline(test.pipeLine); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Pipeline() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCopyStages(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  *TenantCollection
+		reshape bson.M
+		on      interface{}
+	}{
+		{
+			name:    "into the shared layout",
+			target:  newTenantCollection(testCollection(t, sharedRawCollection), 7, true),
+			reshape: bson.M{"$set": bson.M{tenantField: int64(7)}},
+			on:      bson.A{tenantField, "_id"},
+		},
+		{
+			name:    "into the per shop layout",
+			target:  newTenantCollection(testCollection(t, "acction_7"), 7, false),
+			reshape: bson.M{"$unset": tenantField},
+			on:      "_id",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stages := copyStages(7, test.target)
+			if !reflect.DeepEqual(stages[0], test.reshape) {
+				t.Errorf("reshape = %v, want %v", stages[0], test.reshape)
+			}
+			merge, _ := stages[1]["$merge"].(bson.M)
+			if merge["into"] != test.target.Name() || !reflect.DeepEqual(merge["on"], test.on) {
+				t.Errorf("merge = %v, want into %s on %v", merge, test.target.Name(), test.on)
+			}
+		})
+	}
+}
+
+func TestTenantCollectionCircuitOpen(t *testing.T) {
+	breaker := connections.breaker
+	connections.breaker = &circuitBreaker{threshold: 1, cooldown: time.Hour}
+	connections.breaker.record(context.Background(), true)
+	defer func() { connections.breaker = breaker }()
+
+	ctx := context.Background()
+	tenant := newTenantCollection(testCollection(t, "acction"), 12, true)
+
+	var document bson.M
+	if err := tenant.FindOne(ctx, bson.M{}).Decode(&document); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("FindOne().Decode() error = %v, want %v", err, ErrCircuitOpen)
+	}
+	if _, err := tenant.Find(ctx, bson.M{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Find() error = %v, want %v", err, ErrCircuitOpen)
+	}
+	if _, err := tenant.UpsertMany(ctx, []bson.M{{"_id": 1}}, []bson.M{{"$set": bson.M{"spend": 1}}}); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("UpsertMany() error = %v, want %v", err, ErrCircuitOpen)
+	}
+}
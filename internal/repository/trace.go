@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"github.com/minhlong/go-aws-boilerplate/pkg/tracing"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+)
+
+// commandSpans keeps the span of each running command until the driver reports its outcome.
+type commandSpans struct {
+	spans sync.Map
+}
+
+// newCommandMonitor turns every command the driver sends into a span, a child of the span in the context of
+// the operation that sent it.
+func newCommandMonitor() *event.CommandMonitor {
+	spans := &commandSpans{}
+
+	return &event.CommandMonitor{
+		Started:   spans.started,
+		Succeeded: spans.succeeded,
+		Failed:    spans.failed,
+	}
+}
+
+func (c *commandSpans) started(ctx context.Context, started *event.CommandStartedEvent) {
+	attributes := []attribute.KeyValue{
+		attribute.String("db.system", "mongodb"),
+		attribute.String("db.name", started.DatabaseName),
+		attribute.String("db.operation", started.CommandName),
+	}
+	if collection, ok := started.Command.Lookup(started.CommandName).StringValueOK(); ok {
+		attributes = append(attributes, attribute.String("db.mongodb.collection", collection))
+	}
+
+	_, span := tracing.Start(ctx, "mongo."+started.CommandName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes...),
+	)
+	c.spans.Store(started.RequestID, span)
+}
+
+func (c *commandSpans) succeeded(ctx context.Context, succeeded *event.CommandSucceededEvent) {
+	if value, ok := c.spans.LoadAndDelete(succeeded.RequestID); ok {
+		value.(trace.Span).End()
+	}
+}
+
+func (c *commandSpans) failed(ctx context.Context, failed *event.CommandFailedEvent) {
+	if value, ok := c.spans.LoadAndDelete(failed.RequestID); ok {
+		span := value.(trace.Span)
+		span.SetStatus(codes.Error, failed.Failure)
+		span.End()
+	}
+}
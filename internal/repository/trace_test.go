@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func TestCommandMonitor(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	ctx := context.Background()
+	command, _ := bson.Marshal(bson.D{{Key: "find", Value: "acction_12"}})
+	monitor := newCommandMonitor()
+
+	monitor.Started(ctx, &event.CommandStartedEvent{Command: command, DatabaseName: "insights", CommandName: "find", RequestID: 1})
+	monitor.Started(ctx, &event.CommandStartedEvent{Command: command, DatabaseName: "insights", CommandName: "find", RequestID: 2})
+	monitor.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{RequestID: 1, CommandName: "find"}})
+	monitor.Failed(ctx, &event.CommandFailedEvent{CommandFinishedEvent: event.CommandFinishedEvent{RequestID: 2, CommandName: "find"}, Failure: "timeout"})
+	// A finished command without a started span is ignored
+	monitor.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{RequestID: 3}})
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("%d spans ended, want 2", len(spans))
+	}
+	for _, span := range spans {
+		if span.Name() != "mongo.find" {
+			t.Errorf("span name = %s, want mongo.find", span.Name())
+		}
+		attributes := map[attribute.Key]string{}
+		for _, kv := range span.Attributes() {
+			attributes[kv.Key] = kv.Value.AsString()
+		}
+		if attributes["db.name"] != "insights" || attributes["db.mongodb.collection"] != "acction_12" {
+			t.Errorf("span attributes = %v, want the database and collection", attributes)
+		}
+	}
+	if got := spans[0].Status().Code; got != codes.Unset {
+		t.Errorf("succeeded command status = %v, want unset", got)
+	}
+	if got := spans[1].Status(); got.Code != codes.Error || got.Description != "timeout" {
+		t.Errorf("failed command status = %+v, want the failure", got)
+	}
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"time"
+)
+
+// AdTracking returns every ad seen between since and until with its latest status and destination url.
+func (m *MongodbRepository) AdTracking(ctx context.Context, since time.Time, until time.Time) ([]AdTracking, error) {
+	pipeLine := []bson.M{
+		{
+			"$match": bson.M{
+				"date": bson.M{
+					"$gte": since,
+					"$lte": until,
+				},
+			},
+		},
+		{
+			"$sort": bson.M{"date": 1},
+		},
+		{
+			"$group": bson.M{
+				"_id":             "$ad_id",
+				"ad_id":           bson.M{"$last": "$ad_id"},
+				"ad_name":         bson.M{"$last": "$ad_name"},
+				"ad_status":       bson.M{"$last": bson.M{"$ifNull": bson.A{"$ad_status", "INACTIVE"}}},
+				"campaign_id":     bson.M{"$last": "$campaign_id"},
+				"campaign_name":   bson.M{"$last": "$campaign_name"},
+				"account_id":      bson.M{"$last": "$ad_account_id"},
+				"destination_url": bson.M{"$last": bson.M{"$ifNull": bson.A{"$destination_url", ""}}},
+				"valid_parameters": bson.M{"$last": bson.M{
+					"$ifNull": bson.A{"$valid_parameters", false},
+				}},
+				"spend": bson.M{"$sum": "$spend"},
+			},
+		},
+	}
+
+	var ads []AdTracking
+	if err := m.aggregate(ctx, m.CollectionName, pipeLine, &ads); err != nil {
+		return nil, err
+	}
+
+	return ads, nil
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"testing"
+	"time"
+)
+
+func TestAdTracking(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	since := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 4, 7, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		shared bool
+	}{
+		{name: "per shop"},
+		{name: "shared", shared: true},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			repo := mockRepository(mt)
+			if test.shared {
+				repo.CollectionName = newTenantCollection(mt.DB.Collection(sharedRawCollection), 12, true)
+			}
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, mtest.TestDb+"."+repo.CollectionName.Name(), mtest.FirstBatch,
+				bson.D{
+					{Key: "_id", Value: "ad1"},
+					{Key: "ad_id", Value: "ad1"},
+					{Key: "ad_status", Value: "ACTIVE"},
+					{Key: "campaign_id", Value: "c1"},
+					{Key: "account_id", Value: "a1"},
+					{Key: "destination_url", Value: "https://shop.example/p?utm_source=pinterest"},
+					{Key: "valid_parameters", Value: true},
+					{Key: "spend", Value: 12.5},
+				},
+				bson.D{
+					{Key: "_id", Value: "ad2"},
+					{Key: "ad_id", Value: "ad2"},
+					{Key: "ad_status", Value: "INACTIVE"},
+					{Key: "destination_url", Value: ""},
+					{Key: "valid_parameters", Value: false},
+					{Key: "spend", Value: 0.0},
+				},
+			))
+
+			ads, err := repo.AdTracking(context.Background(), since, until)
+			if err != nil {
+				t.Fatalf("AdTracking() error = %v", err)
+			}
+			if len(ads) != 2 {
+				t.Fatalf("AdTracking() = %d ads, want 2", len(ads))
+			}
+			want := AdTracking{AdID: "ad1", AdStatus: "ACTIVE", CampaignID: "c1", AccountID: "a1",
+				DestinationURL: "https://shop.example/p?utm_source=pinterest", ValidParameters: true, Spend: 12.5}
+			if ads[0] != want {
+				t.Errorf("AdTracking()[0] = %+v, want %+v", ads[0], want)
+			}
+
+			stages, err := mt.GetStartedEvent().Command.Lookup("pipeline").Array().Values()
+			if err != nil {
+				t.Fatal(err)
+			}
+			first := 0
+			if test.shared {
+				if got := stages[0].Document().Lookup("$match", tenantField).AsInt64(); got != 12 {
+					t.Errorf("shared pipeline starts with shop %d, want 12", got)
+				}
+				first = 1
+			}
+			date := stages[first].Document().Lookup("$match", "date").Document()
+			if !date.Lookup("$gte").Time().Equal(since) || !date.Lookup("$lte").Time().Equal(until) {
+				t.Errorf("date match = %s, want %s to %s", date, since, until)
+			}
+			group := stages[first+2].Document().Lookup("$group").Document()
+			if got := group.Lookup("ad_status", "$last", "$ifNull").Array().Index(1).Value().StringValue(); got != "INACTIVE" {
+				t.Errorf("ad without a status is %q, want INACTIVE", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Package schema decodes RequestInput messages of any supported version into the current shape and validates them.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/pkg/failure"
+)
+
+// upgrades turns a message of version N, the key, into version N+1. Producers can keep sending an older version
+// while consumers move on, a new version only needs its upgrade registered here.
+var upgrades = map[int]func(message map[string]interface{}){
+	1: upgradeV1,
+	2: upgradeV2,
+}
+
+// upgradeV1 makes the period explicit, version 1 messages only carried the start_sync_time day.
+func upgradeV1(message map[string]interface{}) {
+	day, ok := message["start_sync_time"]
+	if !ok {
+		return
+	}
+	if _, ok := message["since"]; !ok {
+		message["since"] = day
+	}
+	if _, ok := message["until"]; !ok {
+		message["until"] = day
+	}
+}
+
+// upgradeV2 keeps the bare account array on the insight notification, version 2 producers predate the
+// InsightResponse envelope.
+func upgradeV2(message map[string]interface{}) {
+	message["bare_result"] = true
+}
+
+// Decode reads a message body, upgrades it to repository.RequestVersion and validates it. Every failure is a
+// validation failure, the message can not succeed as sent.
+func Decode(body []byte) (*repository.RequestInput, error) {
+	request, err := Upgrade(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Validate(*request); err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+// Upgrade reads a message body of any supported version into the current version without validating it.
+// Numbers are kept as written while upgrading, so ids beyond 2^53 do not lose precision to float64.
+func Upgrade(body []byte) (*repository.RequestInput, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var message map[string]interface{}
+	if err := decoder.Decode(&message); err != nil {
+		return nil, failure.Validation(err, "can not decode request")
+	}
+	if message == nil {
+		return nil, failure.Validationf("request is empty")
+	}
+
+	version := 1
+	if value, ok := message["v"]; ok {
+		number, ok := value.(json.Number)
+		parsed, err := number.Int64()
+		if !ok || err != nil || parsed < 1 {
+			return nil, failure.Validationf("request version %v is not a positive integer", value)
+		}
+		if parsed > repository.RequestVersion {
+			return nil, failure.Validationf("request version %d is newer than the supported version %d", parsed, repository.RequestVersion)
+		}
+		version = int(parsed)
+	}
+	for ; version < repository.RequestVersion; version++ {
+		upgrades[version](message)
+	}
+	message["v"] = version
+
+	upgraded, err := json.Marshal(message)
+	if err != nil {
+		return nil, failure.Validation(err, "can not encode upgraded request")
+	}
+
+	var request repository.RequestInput
+	if err := json.Unmarshal(upgraded, &request); err != nil {
+		return nil, failure.Validation(err, "can not decode request")
+	}
+
+	return &request, nil
+}
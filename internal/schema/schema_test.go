@@ -0,0 +1,140 @@
+package schema
+
+import (
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/pkg/failure"
+	"testing"
+	"time"
+)
+
+func TestUpgrade(t *testing.T) {
+	day := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		body    string
+		want    repository.RequestInput
+		invalid bool
+	}{
+		{
+			name: "version 1 gets its period from start_sync_time",
+			body: `{"sid": 12, "start_sync_time": "2024-04-01T00:00:00Z"}`,
+			want: repository.RequestInput{Version: repository.RequestVersion, ShopID: 12, StartSyncTime: day, Since: day, Until: day, BareResult: true},
+		},
+		{
+			name: "version 1 keeps an explicit period",
+			body: `{"v": 1, "sid": 12, "start_sync_time": "2024-04-01T00:00:00Z", "since": "2024-03-01T00:00:00Z", "until": "2024-03-31T00:00:00Z"}`,
+			want: repository.RequestInput{
+				Version: repository.RequestVersion, ShopID: 12, StartSyncTime: day,
+				Since: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), Until: time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC),
+				BareResult: true,
+			},
+		},
+		{
+			name: "version 2 keeps the bare insight result",
+			body: `{"v": 2, "sid": 12, "since": "2024-04-01T00:00:00Z", "until": "2024-04-01T00:00:00Z"}`,
+			want: repository.RequestInput{Version: repository.RequestVersion, ShopID: 12, Since: day, Until: day, BareResult: true},
+		},
+		{
+			name: "current version",
+			body: `{"v": 3, "sid": 12, "since": "2024-04-01T00:00:00Z", "until": "2024-04-01T00:00:00Z"}`,
+			want: repository.RequestInput{Version: repository.RequestVersion, ShopID: 12, Since: day, Until: day},
+		},
+		{
+			name: "large ids keep their precision",
+			body: `{"v": 3, "sid": 9007199254740993, "consumer_id": 9223372036854775807}`,
+			want: repository.RequestInput{Version: repository.RequestVersion, ShopID: 9007199254740993, ConsumerID: 9223372036854775807},
+		},
+		{name: "newer version", body: `{"v": 4, "sid": 12}`, invalid: true},
+		{name: "fractional version", body: `{"v": 1.5, "sid": 12}`, invalid: true},
+		{name: "zero version", body: `{"v": 0, "sid": 12}`, invalid: true},
+		{name: "version as text", body: `{"v": "2", "sid": 12}`, invalid: true},
+		{name: "not json", body: `sid=12`, invalid: true},
+		{name: "null", body: `null`, invalid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := Upgrade([]byte(test.body))
+			if test.invalid {
+				if failure.KindOf(err) != failure.KindValidation {
+					t.Fatalf("Upgrade() error = %v, want a validation failure", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Upgrade() error = %v", err)
+			}
+
+			got := *request
+			if got.Version != test.want.Version || got.ShopID != test.want.ShopID || got.ConsumerID != test.want.ConsumerID {
+				t.Errorf("Upgrade() = v%d sid %d consumer %d, want v%d sid %d consumer %d",
+					got.Version, got.ShopID, got.ConsumerID, test.want.Version, test.want.ShopID, test.want.ConsumerID)
+			}
+			if !got.StartSyncTime.Equal(test.want.StartSyncTime) || !got.Since.Equal(test.want.Since) || !got.Until.Equal(test.want.Until) {
+				t.Errorf("Upgrade() period = %s %s..%s, want %s %s..%s",
+					got.StartSyncTime, got.Since, got.Until, test.want.StartSyncTime, test.want.Since, test.want.Until)
+			}
+			if got.BareResult != test.want.BareResult {
+				t.Errorf("Upgrade() bare result = %v, want %v", got.BareResult, test.want.BareResult)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	yesterday := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	valid := func() repository.RequestInput {
+		return repository.RequestInput{
+			Version:      repository.RequestVersion,
+			ShopID:       12,
+			ShopCurrency: "USD",
+			Accounts:     []repository.Account{{ID: "a1", Currency: "EUR", Timezone: "Europe/Berlin"}},
+			Since:        yesterday.AddDate(0, 0, -6),
+			Until:        yesterday,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(request *repository.RequestInput)
+		invalid bool
+	}{
+		{name: "valid", modify: func(request *repository.RequestInput) {}},
+		{name: "subscription without dates", modify: func(request *repository.RequestInput) {
+			request.JobType, request.Since, request.Until = repository.JobSubscribe, time.Time{}, time.Time{}
+		}},
+		{name: "missing shop", modify: func(request *repository.RequestInput) { request.ShopID = 0 }, invalid: true},
+		{name: "unknown job", modify: func(request *repository.RequestInput) { request.JobType = "reindex" }, invalid: true},
+		{name: "unknown platform", modify: func(request *repository.RequestInput) { request.Platform = "myspace" }, invalid: true},
+		{name: "unknown currency", modify: func(request *repository.RequestInput) { request.ShopCurrency = "XXY" }, invalid: true},
+		{name: "account without id", modify: func(request *repository.RequestInput) { request.Accounts[0].ID = "" }, invalid: true},
+		{name: "unknown timezone", modify: func(request *repository.RequestInput) { request.Accounts[0].Timezone = "Mars/Olympus" }, invalid: true},
+		{name: "missing dates", modify: func(request *repository.RequestInput) { request.Since, request.Until = time.Time{}, time.Time{} }, invalid: true},
+		{name: "since without until", modify: func(request *repository.RequestInput) { request.Until = time.Time{} }, invalid: true},
+		{name: "reversed period", modify: func(request *repository.RequestInput) {
+			request.Since, request.Until = request.Until, request.Since
+		}, invalid: true},
+		{name: "future period", modify: func(request *repository.RequestInput) { request.Until = yesterday.AddDate(0, 0, 10) }, invalid: true},
+		{name: "too long period", modify: func(request *repository.RequestInput) { request.Since = yesterday.AddDate(-2, 0, 0) }, invalid: true},
+		{name: "unknown export format", modify: func(request *repository.RequestInput) {
+			request.Export = &repository.Export{Format: "pdf"}
+		}, invalid: true},
+		{name: "negative subscription", modify: func(request *repository.RequestInput) { request.SubscribeMinutes = -1 }, invalid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := valid()
+			test.modify(&request)
+
+			err := Validate(request)
+			if test.invalid != (err != nil) {
+				t.Fatalf("Validate() error = %v, want invalid %v", err, test.invalid)
+			}
+			if err != nil && failure.KindOf(err) != failure.KindValidation {
+				t.Errorf("Validate() kind = %s, want validation", failure.KindOf(err))
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package schema
+
+import (
+	"fmt"
+	"github.com/minhlong/go-aws-boilerplate/internal/export"
+	"github.com/minhlong/go-aws-boilerplate/internal/platform"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/pkg/failure"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	// Timezones are checked against the embedded database, the Lambda runtime does not ship one
+	_ "time/tzdata"
+)
+
+const (
+	defaultMaxAccounts  = 50
+	defaultMaxRangeDays = 400
+)
+
+// earliestDate is before any ad data the platforms still report.
+var earliestDate = time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var jobTypes = map[string]bool{
+	"":                      true,
+	repository.JobInsights:  true,
+	repository.JobAnomalies: true,
+	repository.JobPacing:    true,
+	repository.JobUtmAudit:  true,
+	repository.JobRollup:    true,
+	repository.JobSubscribe: true,
+}
+
+// Validate checks a request in the current version and reports every problem found in one validation error.
+// The limits can be tuned with REQUEST_MAX_ACCOUNTS and REQUEST_MAX_RANGE_DAYS.
+func Validate(request repository.RequestInput) error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if request.ShopID <= 0 {
+		add("sid is required")
+	}
+	if !jobTypes[request.JobType] {
+		add("job_type %q is unknown", request.JobType)
+	}
+	if !platform.Supported(request.Platform) {
+		add("platform %q is not supported", request.Platform)
+	}
+	if request.ShopCurrency != "" && !IsCurrency(request.ShopCurrency) {
+		add("cur %q is not an ISO 4217 currency code", request.ShopCurrency)
+	}
+
+	maxAccounts := envInt("REQUEST_MAX_ACCOUNTS", defaultMaxAccounts)
+	if len(request.Accounts) > maxAccounts {
+		add("acc has %d accounts, at most %d are allowed", len(request.Accounts), maxAccounts)
+	}
+	for i, account := range request.Accounts {
+		if account.ID == "" {
+			add("acc[%d].id is required", i)
+		}
+		if account.Currency != "" && !IsCurrency(account.Currency) {
+			add("acc[%d].cur %q is not an ISO 4217 currency code", i, account.Currency)
+		}
+		if account.Timezone != "" {
+			if _, err := time.LoadLocation(account.Timezone); err != nil {
+				add("acc[%d].tz %q is not an IANA timezone", i, account.Timezone)
+			}
+		}
+	}
+
+	if request.JobType != repository.JobSubscribe {
+		problems = append(problems, validateDates(request)...)
+	}
+
+	if request.Export != nil && request.Export.Format != export.FormatCSV && request.Export.Format != export.FormatXLSX {
+		add("export.format %q is unknown", request.Export.Format)
+	}
+	if request.SubscribeMinutes < 0 {
+		add("subscribe_minutes can not be negative")
+	}
+
+	if len(problems) > 0 {
+		return failure.Validationf("invalid request: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+func validateDates(request repository.RequestInput) []string {
+	var problems []string
+	if request.StartSyncTime.IsZero() && request.Since.IsZero() && request.Until.IsZero() {
+		return append(problems, "start_sync_time or since and until are required")
+	}
+	if request.Since.IsZero() != request.Until.IsZero() {
+		problems = append(problems, "since and until must be given together")
+	}
+
+	since, until := request.DateRange()
+	maxRangeDays := envInt("REQUEST_MAX_RANGE_DAYS", defaultMaxRangeDays)
+	// Shops ahead of UTC are already a day further
+	latest := time.Now().UTC().Add(48 * time.Hour)
+	switch {
+	case until.Before(since):
+		problems = append(problems, fmt.Sprintf("until %s is before since %s", until.Format("2006-01-02"), since.Format("2006-01-02")))
+	case since.Before(earliestDate):
+		problems = append(problems, fmt.Sprintf("since %s is before %s", since.Format("2006-01-02"), earliestDate.Format("2006-01-02")))
+	case until.After(latest):
+		problems = append(problems, fmt.Sprintf("until %s is in the future", until.Format("2006-01-02")))
+	case until.Sub(since) > time.Duration(maxRangeDays)*24*time.Hour:
+		problems = append(problems, fmt.Sprintf("the period spans more than %d days", maxRangeDays))
+	}
+
+	return problems
+}
+
+func envInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+
+	return value
+}
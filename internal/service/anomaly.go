@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/pkg/errors"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	AnomalySpendSpike   = "spend_spike"
+	AnomalyCTRCollapse  = "ctr_collapse"
+	AnomalyROASDrop     = "roas_drop"
+	SeverityLow         = "low"
+	SeverityMedium      = "medium"
+	SeverityHigh        = "high"
+	madToStandardNormal = 1.4826
+)
+
+var severityRank = map[string]int{
+	SeverityLow:    1,
+	SeverityMedium: 2,
+	SeverityHigh:   3,
+}
+
+type AnomalyOptions struct {
+	// BaselineDays is the trailing window, ending the day before the checked day, that defines normal.
+	BaselineDays int
+	// MinBaselineDays is the number of days with data needed before an entity is judged at all.
+	MinBaselineDays int
+	// Score thresholds on the robust z-score |x - median| / (1.4826 * MAD).
+	LowScore    float64
+	MediumScore float64
+	HighScore   float64
+	// Volume floors that keep ratios computed on a handful of events from firing.
+	MinImpressions int64
+	MinSpend       float64
+	// NotifySeverity is the lowest severity that triggers an in-app notification.
+	NotifySeverity string
+}
+
+var DefaultAnomalyOptions = AnomalyOptions{
+	BaselineDays:    14,
+	MinBaselineDays: 7,
+	LowScore:        3,
+	MediumScore:     5,
+	HighScore:       8,
+	MinImpressions:  1000,
+	MinSpend:        10,
+	NotifySeverity:  SeverityMedium,
+}
+
+// DetectAnomalies checks the last day of the requested range for campaigns and ads against their own baseline.
+func DetectAnomalies(ctx context.Context, request repository.RequestInput, repo *repository.MongodbRepository, options AnomalyOptions) ([]repository.Anomaly, error) {
+	_, day := request.DateRange()
+	since := day.AddDate(0, 0, -options.BaselineDays)
+
+	var anomalies []repository.Anomaly
+	for _, level := range []string{repository.LevelCampaign, repository.LevelAd} {
+		metrics, err := repo.DailyMetrics(ctx, level, since, day)
+		if err != nil {
+			return nil, errors.WithMessage(err, "can not load daily metrics")
+		}
+
+		for _, series := range groupByEntity(metrics) {
+			anomalies = append(anomalies, detectSeries(level, series, day, options)...)
+		}
+	}
+
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		return anomalies[i].Score > anomalies[j].Score
+	})
+
+	return anomalies, nil
+}
+
+// ShouldNotify reports whether any anomaly is at least as severe as the configured notification level.
+func ShouldNotify(anomalies []repository.Anomaly, options AnomalyOptions) bool {
+	for _, anomaly := range anomalies {
+		if severityRank[anomaly.Severity] >= severityRank[options.NotifySeverity] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func groupByEntity(metrics []repository.DailyMetric) [][]repository.DailyMetric {
+	index := map[string]int{}
+	var series [][]repository.DailyMetric
+	for _, metric := range metrics {
+		i, ok := index[metric.EntityID]
+		if !ok {
+			i = len(series)
+			index[metric.EntityID] = i
+			series = append(series, nil)
+		}
+		series[i] = append(series[i], metric)
+	}
+
+	return series
+}
+
+type anomalyCheck struct {
+	Kind      string
+	Metric    string
+	Direction float64
+	Value     func(repository.DailyMetric) (float64, bool)
+	// ZeroBaselineFloor is the move that scores LowScore when the baseline is all zeros, 0 when no such move
+	// can be an anomaly of the check.
+	ZeroBaselineFloor float64
+}
+
+func detectSeries(level string, series []repository.DailyMetric, day time.Time, options AnomalyOptions) []repository.Anomaly {
+	last := series[len(series)-1]
+	if !last.Date.Equal(day) || len(series)-1 < options.MinBaselineDays {
+		return nil
+	}
+	baseline := series[:len(series)-1]
+
+	checks := []anomalyCheck{
+		{
+			Kind:      AnomalySpendSpike,
+			Metric:    "spend",
+			Direction: 1,
+			Value: func(m repository.DailyMetric) (float64, bool) {
+				return m.Spend, true
+			},
+			ZeroBaselineFloor: options.MinSpend,
+		},
+		{
+			Kind:      AnomalyCTRCollapse,
+			Metric:    "ctr",
+			Direction: -1,
+			Value: func(m repository.DailyMetric) (float64, bool) {
+				if m.Impressions < options.MinImpressions {
+					return 0, false
+				}
+				return float64(m.Clicks) / float64(m.Impressions) * 100, true
+			},
+		},
+		{
+			Kind:      AnomalyROASDrop,
+			Metric:    "roas",
+			Direction: -1,
+			Value: func(m repository.DailyMetric) (float64, bool) {
+				if m.Spend < options.MinSpend {
+					return 0, false
+				}
+				return m.PurchasesValue / m.Spend, true
+			},
+		},
+	}
+
+	var anomalies []repository.Anomaly
+	for _, check := range checks {
+		value, ok := check.Value(last)
+		if !ok {
+			continue
+		}
+
+		var values []float64
+		for _, metric := range baseline {
+			if v, ok := check.Value(metric); ok {
+				values = append(values, v)
+			}
+		}
+		if len(values) < options.MinBaselineDays {
+			continue
+		}
+
+		median, mad := medianAbsoluteDeviation(values)
+		scale := madToStandardNormal * mad
+		if scale == 0 {
+			// A perfectly flat baseline, fall back to a tenth of the median so any real move still scores.
+			scale = math.Abs(median) / 10
+		}
+		if scale == 0 {
+			// Zero on most days, e.g. an entity that barely spent. Moves are scored against the volume floor, so
+			// spending the floor scores LowScore and spending more scores higher.
+			if check.ZeroBaselineFloor <= 0 {
+				continue
+			}
+			scale = check.ZeroBaselineFloor / options.LowScore
+		}
+
+		score := check.Direction * (value - median) / scale
+		severity := anomalySeverity(score, options)
+		if severity == "" {
+			continue
+		}
+
+		anomalies = append(anomalies, repository.Anomaly{
+			Level:      level,
+			EntityID:   last.EntityID,
+			EntityName: last.EntityName,
+			CampaignID: last.CampaignID,
+			AccountID:  last.AccountID,
+			Date:       last.Date,
+			Kind:       check.Kind,
+			Metric:     check.Metric,
+			Value:      value,
+			Median:     median,
+			MAD:        mad,
+			Score:      score,
+			Severity:   severity,
+		})
+	}
+
+	return anomalies
+}
+
+func anomalySeverity(score float64, options AnomalyOptions) string {
+	switch {
+	case score >= options.HighScore:
+		return SeverityHigh
+	case score >= options.MediumScore:
+		return SeverityMedium
+	case score >= options.LowScore:
+		return SeverityLow
+	default:
+		return ""
+	}
+}
+
+func medianAbsoluteDeviation(values []float64) (float64, float64) {
+	median := medianOf(values)
+
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - median)
+	}
+
+	return median, medianOf(deviations)
+}
+
+func medianOf(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+
+	return sorted[middle]
+}
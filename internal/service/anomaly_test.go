@@ -0,0 +1,169 @@
+package service
+
+import (
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"testing"
+	"time"
+)
+
+// anomalySeries builds one entity's days ending on day, the last entry being the checked day.
+func anomalySeries(day time.Time, days []repository.DailyMetric) []repository.DailyMetric {
+	series := make([]repository.DailyMetric, len(days))
+	for i, metric := range days {
+		metric.EntityID = "c1"
+		metric.Date = day.AddDate(0, 0, i-len(days)+1)
+		series[i] = metric
+	}
+
+	return series
+}
+
+func repeatMetric(metric repository.DailyMetric, n int) []repository.DailyMetric {
+	days := make([]repository.DailyMetric, n)
+	for i := range days {
+		days[i] = metric
+	}
+
+	return days
+}
+
+func TestDetectSeries(t *testing.T) {
+	day := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	options := DefaultAnomalyOptions
+	steady := repository.DailyMetric{Spend: 100, Impressions: 10000, Clicks: 200, PurchasesValue: 400}
+
+	tests := []struct {
+		name     string
+		days     []repository.DailyMetric
+		checkDay time.Time
+		want     map[string]string
+	}{
+		{
+			name:     "steady",
+			days:     repeatMetric(steady, 15),
+			checkDay: day,
+			want:     map[string]string{},
+		},
+		{
+			name:     "spend spike on a flat baseline",
+			days:     append(repeatMetric(steady, 14), repository.DailyMetric{Spend: 300, Impressions: 10000, Clicks: 200, PurchasesValue: 1200}),
+			checkDay: day,
+			want:     map[string]string{AnomalySpendSpike: SeverityHigh},
+		},
+		{
+			name:     "ctr collapse",
+			days:     append(repeatMetric(steady, 14), repository.DailyMetric{Spend: 100, Impressions: 10000, Clicks: 20, PurchasesValue: 400}),
+			checkDay: day,
+			want:     map[string]string{AnomalyCTRCollapse: SeverityHigh},
+		},
+		{
+			name:     "spend from zero",
+			days:     append(repeatMetric(repository.DailyMetric{}, 14), repository.DailyMetric{Spend: 50}),
+			checkDay: day,
+			want:     map[string]string{AnomalySpendSpike: SeverityHigh},
+		},
+		{
+			name:     "small spend from zero",
+			days:     append(repeatMetric(repository.DailyMetric{}, 14), repository.DailyMetric{Spend: 12}),
+			checkDay: day,
+			want:     map[string]string{AnomalySpendSpike: SeverityLow},
+		},
+		{
+			name:     "spend below the floor from zero",
+			days:     append(repeatMetric(repository.DailyMetric{}, 14), repository.DailyMetric{Spend: 5}),
+			checkDay: day,
+			want:     map[string]string{},
+		},
+		{
+			name:     "short baseline",
+			days:     append(repeatMetric(steady, 3), repository.DailyMetric{Spend: 1000}),
+			checkDay: day,
+			want:     map[string]string{},
+		},
+		{
+			name:     "checked day missing",
+			days:     repeatMetric(steady, 15),
+			checkDay: day.AddDate(0, 0, 1),
+			want:     map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anomalies := detectSeries(repository.LevelCampaign, anomalySeries(day, tt.days), tt.checkDay, options)
+			got := map[string]string{}
+			for _, anomaly := range anomalies {
+				got[anomaly.Kind] = anomaly.Severity
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("detectSeries() = %v, want %v", got, tt.want)
+			}
+			for kind, severity := range tt.want {
+				if got[kind] != severity {
+					t.Errorf("%s severity = %q, want %q", kind, got[kind], severity)
+				}
+			}
+		})
+	}
+}
+
+func TestAnomalySeverity(t *testing.T) {
+	tests := []struct {
+		score float64
+		want  string
+	}{
+		{score: -10, want: ""},
+		{score: 2.9, want: ""},
+		{score: 3, want: SeverityLow},
+		{score: 5, want: SeverityMedium},
+		{score: 8, want: SeverityHigh},
+	}
+
+	for _, tt := range tests {
+		if got := anomalySeverity(tt.score, DefaultAnomalyOptions); got != tt.want {
+			t.Errorf("anomalySeverity(%v) = %q, want %q", tt.score, got, tt.want)
+		}
+	}
+}
+
+func TestMedianAbsoluteDeviation(t *testing.T) {
+	tests := []struct {
+		values     []float64
+		wantMedian float64
+		wantMAD    float64
+	}{
+		{values: []float64{1, 2, 3}, wantMedian: 2, wantMAD: 1},
+		{values: []float64{1, 2, 3, 4}, wantMedian: 2.5, wantMAD: 1},
+		{values: []float64{5, 5, 5, 100}, wantMedian: 5, wantMAD: 0},
+		{values: []float64{0, 0, 0}, wantMedian: 0, wantMAD: 0},
+	}
+
+	for _, tt := range tests {
+		median, mad := medianAbsoluteDeviation(tt.values)
+		if median != tt.wantMedian || mad != tt.wantMAD {
+			t.Errorf("medianAbsoluteDeviation(%v) = %v, %v, want %v, %v", tt.values, median, mad, tt.wantMedian, tt.wantMAD)
+		}
+	}
+}
+
+func TestShouldNotify(t *testing.T) {
+	tests := []struct {
+		severities []string
+		want       bool
+	}{
+		{severities: nil, want: false},
+		{severities: []string{SeverityLow}, want: false},
+		{severities: []string{SeverityLow, SeverityMedium}, want: true},
+		{severities: []string{SeverityHigh}, want: true},
+	}
+
+	for _, tt := range tests {
+		var anomalies []repository.Anomaly
+		for _, severity := range tt.severities {
+			anomalies = append(anomalies, repository.Anomaly{Severity: severity})
+		}
+		if got := ShouldNotify(anomalies, DefaultAnomalyOptions); got != tt.want {
+			t.Errorf("ShouldNotify(%v) = %v, want %v", tt.severities, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/pkg/errors"
+)
+
+const (
+	AttributionPlatform = "platform"
+	AttributionDirect   = "direct"
+	AttributionWeighted = "weighted"
+)
+
+const defaultAssistedWeight = 0.5
+
+func ValidateAttribution(options repository.AttributionOptions) error {
+	for _, model := range options.Models {
+		switch model {
+		case AttributionPlatform, AttributionDirect, AttributionWeighted:
+		default:
+			return errors.Errorf("unknown attribution model %q", model)
+		}
+	}
+	if weight := options.AssistedWeight; weight != nil && (*weight < 0 || *weight > 1) {
+		return errors.Errorf("assisted weight %v is out of range", *weight)
+	}
+
+	return nil
+}
+
+// ApplyAttribution fills every level of the result with the selected attribution models.
+func ApplyAttribution(result []repository.AccountInsight, options repository.AttributionOptions) {
+	weight := defaultAssistedWeight
+	if options.AssistedWeight != nil {
+		weight = *options.AssistedWeight
+	}
+
+	for _, level := range []string{repository.LevelAccount, repository.LevelCampaign, repository.LevelAdGroup, repository.LevelAd} {
+		WalkLevel(result, level, func(_ EntityRef, metrics *repository.Metrics) {
+			metrics.Attribution = map[string]repository.AttributedMetrics{}
+			for _, model := range options.Models {
+				metrics.Attribution[model] = attribute(*metrics, model, weight)
+			}
+		})
+	}
+}
+
+// attribute recomputes conversions under a model. The platform only reports revenue for its own purchase count,
+// so other models value their purchases at the platform's average order value.
+func attribute(metrics repository.Metrics, model string, assistedWeight float64) repository.AttributedMetrics {
+	purchases := metrics.Purchases
+	switch model {
+	case AttributionDirect:
+		purchases = metrics.DirectPurchase
+	case AttributionWeighted:
+		purchases = metrics.DirectPurchase + assistedWeight*metrics.AssistedPurchase
+	}
+
+	value := metrics.PurchasesValue
+	if model != AttributionPlatform {
+		value = 0
+		if metrics.Purchases > 0 {
+			value = metrics.PurchasesValue / metrics.Purchases * purchases
+		}
+	}
+
+	attributed := repository.AttributedMetrics{
+		Purchases:      purchases,
+		PurchasesValue: value,
+	}
+	if metrics.Spend > 0 {
+		attributed.ROAS = value / metrics.Spend
+	}
+	if purchases > 0 {
+		attributed.CostPerPurchase = metrics.Spend / purchases
+	}
+	if metrics.Clicks > 0 {
+		attributed.ConversionRate = purchases / float64(metrics.Clicks) * 100
+	}
+
+	return attributed
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"encoding/json"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"math"
+	"testing"
+)
+
+func TestValidateAttribution(t *testing.T) {
+	weight := func(value float64) *float64 { return &value }
+
+	tests := []struct {
+		name    string
+		options repository.AttributionOptions
+		wantErr bool
+	}{
+		{name: "all models", options: repository.AttributionOptions{Models: []string{AttributionPlatform, AttributionDirect, AttributionWeighted}}},
+		{name: "no models", options: repository.AttributionOptions{}},
+		{name: "unknown model", options: repository.AttributionOptions{Models: []string{"last_click"}}, wantErr: true},
+		{name: "zero weight", options: repository.AttributionOptions{AssistedWeight: weight(0)}},
+		{name: "weight above one", options: repository.AttributionOptions{AssistedWeight: weight(1.5)}, wantErr: true},
+		{name: "negative weight", options: repository.AttributionOptions{AssistedWeight: weight(-0.1)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateAttribution(tt.options); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateAttribution() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAttribute(t *testing.T) {
+	metrics := repository.Metrics{
+		Spend:            100,
+		Clicks:           50,
+		Purchases:        10,
+		PurchasesValue:   500,
+		DirectPurchase:   4,
+		AssistedPurchase: 6,
+	}
+
+	tests := []struct {
+		model  string
+		weight float64
+		want   repository.AttributedMetrics
+	}{
+		{
+			model: AttributionPlatform,
+			want:  repository.AttributedMetrics{Purchases: 10, PurchasesValue: 500, ROAS: 5, CostPerPurchase: 10, ConversionRate: 20},
+		},
+		{
+			model: AttributionDirect,
+			want:  repository.AttributedMetrics{Purchases: 4, PurchasesValue: 200, ROAS: 2, CostPerPurchase: 25, ConversionRate: 8},
+		},
+		{
+			model:  AttributionWeighted,
+			weight: 0.5,
+			want:   repository.AttributedMetrics{Purchases: 7, PurchasesValue: 350, ROAS: 3.5, CostPerPurchase: 100.0 / 7, ConversionRate: 14},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			if got := attribute(metrics, tt.model, tt.weight); !attributedEqual(got, tt.want) {
+				t.Errorf("attribute() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func attributedEqual(a, b repository.AttributedMetrics) bool {
+	near := func(x, y float64) bool { return math.Abs(x-y) < 1e-9 }
+
+	return near(a.Purchases, b.Purchases) && near(a.PurchasesValue, b.PurchasesValue) && near(a.ROAS, b.ROAS) &&
+		near(a.CostPerPurchase, b.CostPerPurchase) && near(a.ConversionRate, b.ConversionRate)
+}
+
+func TestAttributeWithoutVolume(t *testing.T) {
+	got := attribute(repository.Metrics{DirectPurchase: 2}, AttributionDirect, 0.5)
+	// No platform purchases to derive an order value from, no spend and no clicks
+	want := repository.AttributedMetrics{Purchases: 2}
+	if got != want {
+		t.Errorf("attribute() = %+v, want %+v", got, want)
+	}
+}
+
+func TestApplyAttribution(t *testing.T) {
+	result := []repository.AccountInsight{{
+		Metrics: repository.Metrics{Purchases: 2, PurchasesValue: 100, DirectPurchase: 1, AssistedPurchase: 1},
+		Campaigns: []repository.CampaignInsight{{
+			Metrics: repository.Metrics{Purchases: 2, PurchasesValue: 100, DirectPurchase: 1, AssistedPurchase: 1},
+			AdGroups: []repository.AdGroupInsight{{
+				Ads: []repository.AdInsight{{Metrics: repository.Metrics{Purchases: 2, PurchasesValue: 100, DirectPurchase: 1, AssistedPurchase: 1}}},
+			}},
+		}},
+	}}
+
+	// The default assisted weight is half a purchase
+	ApplyAttribution(result, repository.AttributionOptions{Models: []string{AttributionWeighted}})
+
+	levels := []repository.Metrics{
+		result[0].Metrics,
+		result[0].Campaigns[0].Metrics,
+		result[0].Campaigns[0].AdGroups[0].Ads[0].Metrics,
+	}
+	for i, metrics := range levels {
+		if got := metrics.Attribution[AttributionWeighted].Purchases; got != 1.5 {
+			t.Errorf("level %d weighted purchases = %v, want 1.5", i, got)
+		}
+	}
+	if _, ok := result[0].Campaigns[0].AdGroups[0].Metrics.Attribution[AttributionWeighted]; !ok {
+		t.Error("ad group level was not attributed")
+	}
+}
+
+func TestApplyAttributionWeight(t *testing.T) {
+	weight := func(value float64) *float64 { return &value }
+
+	tests := []struct {
+		name    string
+		options string
+		weight  *float64
+		want    float64
+	}{
+		{name: "absent weight is the default", options: `{"models":["weighted"]}`, want: 2.5},
+		{name: "zero weight credits direct purchases only", options: `{"models":["weighted"],"assisted_weight":0}`, weight: weight(0), want: 1},
+		{name: "full weight", options: `{"models":["weighted"],"assisted_weight":1}`, weight: weight(1), want: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var options repository.AttributionOptions
+			if err := json.Unmarshal([]byte(tt.options), &options); err != nil {
+				t.Fatal(err)
+			}
+			if (options.AssistedWeight == nil) != (tt.weight == nil) || (tt.weight != nil && *options.AssistedWeight != *tt.weight) {
+				t.Fatalf("decoded assisted weight = %v, want %v", options.AssistedWeight, tt.weight)
+			}
+
+			result := []repository.AccountInsight{{Metrics: repository.Metrics{Purchases: 4, DirectPurchase: 1, AssistedPurchase: 3}}}
+			ApplyAttribution(result, options)
+			if got := result[0].Metrics.Attribution[AttributionWeighted].Purchases; got != tt.want {
+				t.Errorf("weighted purchases = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
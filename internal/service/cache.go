@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"sort"
+	"time"
+)
+
+// cacheKey covers everything that changes the result: shop, accounts, platform, range and options.
+type cacheKey struct {
+	ShopID      int64                          `json:"sid"`
+	Accounts    []string                       `json:"acc"`
+	Platform    string                         `json:"platform"`
+	Since       time.Time                      `json:"since"`
+	Until       time.Time                      `json:"until"`
+	Attribution *repository.AttributionOptions `json:"attribution"`
+}
+
+func insightCacheKey(request repository.RequestInput) string {
+	accounts := make([]string, 0, len(request.Accounts))
+	for _, account := range request.Accounts {
+		accounts = append(accounts, account.ID)
+	}
+	sort.Strings(accounts)
+
+	since, until := request.DateRange()
+	key, _ := json.Marshal(cacheKey{
+		ShopID:      request.ShopID,
+		Accounts:    accounts,
+		Platform:    request.Platform,
+		Since:       since.UTC(),
+		Until:       until.UTC(),
+		Attribution: request.Attribution,
+	})
+	sum := sha256.Sum256(key)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// GetCachedInsights serves GetInsights from the shop's cache when an identical query ran within the ttl.
+// Cache errors never fail the request, it then falls through to the aggregation.
+func GetCachedInsights(ctx context.Context, request repository.RequestInput, repo *repository.MongodbRepository, ttl time.Duration) ([]repository.AccountInsight, *repository.CacheInfo, error) {
+	key := insightCacheKey(request)
+	now := time.Now().UTC()
+
+	entry, err := repo.CachedInsights(ctx, key, now)
+	if err != nil {
+		logging.L(ctx).Warn("can not read insight cache", zap.Error(err))
+	}
+	if entry != nil {
+		var result []repository.AccountInsight
+		if err := json.Unmarshal(entry.Payload, &result); err == nil {
+			return result, &repository.CacheInfo{
+				Hit:      true,
+				CachedAt: entry.CreatedAt,
+				Age:      now.Sub(entry.CreatedAt).Seconds(),
+			}, nil
+		}
+	}
+
+	result, err := GetInsights(ctx, request, repo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, "can not encode insights")
+	}
+	if err := repo.CacheInsights(ctx, key, payload, now, ttl); err != nil {
+		logging.L(ctx).Warn("can not write insight cache", zap.Error(err))
+	}
+
+	return result, &repository.CacheInfo{CachedAt: now}, nil
+}
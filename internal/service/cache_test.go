@@ -0,0 +1,74 @@
+package service
+
+import (
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestInsightCacheKey(t *testing.T) {
+	since := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	base := func() repository.RequestInput {
+		return repository.RequestInput{
+			ShopID:   12,
+			Accounts: []repository.Account{{ID: "a1"}, {ID: "a2"}},
+			Platform: "pinterest",
+			Since:    since,
+			Until:    until,
+		}
+	}
+	key := insightCacheKey(base())
+
+	tests := []struct {
+		name   string
+		change func(request *repository.RequestInput)
+		same   bool
+	}{
+		{name: "identical request", change: func(request *repository.RequestInput) {}, same: true},
+		{
+			name: "accounts in another order",
+			change: func(request *repository.RequestInput) {
+				request.Accounts = []repository.Account{{ID: "a2"}, {ID: "a1"}}
+			},
+			same: true,
+		},
+		{
+			name: "same range in another zone",
+			change: func(request *repository.RequestInput) {
+				zone := time.FixedZone("UTC+7", 7*3600)
+				request.Since, request.Until = since.In(zone), until.In(zone)
+			},
+			same: true,
+		},
+		{
+			name: "fields outside the query",
+			change: func(request *repository.RequestInput) {
+				request.AccessToken = "token"
+				request.Name = "Weekly"
+				request.Accounts[0].Name = "Main account"
+			},
+			same: true,
+		},
+		{name: "other shop", change: func(request *repository.RequestInput) { request.ShopID = 34 }},
+		{name: "other platform", change: func(request *repository.RequestInput) { request.Platform = "tiktok" }},
+		{name: "other range", change: func(request *repository.RequestInput) { request.Until = until.AddDate(0, 0, 1) }},
+		{name: "fewer accounts", change: func(request *repository.RequestInput) { request.Accounts = request.Accounts[:1] }},
+		{
+			name: "attribution",
+			change: func(request *repository.RequestInput) {
+				request.Attribution = &repository.AttributionOptions{Models: []string{"weighted"}}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := base()
+			test.change(&request)
+			if got := insightCacheKey(request) == key; got != test.same {
+				t.Errorf("insightCacheKey() same key = %v, want %v", got, test.same)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"github.com/pkg/errors"
+	"time"
+)
+
+const (
+	PresetToday     = "today"
+	PresetYesterday = "yesterday"
+	PresetLast7d    = "last_7d"
+	PresetLast14d   = "last_14d"
+	PresetLast30d   = "last_30d"
+	PresetThisMonth = "this_month"
+	PresetLastMonth = "last_month"
+)
+
+// ResolveDatePreset turns a preset into an inclusive range of calendar days as seen in loc.
+// Days are returned as UTC midnights, the way daily rows are dated in the shop collections.
+func ResolveDatePreset(preset string, now time.Time, loc *time.Location) (time.Time, time.Time, error) {
+	local := now.In(loc)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+	yesterday := today.AddDate(0, 0, -1)
+
+	switch preset {
+	case PresetToday:
+		return today, today, nil
+	case PresetYesterday:
+		return yesterday, yesterday, nil
+	case PresetLast7d:
+		return yesterday.AddDate(0, 0, -6), yesterday, nil
+	case PresetLast14d:
+		return yesterday.AddDate(0, 0, -13), yesterday, nil
+	case PresetLast30d:
+		return yesterday.AddDate(0, 0, -29), yesterday, nil
+	case PresetThisMonth:
+		return today.AddDate(0, 0, 1-today.Day()), today, nil
+	case PresetLastMonth:
+		firstOfMonth := today.AddDate(0, 0, 1-today.Day())
+		return firstOfMonth.AddDate(0, -1, 0), firstOfMonth.AddDate(0, 0, -1), nil
+	default:
+		return time.Time{}, time.Time{}, errors.Errorf("unknown date preset %q", preset)
+	}
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveDatePreset(t *testing.T) {
+	day := func(value string) time.Time {
+		parsed, _ := time.Parse("2006-01-02", value)
+		return parsed
+	}
+	// 20:00 UTC on 2024-03-15 is already 2024-03-16 in Tokyo
+	now := time.Date(2024, 3, 15, 20, 0, 0, 0, time.UTC)
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+
+	tests := []struct {
+		preset    string
+		loc       *time.Location
+		wantSince time.Time
+		wantUntil time.Time
+		wantErr   bool
+	}{
+		{preset: PresetToday, loc: time.UTC, wantSince: day("2024-03-15"), wantUntil: day("2024-03-15")},
+		{preset: PresetToday, loc: tokyo, wantSince: day("2024-03-16"), wantUntil: day("2024-03-16")},
+		{preset: PresetYesterday, loc: time.UTC, wantSince: day("2024-03-14"), wantUntil: day("2024-03-14")},
+		{preset: PresetLast7d, loc: time.UTC, wantSince: day("2024-03-08"), wantUntil: day("2024-03-14")},
+		{preset: PresetLast14d, loc: time.UTC, wantSince: day("2024-03-01"), wantUntil: day("2024-03-14")},
+		{preset: PresetLast30d, loc: time.UTC, wantSince: day("2024-02-14"), wantUntil: day("2024-03-14")},
+		{preset: PresetThisMonth, loc: time.UTC, wantSince: day("2024-03-01"), wantUntil: day("2024-03-15")},
+		{preset: PresetLastMonth, loc: time.UTC, wantSince: day("2024-02-01"), wantUntil: day("2024-02-29")},
+		{preset: "last_7_days", loc: time.UTC, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.preset+" "+tt.loc.String(), func(t *testing.T) {
+			since, until, err := ResolveDatePreset(tt.preset, now, tt.loc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveDatePreset() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !since.Equal(tt.wantSince) || !until.Equal(tt.wantUntil) {
+				t.Errorf("ResolveDatePreset() = %s..%s, want %s..%s", since, until, tt.wantSince, tt.wantUntil)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/minhlong/go-aws-boilerplate/internal/export"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/internal/storage"
+	"github.com/pkg/errors"
+	"time"
+)
+
+func ExportInsights(ctx context.Context, request repository.RequestInput, result []repository.AccountInsight, store storage.ObjectStore) (*repository.ExportReference, error) {
+	body, contentType, err := export.Render(result, *request.Export, request.ShopCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	suffix, err := exportSuffix()
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("exports/%d/insights-%s-%s.%s", request.ShopID, now.Format("20060102T150405"), suffix, request.Export.Format)
+	if err := store.Put(ctx, key, contentType, body); err != nil {
+		return nil, errors.WithMessage(err, "can not store export")
+	}
+
+	url, err := store.URL(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &repository.ExportReference{
+		Key:         key,
+		URL:         url,
+		Format:      request.Export.Format,
+		ContentType: contentType,
+		Size:        len(body),
+		CreatedAt:   now,
+	}, nil
+}
+
+// exportSuffix keeps the keys of exports created in the same second apart.
+func exportSuffix() (string, error) {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", errors.WithMessage(err, "can not generate export key")
+	}
+
+	return hex.EncodeToString(b[:]), nil
+}
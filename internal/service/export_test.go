@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/internal/storage"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportInsightsKeys(t *testing.T) {
+	store := storage.NewLocalStore(t.TempDir())
+	request := repository.RequestInput{ShopID: 42, ShopCurrency: "USD", Export: &repository.Export{Format: "csv", Layout: "flat"}}
+
+	keys := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		reference, err := ExportInsights(context.Background(), request, nil, store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(reference.Key, "exports/42/insights-") || !strings.HasSuffix(reference.Key, ".csv") {
+			t.Errorf("unexpected key %q", reference.Key)
+		}
+		if keys[reference.Key] {
+			t.Fatalf("key %q was reused", reference.Key)
+		}
+		keys[reference.Key] = true
+
+		if _, err := os.Stat(filepath.Join(store.Dir, filepath.FromSlash(reference.Key))); err != nil {
+			t.Errorf("export not stored: %v", err)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/pkg/errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statusAliases maps the statuses producers send to the ones the insight pipeline understands.
+var statusAliases = map[string]string{
+	"ACTIVE":   "ACTIVE",
+	"ENABLED":  "ACTIVE",
+	"RUNNING":  "ACTIVE",
+	"PAUSED":   "PAUSED",
+	"ARCHIVED": "ARCHIVED",
+	"DELETED":  "DELETED",
+	"REMOVED":  "DELETED",
+	"INACTIVE": "INACTIVE",
+}
+
+var dateLayouts = []string{"2006-01-02", time.RFC3339, "2006-01-02T15:04:05", "20060102"}
+
+// ingestFields are the row fields a producer may send besides ad_id and date. Only the ones a row carries are
+// written, so a producer sending part of a row does not reset the rest.
+var ingestFields = []string{
+	"ad_name", "ad_status", "adset_id", "adset_name", "adset_status", "campaign_id", "campaign_name",
+	"campaign_status", "ad_account_id", "ad_account_name", "destination_url", "valid_parameters", "spend",
+	"clicks", "impressions", "add_to_cart", "purchases", "purchases_value", "assisted_purchase", "direct_purchase",
+}
+
+// Ingest validates and normalizes a batch and upserts the valid rows. Invalid rows are reported, not fatal.
+func Ingest(ctx context.Context, batch repository.IngestBatch, repo *repository.MongodbRepository) (*repository.IngestResult, error) {
+	result := &repository.IngestResult{Received: len(batch.Rows)}
+	now := time.Now().UTC()
+
+	writes := make([]repository.AdRowWrite, 0, len(batch.Rows))
+	seen := map[string]int{}
+	for i, raw := range batch.Rows {
+		row, err := NormalizeRow(raw, batch.Platform)
+		if err != nil {
+			result.Rejected = append(result.Rejected, repository.RowError{Index: i, Error: err.Error()})
+			continue
+		}
+		row.UpdatedAt = now
+		write := repository.AdRowWrite{Row: *row, Fields: presentFields(raw)}
+
+		// The last occurrence of an (ad_id, date) pair in the batch wins
+		key := row.AdID + "|" + row.Date.Format("2006-01-02")
+		if j, ok := seen[key]; ok {
+			writes[j] = write
+			continue
+		}
+		seen[key] = len(writes)
+		writes = append(writes, write)
+	}
+
+	written, err := repo.UpsertAdRows(ctx, writes)
+	if err != nil {
+		return nil, errors.WithMessage(err, "can not upsert ad rows")
+	}
+	result.Upserted = written.UpsertedCount
+	result.Modified = written.ModifiedCount
+
+	rows := make([]repository.AdRow, len(writes))
+	for i, write := range writes {
+		rows[i] = write.Row
+	}
+	if err := onRowsWritten(ctx, repo, rows); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// presentFields lists the fields the raw row carries, and the platform which comes with the batch.
+func presentFields(raw map[string]interface{}) []string {
+	fields := []string{"platform"}
+	for _, field := range ingestFields {
+		if _, ok := raw[field]; ok {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+// NormalizeRow converts a raw row to the stored shape: ids to strings, metrics to numbers, the date to a
+// UTC midnight and statuses to upper case known values. A missing status is INACTIVE, an unknown one rejects the row.
+func NormalizeRow(raw map[string]interface{}, platform string) (*repository.AdRow, error) {
+	row := &repository.AdRow{Platform: platform}
+
+	var err error
+	if row.AdID, err = requiredString(raw, "ad_id"); err != nil {
+		return nil, err
+	}
+	if row.Date, err = normalizeDate(raw["date"]); err != nil {
+		return nil, err
+	}
+	if row.CampaignID, err = requiredString(raw, "campaign_id"); err != nil {
+		return nil, err
+	}
+	if row.AdAccountID, err = requiredString(raw, "ad_account_id"); err != nil {
+		return nil, err
+	}
+
+	row.AdName = stringValue(raw["ad_name"])
+	row.AdSetID = stringValue(raw["adset_id"])
+	row.AdSetName = stringValue(raw["adset_name"])
+	row.CampaignName = stringValue(raw["campaign_name"])
+	row.AdAccountName = stringValue(raw["ad_account_name"])
+	row.DestinationURL = stringValue(raw["destination_url"])
+	statuses := []struct {
+		Name   string
+		Target *string
+	}{
+		{"ad_status", &row.AdStatus},
+		{"adset_status", &row.AdSetStatus},
+		{"campaign_status", &row.CampaignStatus},
+	}
+	for _, field := range statuses {
+		if *field.Target, err = normalizeStatus(raw[field.Name]); err != nil {
+			return nil, errors.WithMessage(err, field.Name)
+		}
+	}
+	if value, ok := raw["valid_parameters"].(bool); ok {
+		row.ValidParameters = value
+	}
+
+	floats := []struct {
+		Name   string
+		Target *float64
+	}{
+		{"spend", &row.Spend},
+		{"add_to_cart", &row.AddToCart},
+		{"purchases", &row.Purchases},
+		{"purchases_value", &row.PurchasesValue},
+		{"assisted_purchase", &row.AssistedPurchase},
+		{"direct_purchase", &row.DirectPurchase},
+	}
+	for _, field := range floats {
+		if *field.Target, err = numberValue(raw[field.Name]); err != nil {
+			return nil, errors.WithMessage(err, field.Name)
+		}
+	}
+
+	ints := []struct {
+		Name   string
+		Target *int64
+	}{
+		{"clicks", &row.Clicks},
+		{"impressions", &row.Impressions},
+	}
+	for _, field := range ints {
+		value, err := numberValue(raw[field.Name])
+		if err != nil {
+			return nil, errors.WithMessage(err, field.Name)
+		}
+		if value != math.Trunc(value) {
+			return nil, errors.Errorf("%s: %v is not a whole number", field.Name, value)
+		}
+		*field.Target = int64(value)
+	}
+
+	return row, nil
+}
+
+func requiredString(raw map[string]interface{}, name string) (string, error) {
+	value := stringValue(raw[name])
+	if value == "" {
+		return "", errors.Errorf("%s is required", name)
+	}
+
+	return value, nil
+}
+
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func numberValue(value interface{}) (float64, error) {
+	var number float64
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		number = v
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return 0, errors.Errorf("%q is not a number", v)
+		}
+		number = f
+	case string:
+		text := strings.ReplaceAll(strings.TrimSpace(v), ",", "")
+		if text == "" {
+			return 0, nil
+		}
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return 0, errors.Errorf("%q is not a number", v)
+		}
+		number = f
+	default:
+		return 0, errors.Errorf("%v is not a number", v)
+	}
+
+	if math.IsNaN(number) || math.IsInf(number, 0) || number < 0 {
+		return 0, errors.Errorf("%v is out of range", number)
+	}
+
+	return number, nil
+}
+
+func normalizeDate(value interface{}) (time.Time, error) {
+	var date time.Time
+	switch v := value.(type) {
+	case string:
+		for _, layout := range dateLayouts {
+			if parsed, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+				date = parsed
+				break
+			}
+		}
+	case json.Number, float64:
+		seconds, err := numberValue(v)
+		if err != nil {
+			return time.Time{}, errors.WithMessage(err, "date")
+		}
+		date = time.Unix(int64(seconds), 0)
+	}
+	if date.IsZero() {
+		return time.Time{}, errors.Errorf("date %v is invalid", value)
+	}
+
+	date = date.UTC()
+
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+func normalizeStatus(value interface{}) (string, error) {
+	text := strings.ToUpper(stringValue(value))
+	if text == "" {
+		return "INACTIVE", nil
+	}
+	if status, ok := statusAliases[text]; ok {
+		return status, nil
+	}
+
+	return "", errors.Errorf("status %q is unknown", text)
+}
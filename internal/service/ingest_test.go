@@ -0,0 +1,100 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestNormalizeRow(t *testing.T) {
+	base := func() map[string]interface{} {
+		return map[string]interface{}{
+			"ad_id":         json.Number("1234567890123456789"),
+			"date":          "2024-03-15",
+			"campaign_id":   "c1",
+			"ad_account_id": "a1",
+		}
+	}
+	with := func(key string, value interface{}) map[string]interface{} {
+		raw := base()
+		if value == nil {
+			delete(raw, key)
+		} else {
+			raw[key] = value
+		}
+		return raw
+	}
+
+	tests := []struct {
+		name    string
+		raw     map[string]interface{}
+		check   func(t *testing.T, status string, spend float64, clicks int64, date time.Time)
+		wantErr bool
+	}{
+		{name: "minimal", raw: base()},
+		{name: "status alias", raw: with("ad_status", "enabled"), check: func(t *testing.T, status string, _ float64, _ int64, _ time.Time) {
+			if status != "ACTIVE" {
+				t.Errorf("status = %q, want ACTIVE", status)
+			}
+		}},
+		{name: "missing status", raw: base(), check: func(t *testing.T, status string, _ float64, _ int64, _ time.Time) {
+			if status != "INACTIVE" {
+				t.Errorf("status = %q, want INACTIVE", status)
+			}
+		}},
+		{name: "unknown status", raw: with("ad_status", "LEARNING"), wantErr: true},
+		{name: "unknown campaign status", raw: with("campaign_status", "DRAFT"), wantErr: true},
+		{name: "spend with separators", raw: with("spend", "1,234.5"), check: func(t *testing.T, _ string, spend float64, _ int64, _ time.Time) {
+			if spend != 1234.5 {
+				t.Errorf("spend = %v, want 1234.5", spend)
+			}
+		}},
+		{name: "negative spend", raw: with("spend", -1.0), wantErr: true},
+		{name: "fractional clicks", raw: with("clicks", 1.5), wantErr: true},
+		{name: "clicks", raw: with("clicks", json.Number("42")), check: func(t *testing.T, _ string, _ float64, clicks int64, _ time.Time) {
+			if clicks != 42 {
+				t.Errorf("clicks = %d, want 42", clicks)
+			}
+		}},
+		{name: "timestamp date", raw: with("date", "2024-03-15T23:59:59Z"), check: func(t *testing.T, _ string, _ float64, _ int64, date time.Time) {
+			if !date.Equal(time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("date = %s, want 2024-03-15 midnight", date)
+			}
+		}},
+		{name: "bad date", raw: with("date", "15/03/2024"), wantErr: true},
+		{name: "missing campaign", raw: with("campaign_id", nil), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row, err := NormalizeRow(tt.raw, "pinterest")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeRow() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if row.AdID != "1234567890123456789" || row.Platform != "pinterest" {
+				t.Errorf("unexpected row %+v", row)
+			}
+			if tt.check != nil {
+				tt.check(t, row.AdStatus, row.Spend, row.Clicks, row.Date)
+			}
+		})
+	}
+}
+
+func TestPresentFields(t *testing.T) {
+	raw := map[string]interface{}{"ad_id": "1", "date": "2024-03-15", "spend": 1.0, "ad_status": nil, "unknown": true}
+
+	fields := presentFields(raw)
+	want := []string{"platform", "ad_status", "spend"}
+	if len(fields) != len(want) {
+		t.Fatalf("presentFields() = %v, want %v", fields, want)
+	}
+	for i := range want {
+		if fields[i] != want[i] {
+			t.Errorf("presentFields() = %v, want %v", fields, want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// MigrateLayout moves a shop's data from one storage layout to the other. Raw documents are copied and counted,
+// rollups are rebuilt in the target, and the source is only removed when asked and the counts agree.
+func MigrateLayout(ctx context.Context, shopID int64, from string, to string, deleteSource bool) error {
+	if from == to {
+		return errors.Errorf("shop %d is already in the %s layout", shopID, to)
+	}
+
+	source, err := repository.NewMongoDbWithLayout(ctx, shopID, from)
+	if err != nil {
+		return err
+	}
+	target, err := repository.NewMongoDbWithLayout(ctx, shopID, to)
+	if err != nil {
+		return err
+	}
+
+	if err := target.EnsureIndexes(ctx); err != nil {
+		return errors.WithMessage(err, "can not create target indexes")
+	}
+
+	if err := source.CopyRawTo(ctx, target); err != nil {
+		return errors.WithMessage(err, "can not copy raw documents")
+	}
+
+	sourceCount, err := source.CountRaw(ctx)
+	if err != nil {
+		return err
+	}
+	targetCount, err := target.CountRaw(ctx)
+	if err != nil {
+		return err
+	}
+	if targetCount < sourceCount {
+		return errors.Errorf("target has %d documents, source has %d", targetCount, sourceCount)
+	}
+
+	oldest, err := target.OldestDate(ctx)
+	if err != nil {
+		return err
+	}
+	newest, err := target.NewestDate(ctx)
+	if err != nil {
+		return err
+	}
+	if !oldest.IsZero() {
+		if err := target.RefreshRollup(ctx, oldest, newest); err != nil {
+			return errors.WithMessage(err, "can not rebuild rollup")
+		}
+	}
+	if err := target.InvalidateInsightCache(ctx); err != nil {
+		return err
+	}
+
+	logging.L(ctx).Info("shop migrated", zap.Int64("shopID", shopID), zap.String("from", from), zap.String("to", to), zap.Int64("documents", targetCount))
+
+	if !deleteSource {
+		return nil
+	}
+
+	return source.DropShopData(ctx)
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/pkg/failure"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	PacingOnTrack   = "on_track"
+	PacingOver      = "over_pacing"
+	PacingUnder     = "under_pacing"
+	PacingExhausted = "exhausted"
+)
+
+type PacingOptions struct {
+	// Projected spend above OverPacing or below UnderPacing times the budget raises an alert.
+	OverPacing  float64
+	UnderPacing float64
+	// MinElapsedDays keeps the first days of a month, when projections are noise, from raising alerts.
+	MinElapsedDays int
+}
+
+var DefaultPacingOptions = PacingOptions{
+	OverPacing:     1.1,
+	UnderPacing:    0.8,
+	MinElapsedDays: 3,
+}
+
+// BudgetPacing projects month end spend for every budgeted account and campaign, as of the last requested day.
+func BudgetPacing(ctx context.Context, request repository.RequestInput, repo *repository.MongodbRepository, budgets *repository.BudgetRepository, options PacingOptions) ([]repository.BudgetPacing, error) {
+	_, asOf := request.DateRange()
+	// Daily rows are dated at midnight, a clock time would leave the last day out of the spend
+	asOf = time.Date(asOf.Year(), asOf.Month(), asOf.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := asOf.AddDate(0, 0, 1-asOf.Day())
+
+	shopBudgets, err := budgets.ForMonth(ctx, request.ShopID, monthStart.Format("2006-01"))
+	if err != nil {
+		return nil, errors.WithMessage(err, "can not load budgets")
+	}
+
+	spend := map[string]float64{}
+	names := map[string]string{}
+	for _, level := range []string{repository.LevelAccount, repository.LevelCampaign} {
+		metrics, err := repo.DailyMetrics(ctx, level, monthStart, asOf)
+		if err != nil {
+			return nil, errors.WithMessage(err, "can not load daily spend")
+		}
+		for _, metric := range metrics {
+			key := level + ":" + metric.EntityID
+			spend[key] += metric.Spend
+			names[key] = metric.EntityName
+		}
+	}
+
+	return budgetPacing(shopBudgets, spend, names, asOf, options), nil
+}
+
+// budgetPacing paces the budgets against the month to date spend keyed by level and entity, accounts first and
+// then campaigns, each by entity id.
+func budgetPacing(budgets []repository.Budget, spend map[string]float64, names map[string]string, asOf time.Time, options PacingOptions) []repository.BudgetPacing {
+	monthStart := asOf.AddDate(0, 0, 1-asOf.Day())
+	month := monthStart.Format("2006-01")
+	daysInMonth := monthStart.AddDate(0, 1, -1).Day()
+	elapsed := asOf.Day()
+
+	// A budget set for this month wins over the recurring one of the same entity
+	byEntity := map[string]repository.Budget{}
+	for _, budget := range budgets {
+		key := budget.Level + ":" + budget.EntityID
+		if current, ok := byEntity[key]; ok && current.Month != "" {
+			continue
+		}
+		byEntity[key] = budget
+	}
+
+	var pacing []repository.BudgetPacing
+	for key, budget := range byEntity {
+		if budget.Amount <= 0 {
+			continue
+		}
+
+		monthToDate := spend[key]
+		projected := monthToDate / float64(elapsed) * float64(daysInMonth)
+		expected := budget.Amount * float64(elapsed) / float64(daysInMonth)
+		ratio := projected / budget.Amount
+
+		status := PacingOnTrack
+		switch {
+		case monthToDate >= budget.Amount:
+			status = PacingExhausted
+		case elapsed < options.MinElapsedDays:
+			// too early in the month to judge the pace
+		case ratio > options.OverPacing:
+			status = PacingOver
+		case ratio < options.UnderPacing:
+			status = PacingUnder
+		}
+
+		pacing = append(pacing, repository.BudgetPacing{
+			Level:          budget.Level,
+			EntityID:       budget.EntityID,
+			EntityName:     names[key],
+			Month:          month,
+			AsOf:           asOf,
+			Budget:         budget.Amount,
+			MonthToDate:    monthToDate,
+			Projected:      projected,
+			ExpectedToDate: expected,
+			PacingRatio:    ratio,
+			Status:         status,
+		})
+	}
+
+	sort.Slice(pacing, func(i, j int) bool {
+		if pacing[i].Level != pacing[j].Level {
+			return levelRank[pacing[i].Level] < levelRank[pacing[j].Level]
+		}
+		return pacing[i].EntityID < pacing[j].EntityID
+	})
+
+	return pacing
+}
+
+var levelRank = map[string]int{
+	repository.LevelAccount:  0,
+	repository.LevelCampaign: 1,
+}
+
+// ValidateBudget checks a budget a shop submits. Month is empty for a recurring budget, or YYYY-MM.
+func ValidateBudget(budget repository.Budget) error {
+	var problems []string
+	if _, ok := levelRank[budget.Level]; !ok {
+		problems = append(problems, fmt.Sprintf("level %q is not account or campaign", budget.Level))
+	}
+	if strings.TrimSpace(budget.EntityID) == "" {
+		problems = append(problems, "entity_id is required")
+	}
+	if budget.Amount <= 0 {
+		problems = append(problems, "amount must be positive")
+	}
+	if budget.Month != "" {
+		if _, err := time.Parse("2006-01", budget.Month); err != nil {
+			problems = append(problems, fmt.Sprintf("month %q is not YYYY-MM", budget.Month))
+		}
+	}
+	if len(problems) > 0 {
+		return failure.Validationf("invalid budget: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// PacingAlerts keeps the budgets that are not on track.
+func PacingAlerts(pacing []repository.BudgetPacing) []repository.BudgetPacing {
+	var alerts []repository.BudgetPacing
+	for _, p := range pacing {
+		if p.Status != PacingOnTrack {
+			alerts = append(alerts, p)
+		}
+	}
+
+	return alerts
+}
+
+// SaveBudget validates the budget and stores it.
+func SaveBudget(ctx context.Context, repo *repository.BudgetRepository, budget *repository.Budget) error {
+	if err := ValidateBudget(*budget); err != nil {
+		return err
+	}
+
+	if err := repo.Save(ctx, budget); err != nil {
+		if errors.Is(err, repository.ErrBudgetNotFound) {
+			return failure.Validation(err, "")
+		}
+		return errors.WithMessage(err, "can not save budget")
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/pkg/failure"
+	"testing"
+	"time"
+)
+
+func TestBudgetPacing(t *testing.T) {
+	// The 10th of a 30 day month
+	asOf := time.Date(2024, 4, 10, 0, 0, 0, 0, time.UTC)
+	budgets := []repository.Budget{
+		{Level: repository.LevelCampaign, EntityID: "c2", Amount: 3000},
+		{Level: repository.LevelCampaign, EntityID: "c1", Amount: 3000},
+		{Level: repository.LevelAccount, EntityID: "a1", Amount: 9000},
+		{Level: repository.LevelCampaign, EntityID: "c3", Amount: 500},
+		// The month specific budget wins over the recurring one
+		{Level: repository.LevelCampaign, EntityID: "c4", Amount: 100},
+		{Level: repository.LevelCampaign, EntityID: "c4", Month: "2024-04", Amount: 3000},
+		{Level: repository.LevelCampaign, EntityID: "c5", Amount: 0},
+	}
+	spend := map[string]float64{
+		"account:a1":  3000,
+		"campaign:c1": 1000,
+		"campaign:c2": 1500,
+		"campaign:c3": 600,
+		"campaign:c4": 500,
+	}
+
+	pacing := budgetPacing(budgets, spend, map[string]string{"campaign:c1": "Spring"}, asOf, DefaultPacingOptions)
+
+	want := []struct {
+		level    string
+		entityID string
+		status   string
+	}{
+		{level: repository.LevelAccount, entityID: "a1", status: PacingOnTrack},
+		{level: repository.LevelCampaign, entityID: "c1", status: PacingOnTrack},
+		{level: repository.LevelCampaign, entityID: "c2", status: PacingOver},
+		{level: repository.LevelCampaign, entityID: "c3", status: PacingExhausted},
+		{level: repository.LevelCampaign, entityID: "c4", status: PacingUnder},
+	}
+	if len(pacing) != len(want) {
+		t.Fatalf("got %d budgets, want %d: %+v", len(pacing), len(want), pacing)
+	}
+	for i, w := range want {
+		p := pacing[i]
+		if p.Level != w.level || p.EntityID != w.entityID || p.Status != w.status {
+			t.Errorf("pacing[%d] = %s %s %s, want %s %s %s", i, p.Level, p.EntityID, p.Status, w.level, w.entityID, w.status)
+		}
+	}
+	if pacing[1].EntityName != "Spring" || pacing[1].Projected != 3000 || pacing[1].ExpectedToDate != 1000 || pacing[1].Month != "2024-04" {
+		t.Errorf("unexpected c1 pacing %+v", pacing[1])
+	}
+}
+
+func TestBudgetPacingEarlyInMonth(t *testing.T) {
+	asOf := time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC)
+	budgets := []repository.Budget{{Level: repository.LevelCampaign, EntityID: "c1", Amount: 3000}}
+
+	pacing := budgetPacing(budgets, map[string]float64{"campaign:c1": 1000}, nil, asOf, DefaultPacingOptions)
+	if len(pacing) != 1 || pacing[0].Status != PacingOnTrack {
+		t.Errorf("pacing = %+v, want on track before MinElapsedDays", pacing)
+	}
+}
+
+func TestValidateBudget(t *testing.T) {
+	tests := []struct {
+		name   string
+		budget repository.Budget
+		valid  bool
+	}{
+		{name: "recurring", budget: repository.Budget{Level: repository.LevelAccount, EntityID: "a1", Amount: 100}, valid: true},
+		{name: "monthly", budget: repository.Budget{Level: repository.LevelCampaign, EntityID: "c1", Month: "2024-04", Amount: 100}, valid: true},
+		{name: "ad level", budget: repository.Budget{Level: repository.LevelAd, EntityID: "ad1", Amount: 100}},
+		{name: "no entity", budget: repository.Budget{Level: repository.LevelCampaign, Amount: 100}},
+		{name: "no amount", budget: repository.Budget{Level: repository.LevelCampaign, EntityID: "c1"}},
+		{name: "bad month", budget: repository.Budget{Level: repository.LevelCampaign, EntityID: "c1", Month: "April", Amount: 100}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateBudget(tt.budget)
+			if tt.valid {
+				if err != nil {
+					t.Errorf("ValidateBudget() error = %v", err)
+				}
+				return
+			}
+			if failure.KindOf(err) != failure.KindValidation {
+				t.Errorf("ValidateBudget() error = %v, want a validation failure", err)
+			}
+		})
+	}
+}
+
+func TestPacingAlerts(t *testing.T) {
+	pacing := []repository.BudgetPacing{
+		{EntityID: "a", Status: PacingOnTrack},
+		{EntityID: "b", Status: PacingOver},
+		{EntityID: "c", Status: PacingExhausted},
+	}
+
+	alerts := PacingAlerts(pacing)
+	if len(alerts) != 2 || alerts[0].EntityID != "b" || alerts[1].EntityID != "c" {
+		t.Errorf("PacingAlerts() = %+v", alerts)
+	}
+}
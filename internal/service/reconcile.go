@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+const defaultPlatform = "pinterest"
+
+// ReconcileOrders matches the shop's orders to the ads and campaigns of the result, fills their store verified
+// numbers and returns the totals, including the platform orders that could not be tied to any of them.
+// Orders match on a resolved ad_id first, then utm_content as the ad id, then utm_campaign as campaign id or name.
+func ReconcileOrders(ctx context.Context, request repository.RequestInput, repo *repository.MongodbRepository, result []repository.AccountInsight) (*repository.Reconciliation, error) {
+	since, until := request.DateRange()
+	orders, err := repo.Orders(ctx, since, until)
+	if err != nil {
+		return nil, errors.WithMessage(err, "can not load store orders")
+	}
+
+	platform := request.Platform
+	if platform == "" {
+		platform = defaultPlatform
+	}
+
+	ads := map[string]*repository.VerifiedMetrics{}
+	campaigns := map[string]*repository.VerifiedMetrics{}
+	campaignNames := map[string]string{}
+	WalkLevel(result, repository.LevelAd, func(entity EntityRef, _ *repository.Metrics) {
+		ads[entity.ID] = &repository.VerifiedMetrics{}
+	})
+	WalkLevel(result, repository.LevelCampaign, func(entity EntityRef, _ *repository.Metrics) {
+		campaigns[entity.ID] = &repository.VerifiedMetrics{}
+		campaignNames[strings.ToLower(entity.Name)] = entity.ID
+	})
+
+	reconciliation := &repository.Reconciliation{}
+	for _, order := range orders {
+		if !fromPlatform(order, platform) {
+			continue
+		}
+		reconciliation.Orders++
+		reconciliation.Revenue += order.TotalPrice
+
+		target := matchOrder(order, ads, campaigns, campaignNames)
+		if target == nil {
+			reconciliation.UnmatchedOrders++
+			reconciliation.UnmatchedRevenue += order.TotalPrice
+			reconciliation.UnmatchedOrderIDs = append(reconciliation.UnmatchedOrderIDs, order.OrderID)
+			continue
+		}
+		target.Purchases++
+		target.Revenue += order.TotalPrice
+		reconciliation.MatchedOrders++
+		reconciliation.MatchedRevenue += order.TotalPrice
+	}
+
+	// Roll ads up the tree, campaigns also keep the orders only known at campaign level
+	for i := range result {
+		account := &result[i]
+		accountVerified := &repository.VerifiedMetrics{}
+		for j := range account.Campaigns {
+			campaign := &account.Campaigns[j]
+			campaignVerified := &repository.VerifiedMetrics{}
+			addVerified(campaignVerified, campaigns[campaign.CampaignID])
+			for k := range campaign.AdGroups {
+				adGroup := &campaign.AdGroups[k]
+				adGroupVerified := &repository.VerifiedMetrics{}
+				for l := range adGroup.Ads {
+					ad := &adGroup.Ads[l]
+					ad.StoreVerified = withROAS(ads[ad.AdID], ad.Spend)
+					addVerified(adGroupVerified, ad.StoreVerified)
+				}
+				adGroup.StoreVerified = withROAS(adGroupVerified, adGroup.Spend)
+				addVerified(campaignVerified, adGroupVerified)
+			}
+			campaign.StoreVerified = withROAS(campaignVerified, campaign.Spend)
+			addVerified(accountVerified, campaignVerified)
+		}
+		account.StoreVerified = withROAS(accountVerified, account.Spend)
+
+		reconciliation.PlatformPurchases += account.Purchases
+		reconciliation.PlatformRevenue += account.PurchasesValue
+	}
+
+	return reconciliation, nil
+}
+
+func fromPlatform(order repository.StoreOrder, platform string) bool {
+	if order.AdID != "" || order.CampaignID != "" {
+		return true
+	}
+	if order.UtmSource != "" {
+		return strings.EqualFold(order.UtmSource, platform)
+	}
+
+	return order.ClickID != ""
+}
+
+func matchOrder(order repository.StoreOrder, ads map[string]*repository.VerifiedMetrics, campaigns map[string]*repository.VerifiedMetrics, campaignNames map[string]string) *repository.VerifiedMetrics {
+	for _, adID := range []string{order.AdID, order.UtmContent} {
+		if target, ok := ads[adID]; ok && adID != "" {
+			return target
+		}
+	}
+
+	for _, campaignID := range []string{order.CampaignID, order.UtmCampaign, campaignNames[strings.ToLower(order.UtmCampaign)]} {
+		if target, ok := campaigns[campaignID]; ok && campaignID != "" {
+			return target
+		}
+	}
+
+	return nil
+}
+
+func addVerified(total *repository.VerifiedMetrics, part *repository.VerifiedMetrics) {
+	if part == nil {
+		return
+	}
+	total.Purchases += part.Purchases
+	total.Revenue += part.Revenue
+}
+
+func withROAS(verified *repository.VerifiedMetrics, spend float64) *repository.VerifiedMetrics {
+	if verified == nil {
+		verified = &repository.VerifiedMetrics{}
+	}
+	if spend > 0 {
+		verified.ROAS = verified.Revenue / spend
+	}
+
+	return verified
+}
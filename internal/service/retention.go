@@ -0,0 +1,170 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/internal/storage"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+	"time"
+)
+
+// planRetentionMonths is how many months of raw data each plan keeps, 0 keeps everything.
+var planRetentionMonths = map[string]int{
+	"free":       3,
+	"basic":      12,
+	"pro":        24,
+	"enterprise": 0,
+}
+
+const defaultRetentionMonths = 12
+
+// RetentionCutoff returns the first day of the oldest month the plan keeps raw, zero when nothing expires.
+func RetentionCutoff(plan repository.ShopPlan, now time.Time) time.Time {
+	months, ok := planRetentionMonths[plan.Plan]
+	if !ok {
+		months = defaultRetentionMonths
+	}
+	if plan.RetentionMonths > 0 {
+		months = plan.RetentionMonths
+	}
+	if months == 0 {
+		return time.Time{}
+	}
+
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -months, 0)
+}
+
+// ApplyRetention archives every month of raw data older than the plan keeps. Each month's rollup is refreshed
+// first, it is kept and keeps serving insights for the archived days.
+func ApplyRetention(ctx context.Context, plan repository.ShopPlan, repo *repository.MongodbRepository, plans *repository.PlanRepository, store storage.ObjectStore, mode string, now time.Time) (int64, error) {
+	cutoff := RetentionCutoff(plan, now)
+	if cutoff.IsZero() {
+		return 0, nil
+	}
+
+	oldest, err := repo.OldestDate(ctx)
+	if err != nil {
+		return 0, errors.WithMessage(err, "can not find oldest document")
+	}
+	if oldest.IsZero() || !oldest.Before(cutoff) {
+		return 0, nil
+	}
+
+	var archived int64
+	for month := time.Date(oldest.Year(), oldest.Month(), 1, 0, 0, 0, 0, time.UTC); month.Before(cutoff); month = month.AddDate(0, 1, 0) {
+		if err := repo.RefreshRollup(ctx, month, month.AddDate(0, 1, -1)); err != nil {
+			return archived, errors.WithMessage(err, "can not refresh rollup before archiving")
+		}
+
+		switch mode {
+		case repository.ArchiveCollection:
+			err = repo.ArchiveMonthToCollection(ctx, month)
+		case repository.ArchiveObjectStore:
+			err = archiveMonthToStore(ctx, repo, store, month)
+		default:
+			err = errors.Errorf("unknown archive mode %q", mode)
+		}
+		if err != nil {
+			return archived, errors.WithMessagef(err, "can not archive %s", month.Format("2006-01"))
+		}
+
+		deleted, err := repo.DeleteRawMonth(ctx, month)
+		if err != nil {
+			return archived, errors.WithMessage(err, "can not delete archived documents")
+		}
+		archived += deleted
+		logging.L(ctx).Info("month archived", zap.String("month", month.Format("2006-01")), zap.Int64("documents", deleted))
+	}
+
+	if err := plans.SetArchivedBefore(ctx, plan.ShopID, mode, cutoff); err != nil {
+		return archived, errors.WithMessage(err, "can not record archive boundary")
+	}
+
+	return archived, nil
+}
+
+// archiveMonthToStore writes a month as gzipped extended JSON lines.
+func archiveMonthToStore(ctx context.Context, repo *repository.MongodbRepository, store storage.ObjectStore, month time.Time) error {
+	documents, err := repo.RawMonth(ctx, month)
+	if err != nil {
+		return err
+	}
+	if len(documents) == 0 {
+		return nil
+	}
+
+	return writeArchive(ctx, store, fmt.Sprintf("archives/%d/%s.jsonl.gz", repo.ShopID, month.Format("2006-01")), documents)
+}
+
+// writeArchive merges documents into the archive at key. Documents already in the archive are kept, so rows that
+// arrive for an archived month are added rather than replacing the earlier archive. Only a missing archive
+// starts a new one, any other read failure stops the write.
+func writeArchive(ctx context.Context, store storage.ObjectStore, key string, documents []bson.Raw) error {
+	lines := map[string][]byte{}
+	var order []string
+	existing, err := store.Get(ctx, key)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+	case err != nil:
+		return errors.WithMessage(err, "can not load existing archive")
+	default:
+		if err := readArchive(existing, func(id string, line []byte) {
+			lines[id] = line
+			order = append(order, id)
+		}); err != nil {
+			return errors.WithMessage(err, "can not read existing archive")
+		}
+	}
+
+	for _, document := range documents {
+		id := document.Lookup("_id").String()
+		line, err := bson.MarshalExtJSON(document, true, false)
+		if err != nil {
+			return err
+		}
+		if _, ok := lines[id]; !ok {
+			order = append(order, id)
+		}
+		lines[id] = line
+	}
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	for _, id := range order {
+		if _, err := writer.Write(append(lines[id], '\n')); err != nil {
+			return errors.WithMessage(err, "can not compress archive")
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return errors.WithMessage(err, "can not compress archive")
+	}
+
+	return store.Put(ctx, key, "application/gzip", buf.Bytes())
+}
+
+func readArchive(body []byte, fn func(id string, line []byte)) error {
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var document bson.Raw
+		if err := bson.UnmarshalExtJSON(scanner.Bytes(), true, &document); err != nil {
+			return err
+		}
+		fn(document.Lookup("_id").String(), append([]byte(nil), scanner.Bytes()...))
+	}
+
+	return scanner.Err()
+}
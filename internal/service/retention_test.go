@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/internal/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+	"time"
+)
+
+func TestRetentionCutoff(t *testing.T) {
+	now := time.Date(2024, 4, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		plan repository.ShopPlan
+		want time.Time
+	}{
+		{name: "free", plan: repository.ShopPlan{Plan: "free"}, want: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "unknown plan keeps the default", plan: repository.ShopPlan{Plan: "trial"}, want: time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "shop override", plan: repository.ShopPlan{Plan: "free", RetentionMonths: 6}, want: time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "enterprise keeps everything", plan: repository.ShopPlan{Plan: "enterprise"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := RetentionCutoff(test.plan, now); !got.Equal(test.want) {
+				t.Errorf("RetentionCutoff() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+// failingStore fails every Get with err and remembers what was put.
+type failingStore struct {
+	storage.ObjectStore
+	err error
+	put []byte
+}
+
+func (f *failingStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return nil, f.err
+}
+
+func (f *failingStore) Put(ctx context.Context, key string, contentType string, body []byte) error {
+	f.put = body
+	return nil
+}
+
+func archiveDocument(t *testing.T, id string, spend float64) bson.Raw {
+	raw, err := bson.Marshal(bson.D{{Key: "_id", Value: id}, {Key: "spend", Value: spend}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return raw
+}
+
+func TestWriteArchive(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		getErr error
+		writes bool
+	}{
+		{name: "missing archive starts a new one", getErr: storage.ErrNotFound, writes: true},
+		{name: "wrapped missing archive", getErr: fmt.Errorf("s3: %w", storage.ErrNotFound), writes: true},
+		{name: "read failure keeps the archive", getErr: errors.New("access denied"), writes: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := &failingStore{err: test.getErr}
+			err := writeArchive(ctx, store, "archives/1/2024-01.jsonl.gz", []bson.Raw{archiveDocument(t, "a", 1)})
+			if (err == nil) != test.writes {
+				t.Fatalf("writeArchive() error = %v, want write %v", err, test.writes)
+			}
+			if (store.put != nil) != test.writes {
+				t.Errorf("archive put = %v, want %v", store.put != nil, test.writes)
+			}
+		})
+	}
+}
+
+func TestWriteArchiveMerges(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewLocalStore(t.TempDir())
+	key := "archives/1/2024-01.jsonl.gz"
+
+	if err := writeArchive(ctx, store, key, []bson.Raw{archiveDocument(t, "a", 1), archiveDocument(t, "b", 2)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeArchive(ctx, store, key, []bson.Raw{archiveDocument(t, "b", 3), archiveDocument(t, "c", 4)}); err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spend := map[string]float64{}
+	var order []string
+	if err := readArchive(body, func(id string, line []byte) {
+		var document struct {
+			ID    string  `bson:"_id"`
+			Spend float64 `bson:"spend"`
+		}
+		if err := bson.UnmarshalExtJSON(line, true, &document); err != nil {
+			t.Fatal(err)
+		}
+		spend[document.ID] = document.Spend
+		order = append(order, document.ID)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(order) != 3 || order[0] != "a" || order[1] != "b" || order[2] != "c" {
+		t.Errorf("archive order = %v, want a, b, c", order)
+	}
+	if spend["a"] != 1 || spend["b"] != 3 || spend["c"] != 4 {
+		t.Errorf("archive spend = %v, want b replaced by the later write", spend)
+	}
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/pkg/errors"
+)
+
+// RefreshRollup rebuilds the daily rollups over the requested range, used to backfill a shop.
+func RefreshRollup(ctx context.Context, request repository.RequestInput, repo *repository.MongodbRepository) error {
+	since, until := request.DateRange()
+	if err := repo.RefreshRollup(ctx, since, until); err != nil {
+		return errors.WithMessage(err, "can not refresh rollup")
+	}
+
+	return invalidateCache(ctx, repo)
+}
+
+// onRowsWritten brings the rollups up to date with rows just written to the shop collection. The result cache is
+// dropped by the write itself.
+func onRowsWritten(ctx context.Context, repo *repository.MongodbRepository, rows []repository.AdRow) error {
+	if !repo.UseRollups || len(rows) == 0 {
+		return nil
+	}
+
+	since, until := rows[0].Date, rows[0].Date
+	for _, row := range rows[1:] {
+		if row.Date.Before(since) {
+			since = row.Date
+		}
+		if row.Date.After(until) {
+			until = row.Date
+		}
+	}
+
+	if err := repo.RefreshRollup(ctx, since, until); err != nil {
+		return errors.WithMessage(err, "can not refresh rollup")
+	}
+
+	return nil
+}
+
+func invalidateCache(ctx context.Context, repo *repository.MongodbRepository) error {
+	if err := repo.InvalidateInsightCache(ctx); err != nil {
+		return errors.WithMessage(err, "can not invalidate insight cache")
+	}
+
+	return nil
+}
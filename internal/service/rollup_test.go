@@ -0,0 +1,33 @@
+package service
+
+import (
+	"context"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestOnRowsWrittenSkipsRollups(t *testing.T) {
+	rows := []repository.AdRow{
+		{AdID: "1", Date: time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC)},
+		{AdID: "1", Date: time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+	}
+
+	tests := []struct {
+		name string
+		repo *repository.MongodbRepository
+		rows []repository.AdRow
+	}{
+		{name: "rollups disabled", repo: &repository.MongodbRepository{ShopID: 12}, rows: rows},
+		{name: "no rows", repo: &repository.MongodbRepository{ShopID: 12, UseRollups: true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The repository has no collections, any rollup write would panic
+			if err := onRowsWritten(context.Background(), test.repo, test.rows); err != nil {
+				t.Errorf("onRowsWritten() error = %v", err)
+			}
+		})
+	}
+}
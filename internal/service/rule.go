@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	ActionNotify         = "notify"
+	ActionPauseCandidate = "pause_candidate"
+)
+
+const defaultCooldown = 24 * time.Hour
+
+// EvaluateRules runs the shop's enabled rules over the window ending on the job's last day.
+// Rules sharing a lookback share one aggregation; firings inside their cooldown are dropped. The returned
+// firings start their cooldown at now, ReleaseFirings ends it again when they can not be notified.
+func EvaluateRules(ctx context.Context, request repository.RequestInput, repo *repository.MongodbRepository, rules *repository.RuleRepository, now time.Time) ([]repository.RuleFiring, error) {
+	shopRules, err := rules.Enabled(ctx, request.ShopID)
+	if err != nil {
+		return nil, errors.WithMessage(err, "can not load alert rules")
+	}
+
+	_, until := request.DateRange()
+	windows := map[int][]repository.AccountInsight{}
+
+	var firings []repository.RuleFiring
+	for _, rule := range shopRules {
+		if err := validateRule(rule); err != nil {
+			logging.L(ctx).Warn("skip invalid alert rule", zap.String("ruleID", rule.ID.Hex()), zap.Error(err))
+			continue
+		}
+
+		lookback := rule.LookbackDays
+		if lookback < 1 {
+			lookback = 1
+		}
+		since := until.AddDate(0, 0, 1-lookback)
+
+		result, ok := windows[lookback]
+		if !ok {
+			windowRequest := request
+			windowRequest.Since, windowRequest.Until = since, until
+			result, err = GetInsights(ctx, windowRequest, repo)
+			if err != nil {
+				return nil, err
+			}
+			windows[lookback] = result
+		}
+
+		cooldown := time.Duration(rule.CooldownHours) * time.Hour
+		if cooldown <= 0 {
+			cooldown = defaultCooldown
+		}
+
+		var matched []repository.RuleFiring
+		WalkLevel(result, rule.Level, func(entity EntityRef, metrics *repository.Metrics) {
+			values, ok := matchRule(rule, *metrics)
+			if !ok {
+				return
+			}
+			matched = append(matched, repository.RuleFiring{
+				RuleID:     rule.ID.Hex(),
+				RuleName:   rule.Name,
+				Action:     rule.Action,
+				Level:      entity.Level,
+				EntityID:   entity.ID,
+				EntityName: entity.Name,
+				AccountID:  entity.AccountID,
+				CampaignID: entity.CampaignID,
+				Since:      since,
+				Until:      until,
+				Values:     values,
+			})
+		})
+
+		for _, firing := range matched {
+			claimed, err := rules.ClaimFiring(ctx, rule.ID, firing.EntityID, now, cooldown)
+			if err != nil {
+				return nil, errors.WithMessage(err, "can not record rule firing")
+			}
+			if claimed {
+				firings = append(firings, firing)
+			}
+		}
+	}
+
+	return firings, nil
+}
+
+// ReleaseFirings ends the cooldowns EvaluateRules started at now, for firings whose notification was not sent.
+func ReleaseFirings(ctx context.Context, rules *repository.RuleRepository, firings []repository.RuleFiring, now time.Time) error {
+	for _, firing := range firings {
+		ruleID, err := primitive.ObjectIDFromHex(firing.RuleID)
+		if err != nil {
+			return errors.WithMessage(err, "invalid rule id")
+		}
+		if err := rules.ReleaseFiring(ctx, ruleID, firing.EntityID, now); err != nil {
+			return errors.WithMessage(err, "can not release rule firing")
+		}
+	}
+
+	return nil
+}
+
+func validateRule(rule repository.AlertRule) error {
+	switch rule.Level {
+	case repository.LevelAccount, repository.LevelCampaign, repository.LevelAdGroup, repository.LevelAd:
+	default:
+		return errors.Errorf("unknown rule level %q", rule.Level)
+	}
+	if len(rule.Conditions) == 0 {
+		return errors.New("rule has no conditions")
+	}
+	for _, condition := range rule.Conditions {
+		if _, ok := MetricValue(repository.Metrics{}, condition.Metric); !ok {
+			return errors.Errorf("unknown metric %q", condition.Metric)
+		}
+		if _, ok := operators[condition.Operator]; !ok {
+			return errors.Errorf("unknown operator %q", condition.Operator)
+		}
+	}
+
+	return nil
+}
+
+var operators = map[string]func(float64, float64) bool{
+	"gt":  func(a, b float64) bool { return a > b },
+	"gte": func(a, b float64) bool { return a >= b },
+	"lt":  func(a, b float64) bool { return a < b },
+	"lte": func(a, b float64) bool { return a <= b },
+	"eq":  func(a, b float64) bool { return a == b },
+}
+
+func matchRule(rule repository.AlertRule, metrics repository.Metrics) (map[string]float64, bool) {
+	values := map[string]float64{}
+	for _, condition := range rule.Conditions {
+		value, _ := MetricValue(metrics, condition.Metric)
+		if !operators[condition.Operator](value, condition.Value) {
+			return nil, false
+		}
+		values[condition.Metric] = value
+	}
+
+	return values, true
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"testing"
+)
+
+func TestValidateRule(t *testing.T) {
+	condition := repository.RuleCondition{Metric: "spend", Operator: "gt", Value: 100}
+
+	tests := []struct {
+		name    string
+		rule    repository.AlertRule
+		wantErr bool
+	}{
+		{name: "valid", rule: repository.AlertRule{Level: repository.LevelCampaign, Conditions: []repository.RuleCondition{condition}}},
+		{name: "unknown level", rule: repository.AlertRule{Level: "shop", Conditions: []repository.RuleCondition{condition}}, wantErr: true},
+		{name: "no conditions", rule: repository.AlertRule{Level: repository.LevelAd}, wantErr: true},
+		{
+			name:    "unknown metric",
+			rule:    repository.AlertRule{Level: repository.LevelAd, Conditions: []repository.RuleCondition{{Metric: "profit", Operator: "gt"}}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown operator",
+			rule:    repository.AlertRule{Level: repository.LevelAd, Conditions: []repository.RuleCondition{{Metric: "spend", Operator: "ne"}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateRule(tt.rule); (err != nil) != tt.wantErr {
+				t.Errorf("validateRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatchRule(t *testing.T) {
+	metrics := repository.Metrics{Spend: 150, Purchases: 0, ROAS: 0.5, CTR: 1.2}
+
+	tests := []struct {
+		name       string
+		conditions []repository.RuleCondition
+		want       bool
+	}{
+		{name: "all hold", conditions: []repository.RuleCondition{{Metric: "spend", Operator: "gte", Value: 150}, {Metric: "purchases", Operator: "eq", Value: 0}}, want: true},
+		{name: "one fails", conditions: []repository.RuleCondition{{Metric: "spend", Operator: "gt", Value: 100}, {Metric: "roas", Operator: "gt", Value: 1}}},
+		{name: "below", conditions: []repository.RuleCondition{{Metric: "ctr", Operator: "lt", Value: 1.5}}, want: true},
+		{name: "boundary", conditions: []repository.RuleCondition{{Metric: "ctr", Operator: "lte", Value: 1.2}}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, ok := matchRule(repository.AlertRule{Conditions: tt.conditions}, metrics)
+			if ok != tt.want {
+				t.Fatalf("matchRule() = %v, want %v", ok, tt.want)
+			}
+			if ok && len(values) != len(tt.conditions) {
+				t.Errorf("matchRule() values = %v, want one per condition", values)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/minhlong/go-aws-boilerplate/internal/funcservice"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/internal/schema"
+	"github.com/minhlong/go-aws-boilerplate/pkg/failure"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+const (
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+)
+
+// NextRun returns the first run strictly after the given time, in the schedule's timezone.
+func NextRun(schedule repository.ReportSchedule, after time.Time) (time.Time, error) {
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		return time.Time{}, errors.WithMessage(err, "invalid schedule timezone")
+	}
+
+	local := after.In(loc)
+	candidate := time.Date(local.Year(), local.Month(), local.Day(), schedule.Hour, 0, 0, 0, loc)
+
+	switch schedule.Frequency {
+	case FrequencyDaily:
+		if !candidate.After(after) {
+			candidate = candidate.AddDate(0, 0, 1)
+		}
+	case FrequencyWeekly:
+		candidate = candidate.AddDate(0, 0, (int(schedule.Weekday)-int(candidate.Weekday())+7)%7)
+		if !candidate.After(after) {
+			candidate = candidate.AddDate(0, 0, 7)
+		}
+	case FrequencyMonthly:
+		if schedule.MonthDay < 1 || schedule.MonthDay > 28 {
+			return time.Time{}, errors.Errorf("month day %d is out of range", schedule.MonthDay)
+		}
+		candidate = time.Date(local.Year(), local.Month(), schedule.MonthDay, schedule.Hour, 0, 0, 0, loc)
+		if !candidate.After(after) {
+			candidate = candidate.AddDate(0, 1, 0)
+		}
+	default:
+		return time.Time{}, errors.Errorf("unknown schedule frequency %q", schedule.Frequency)
+	}
+
+	return candidate.UTC(), nil
+}
+
+// ScheduledRequest builds the insight job for one run of a schedule.
+func ScheduledRequest(schedule repository.ReportSchedule, now time.Time) (*repository.RequestInput, error) {
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		return nil, errors.WithMessage(err, "invalid schedule timezone")
+	}
+
+	since, until, err := ResolveDatePreset(schedule.DatePreset, now, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	export := schedule.Export
+
+	return &repository.RequestInput{
+		Version:       repository.RequestVersion,
+		ShopID:        schedule.ShopID,
+		ShopCurrency:  schedule.ShopCurrency,
+		ShopName:      schedule.ShopName,
+		Accounts:      schedule.Accounts,
+		Platform:      schedule.Platform,
+		Name:          schedule.Name,
+		StartSyncTime: now,
+		Since:         since,
+		Until:         until,
+		Export:        &export,
+		ScheduleID:    schedule.ID.Hex(),
+		Recipients:    schedule.Recipients,
+	}, nil
+}
+
+// RunDueSchedules enqueues an insight job for every schedule whose next run has passed. A run is claimed before it
+// is enqueued so overlapping invocations never send it twice, and released again when the enqueue fails.
+func RunDueSchedules(ctx context.Context, repo *repository.ScheduleRepository, now time.Time) (int, error) {
+	schedules, err := repo.Due(ctx, now)
+	if err != nil {
+		return 0, errors.WithMessage(err, "can not load due schedules")
+	}
+
+	enqueued := 0
+	for _, schedule := range schedules {
+		nextRunAt, err := NextRun(schedule, now)
+		if err != nil {
+			logging.L(ctx).Error("can not compute next run", zap.String("scheduleID", schedule.ID.Hex()), zap.Error(err))
+			continue
+		}
+
+		request, err := ScheduledRequest(schedule, now)
+		if err != nil {
+			logging.L(ctx).Error("can not build scheduled request", zap.String("scheduleID", schedule.ID.Hex()), zap.Error(err))
+			continue
+		}
+
+		claimed, err := repo.Claim(ctx, schedule, now, nextRunAt)
+		if err != nil {
+			return enqueued, errors.WithMessage(err, "can not claim schedule")
+		}
+		if !claimed {
+			continue
+		}
+
+		if err := funcservice.SendInsightJob(ctx, *request); err != nil {
+			if errR := repo.Release(ctx, schedule, nextRunAt); errR != nil {
+				logging.L(ctx).Error("can not release schedule", zap.String("scheduleID", schedule.ID.Hex()), zap.Error(errR))
+			}
+			return enqueued, err
+		}
+		enqueued++
+	}
+
+	return enqueued, nil
+}
+
+// ValidateSchedule checks a schedule a shop submits, including the insight job it would enqueue.
+func ValidateSchedule(schedule repository.ReportSchedule, now time.Time) error {
+	var problems []string
+	if schedule.Hour < 0 || schedule.Hour > 23 {
+		problems = append(problems, fmt.Sprintf("hour %d is out of range", schedule.Hour))
+	}
+	if schedule.Weekday < time.Sunday || schedule.Weekday > time.Saturday {
+		problems = append(problems, fmt.Sprintf("weekday %d is out of range", schedule.Weekday))
+	}
+	if _, err := NextRun(schedule, now); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if request, err := ScheduledRequest(schedule, now); err != nil {
+		problems = append(problems, err.Error())
+	} else if err := schema.Validate(*request); err != nil {
+		problems = append(problems, failure.ReasonOf(err))
+	}
+	if len(problems) > 0 {
+		return failure.Validationf("invalid schedule: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// SaveSchedule validates the schedule and stores it with its next run.
+func SaveSchedule(ctx context.Context, repo *repository.ScheduleRepository, schedule *repository.ReportSchedule, now time.Time) error {
+	if err := ValidateSchedule(*schedule, now); err != nil {
+		return err
+	}
+
+	nextRunAt, err := NextRun(*schedule, now)
+	if err != nil {
+		return err
+	}
+	schedule.NextRunAt = nextRunAt
+	schedule.LastRunAt = time.Time{}
+
+	if err := repo.Save(ctx, schedule); err != nil {
+		if errors.Is(err, repository.ErrScheduleNotFound) {
+			return failure.Validation(err, "")
+		}
+		return errors.WithMessage(err, "can not save schedule")
+	}
+
+	return nil
+}
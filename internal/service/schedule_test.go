@@ -0,0 +1,172 @@
+package service
+
+import (
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/pkg/failure"
+	"testing"
+	"time"
+)
+
+func TestNextRun(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, _ := time.Parse(time.RFC3339, value)
+		return parsed
+	}
+
+	tests := []struct {
+		name     string
+		schedule repository.ReportSchedule
+		after    time.Time
+		want     time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "daily later today",
+			schedule: repository.ReportSchedule{Frequency: FrequencyDaily, Hour: 9, Timezone: "UTC"},
+			after:    at("2024-03-15T08:00:00Z"),
+			want:     at("2024-03-15T09:00:00Z"),
+		},
+		{
+			name:     "daily at the hour moves on",
+			schedule: repository.ReportSchedule{Frequency: FrequencyDaily, Hour: 9, Timezone: "UTC"},
+			after:    at("2024-03-15T09:00:00Z"),
+			want:     at("2024-03-16T09:00:00Z"),
+		},
+		{
+			name:     "daily in timezone",
+			schedule: repository.ReportSchedule{Frequency: FrequencyDaily, Hour: 9, Timezone: "Asia/Ho_Chi_Minh"},
+			after:    at("2024-03-15T03:00:00Z"),
+			want:     at("2024-03-16T02:00:00Z"),
+		},
+		{
+			name:     "daily across daylight saving",
+			schedule: repository.ReportSchedule{Frequency: FrequencyDaily, Hour: 9, Timezone: "America/New_York"},
+			after:    at("2024-03-09T15:00:00Z"),
+			want:     at("2024-03-10T13:00:00Z"),
+		},
+		{
+			name:     "weekly later this week",
+			schedule: repository.ReportSchedule{Frequency: FrequencyWeekly, Weekday: time.Monday, Hour: 6, Timezone: "UTC"},
+			after:    at("2024-03-15T12:00:00Z"),
+			want:     at("2024-03-18T06:00:00Z"),
+		},
+		{
+			name:     "weekly same day passed",
+			schedule: repository.ReportSchedule{Frequency: FrequencyWeekly, Weekday: time.Friday, Hour: 6, Timezone: "UTC"},
+			after:    at("2024-03-15T12:00:00Z"),
+			want:     at("2024-03-22T06:00:00Z"),
+		},
+		{
+			name:     "monthly next month",
+			schedule: repository.ReportSchedule{Frequency: FrequencyMonthly, MonthDay: 1, Hour: 0, Timezone: "UTC"},
+			after:    at("2024-03-15T12:00:00Z"),
+			want:     at("2024-04-01T00:00:00Z"),
+		},
+		{
+			name:     "monthly this month",
+			schedule: repository.ReportSchedule{Frequency: FrequencyMonthly, MonthDay: 28, Hour: 0, Timezone: "UTC"},
+			after:    at("2024-02-15T12:00:00Z"),
+			want:     at("2024-02-28T00:00:00Z"),
+		},
+		{
+			name:     "monthly day out of range",
+			schedule: repository.ReportSchedule{Frequency: FrequencyMonthly, MonthDay: 31, Timezone: "UTC"},
+			after:    at("2024-03-15T12:00:00Z"),
+			wantErr:  true,
+		},
+		{
+			name:     "unknown frequency",
+			schedule: repository.ReportSchedule{Frequency: "hourly", Timezone: "UTC"},
+			after:    at("2024-03-15T12:00:00Z"),
+			wantErr:  true,
+		},
+		{
+			name:     "unknown timezone",
+			schedule: repository.ReportSchedule{Frequency: FrequencyDaily, Timezone: "Mars/Base"},
+			after:    at("2024-03-15T12:00:00Z"),
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NextRun(tt.schedule, tt.after)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NextRun() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("NextRun() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSchedule(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	valid := repository.ReportSchedule{
+		ShopID:       12,
+		ShopCurrency: "USD",
+		Frequency:    FrequencyWeekly,
+		Weekday:      time.Monday,
+		Hour:         8,
+		Timezone:     "Europe/Paris",
+		DatePreset:   PresetLast7d,
+		Export:       repository.Export{Format: "csv", Layout: "flat"},
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*repository.ReportSchedule)
+		valid  bool
+	}{
+		{name: "valid", modify: func(*repository.ReportSchedule) {}, valid: true},
+		{name: "hour", modify: func(s *repository.ReportSchedule) { s.Hour = 24 }},
+		{name: "weekday", modify: func(s *repository.ReportSchedule) { s.Weekday = 7 }},
+		{name: "frequency", modify: func(s *repository.ReportSchedule) { s.Frequency = "hourly" }},
+		{name: "timezone", modify: func(s *repository.ReportSchedule) { s.Timezone = "Paris" }},
+		{name: "preset", modify: func(s *repository.ReportSchedule) { s.DatePreset = "last_week" }},
+		{name: "export format", modify: func(s *repository.ReportSchedule) { s.Export.Format = "pdf" }},
+		{name: "currency", modify: func(s *repository.ReportSchedule) { s.ShopCurrency = "DOLLAR" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule := valid
+			tt.modify(&schedule)
+			err := ValidateSchedule(schedule, now)
+			if tt.valid {
+				if err != nil {
+					t.Errorf("ValidateSchedule() error = %v", err)
+				}
+				return
+			}
+			if failure.KindOf(err) != failure.KindValidation {
+				t.Errorf("ValidateSchedule() error = %v, want a validation failure", err)
+			}
+		})
+	}
+}
+
+func TestScheduledRequest(t *testing.T) {
+	now := time.Date(2024, 3, 15, 23, 30, 0, 0, time.UTC)
+	schedule := repository.ReportSchedule{
+		ShopID:     12,
+		Timezone:   "Asia/Tokyo",
+		DatePreset: PresetYesterday,
+		Export:     repository.Export{Format: "xlsx"},
+		Recipients: []string{"owner@example.com"},
+	}
+
+	request, err := ScheduledRequest(schedule, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// It is already the 16th in Tokyo
+	want := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	if !request.Since.Equal(want) || !request.Until.Equal(want) {
+		t.Errorf("range = %s..%s, want %s", request.Since, request.Until, want)
+	}
+	if request.Version != repository.RequestVersion || request.ShopID != 12 || request.Export.Format != "xlsx" || len(request.Recipients) != 1 {
+		t.Errorf("unexpected request %+v", request)
+	}
+}
@@ -3,13 +3,24 @@ package service
 import (
 	"context"
 	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/pkg/failure"
 )
 
-func GetInsights(ctx context.Context, request repository.RequestInput, repo *repository.MongodbRepository) ([]repository.Account, error) {
+func GetInsights(ctx context.Context, request repository.RequestInput, repo *repository.MongodbRepository) ([]repository.AccountInsight, error) {
+	if request.Attribution != nil {
+		if err := ValidateAttribution(*request.Attribution); err != nil {
+			return nil, failure.Validation(err, "invalid attribution options")
+		}
+	}
+
 	result, err := repo.Insights(ctx, request)
 	if err != nil {
 		return nil, err
 	}
 
+	if request.Attribution != nil {
+		ApplyAttribution(result, *request.Attribution)
+	}
+
 	return result, nil
 }
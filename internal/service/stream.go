@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"github.com/minhlong/go-aws-boilerplate/internal/funcservice"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type StreamOptions struct {
+	// Worker names the resume token, workers sharing a name continue each other's position.
+	Worker string
+	// FlushInterval batches changes so a burst of writes for one shop results in a single update.
+	FlushInterval time.Duration
+	// SubscriptionRefresh is how often the list of subscribed shops is reloaded.
+	SubscriptionRefresh time.Duration
+}
+
+func DefaultStreamOptions() StreamOptions {
+	return StreamOptions{
+		Worker:              "insights-live",
+		FlushInterval:       2 * time.Second,
+		SubscriptionRefresh: 30 * time.Second,
+	}
+}
+
+// maxPushAttempts is how many flushes a shop's changes are pushed in before they are dropped, so one failing
+// shop does not hold the resume token back for good.
+const maxPushAttempts = 5
+
+// pendingChanges collects the ads and days of a shop touched since the last flush, and the failed pushes of them.
+type pendingChanges struct {
+	adIDs    map[string]bool
+	dates    map[time.Time]bool
+	attempts int
+}
+
+// RunStreamWorker tails the shop collections and pushes the recomputed day totals of changed ads to subscribed shops
+// until the context is cancelled. The resume token is saved after a flush that pushed every shop, so a restart
+// does not miss changes; failed shops stay pending and are pushed again with the next flush.
+func RunStreamWorker(ctx context.Context, opts StreamOptions) error {
+	streams, err := repository.NewStreamRepository(ctx)
+	if err != nil {
+		return errors.WithMessage(err, "can not init stream repository")
+	}
+
+	token, err := streams.LoadResumeToken(ctx, opts.Worker)
+	if err != nil {
+		return errors.WithMessage(err, "can not load resume token")
+	}
+
+	stream, err := streams.WatchShopData(ctx, token)
+	if err != nil {
+		return errors.WithMessage(err, "can not watch shop collections")
+	}
+	defer stream.Close(context.Background())
+
+	var (
+		pending     = map[int64]*pendingChanges{}
+		subscribed  map[int64]bool
+		refreshedAt time.Time
+		flushedAt   = time.Now()
+	)
+	flush := func(ctx context.Context) error {
+		pending = pushLiveUpdates(ctx, pending, pushShopChanges)
+		flushedAt = time.Now()
+		if len(pending) > 0 {
+			return nil
+		}
+
+		if token := stream.ResumeToken(); token != nil {
+			if err := streams.SaveResumeToken(ctx, opts.Worker, token); err != nil {
+				return errors.WithMessage(err, "can not save resume token")
+			}
+		}
+
+		return nil
+	}
+
+	for {
+		if time.Since(refreshedAt) >= opts.SubscriptionRefresh {
+			shops, errS := streams.SubscribedShops(ctx, time.Now())
+			if errS != nil && ctx.Err() == nil {
+				return errors.WithMessage(errS, "can not load subscriptions")
+			}
+			if errS == nil {
+				subscribed, refreshedAt = shops, time.Now()
+			}
+		}
+
+		if stream.TryNext(ctx) {
+			var event repository.ChangeEvent
+			if err := stream.Decode(&event); err != nil {
+				logging.L(ctx).Warn("can not decode change event", zap.Error(err))
+			} else if shopID := changeShopID(event); subscribed[shopID] && event.FullDocument != nil {
+				changes, ok := pending[shopID]
+				if !ok {
+					changes = &pendingChanges{adIDs: map[string]bool{}, dates: map[time.Time]bool{}}
+					pending[shopID] = changes
+				}
+				changes.adIDs[event.FullDocument.AdID] = true
+				changes.dates[event.FullDocument.Date] = true
+			}
+		}
+
+		if ctx.Err() != nil {
+			// Push what was collected before stopping, the context is gone so a fresh one is used
+			return flush(context.Background())
+		}
+		if err := stream.Err(); err != nil {
+			return errors.WithMessage(err, "change stream failed")
+		}
+
+		if time.Since(flushedAt) >= opts.FlushInterval {
+			if err := flush(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// pushLiveUpdates pushes the touched ad days per shop and returns the shops whose push failed, to retry with the
+// next flush. A failing shop is logged and does not hold back the others, after maxPushAttempts its changes are
+// dropped.
+func pushLiveUpdates(ctx context.Context, pending map[int64]*pendingChanges, push func(ctx context.Context, shopID int64, changes *pendingChanges) error) map[int64]*pendingChanges {
+	failed := map[int64]*pendingChanges{}
+	for shopID, changes := range pending {
+		ctx := logging.With(ctx, zap.Int64("shopID", shopID))
+
+		err := push(ctx, shopID, changes)
+		if err == nil {
+			continue
+		}
+
+		changes.attempts++
+		if changes.attempts >= maxPushAttempts {
+			logging.L(ctx).Error("dropping live insights after repeated failures", zap.Int("attempts", changes.attempts), zap.Error(err))
+			continue
+		}
+		logging.L(ctx).Error("can not push live insights", zap.Int("attempts", changes.attempts), zap.Error(err))
+		failed[shopID] = changes
+	}
+
+	return failed
+}
+
+// pushShopChanges recomputes the touched ad days of a shop and sends them.
+func pushShopChanges(ctx context.Context, shopID int64, changes *pendingChanges) error {
+	repo, err := repository.NewMongoDb(ctx, shopID)
+	if err != nil {
+		return errors.WithMessage(err, "can not init mongo connection")
+	}
+
+	adIDs := make([]string, 0, len(changes.adIDs))
+	for adID := range changes.adIDs {
+		adIDs = append(adIDs, adID)
+	}
+	dates := make([]time.Time, 0, len(changes.dates))
+	for date := range changes.dates {
+		dates = append(dates, date)
+	}
+
+	metrics, err := repo.AdDayMetrics(ctx, adIDs, dates)
+	if err != nil {
+		return errors.WithMessage(err, "can not aggregate changed ads")
+	}
+
+	if err := funcservice.SendLiveInsightNotification(ctx, shopID, metrics); err != nil {
+		return errors.WithMessage(err, "can not send live insights")
+	}
+
+	return nil
+}
+
+// changeShopID takes the shop from the per shop collection name, or from the document in the shared layout.
+func changeShopID(event repository.ChangeEvent) int64 {
+	if _, suffix, ok := strings.Cut(event.Namespace.Collection, "_"); ok {
+		shopID, _ := strconv.ParseInt(suffix, 10, 64)
+		return shopID
+	}
+	if event.FullDocument != nil {
+		return event.FullDocument.ShopID
+	}
+
+	return 0
+}
+
+// SubscribeLiveInsights keeps live updates flowing to the shop for the given duration.
+func SubscribeLiveInsights(ctx context.Context, repo *repository.MongodbRepository, duration time.Duration) error {
+	if err := repo.Subscribe(ctx, time.Now().Add(duration)); err != nil {
+		return errors.WithMessage(err, "can not subscribe to live insights")
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPushLiveUpdates(t *testing.T) {
+	changes := func(attempts int) *pendingChanges {
+		return &pendingChanges{
+			adIDs:    map[string]bool{"ad1": true},
+			dates:    map[time.Time]bool{time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC): true},
+			attempts: attempts,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		pending map[int64]*pendingChanges
+		failing map[int64]bool
+		want    map[int64]int
+	}{
+		{
+			name:    "every shop pushed",
+			pending: map[int64]*pendingChanges{1: changes(0), 2: changes(0)},
+			want:    map[int64]int{},
+		},
+		{
+			name:    "failed shop stays pending",
+			pending: map[int64]*pendingChanges{1: changes(0), 2: changes(0)},
+			failing: map[int64]bool{2: true},
+			want:    map[int64]int{2: 1},
+		},
+		{
+			name:    "retried shop that succeeds is done",
+			pending: map[int64]*pendingChanges{2: changes(3)},
+			want:    map[int64]int{},
+		},
+		{
+			name:    "shop failing too often is dropped",
+			pending: map[int64]*pendingChanges{1: changes(maxPushAttempts - 1), 2: changes(1)},
+			failing: map[int64]bool{1: true, 2: true},
+			want:    map[int64]int{2: 2},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pushed := map[int64]bool{}
+			failed := pushLiveUpdates(context.Background(), test.pending, func(ctx context.Context, shopID int64, changes *pendingChanges) error {
+				pushed[shopID] = true
+				if test.failing[shopID] {
+					return errors.New("send failed")
+				}
+				return nil
+			})
+
+			if len(pushed) != len(test.pending) {
+				t.Errorf("pushed %v, want every pending shop", pushed)
+			}
+			if len(failed) != len(test.want) {
+				t.Fatalf("pending after push = %v, want %v", failed, test.want)
+			}
+			for shopID, attempts := range test.want {
+				changes, ok := failed[shopID]
+				if !ok || changes.attempts != attempts {
+					t.Errorf("shop %d pending = %v, want %d attempts", shopID, changes, attempts)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"github.com/minhlong/go-aws-boilerplate/internal/platform"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"time"
+)
+
+type SyncOptions struct {
+	// RefreshDays are the most recent days that keep being refetched, platforms restate them as conversions land.
+	RefreshDays int
+	// MaxAge is how old a recent day may get before it is refetched.
+	MaxAge time.Duration
+}
+
+var DefaultSyncOptions = SyncOptions{
+	RefreshDays: 3,
+	MaxAge:      6 * time.Hour,
+}
+
+// SyncPlatformData fetches the requested days each account is missing, or holds stale numbers for, from the ad
+// platform with the request's access token and stores them before the aggregation runs.
+func SyncPlatformData(ctx context.Context, request repository.RequestInput, repo *repository.MongodbRepository, client platform.Client, now time.Time, options SyncOptions) (int, error) {
+	since, until := request.DateRange()
+
+	written := 0
+	for _, account := range request.Accounts {
+		freshness, err := repo.DayFreshness(ctx, account.ID, since, until)
+		if err != nil {
+			return written, errors.WithMessage(err, "can not load day freshness")
+		}
+
+		first, last := daysToFetch(freshness, since, until, now, options)
+		if first.IsZero() {
+			continue
+		}
+
+		rows, err := client.DailyRows(ctx, account.ID, first, last)
+		if err != nil {
+			return written, errors.WithMessagef(err, "can not fetch account %s", account.ID)
+		}
+		writes := make([]repository.AdRowWrite, len(rows))
+		for i := range rows {
+			rows[i].UpdatedAt = now
+			writes[i] = repository.AdRowWrite{Row: rows[i], Fields: client.RowFields()}
+		}
+
+		if _, err := repo.UpsertAdRows(ctx, writes); err != nil {
+			return written, errors.WithMessage(err, "can not store fetched rows")
+		}
+		if err := onRowsWritten(ctx, repo, rows); err != nil {
+			return written, err
+		}
+		written += len(rows)
+		logging.L(ctx).Debug("platform data synced", zap.String("accountID", account.ID), zap.Time("since", first), zap.Time("until", last), zap.Int("rows", len(rows)))
+	}
+
+	return written, nil
+}
+
+// daysToFetch returns the first and last day between since and until that are missing from freshness, or are
+// recent days written longer than MaxAge ago. Days after now are never fetched, zero days mean nothing to fetch.
+func daysToFetch(freshness map[time.Time]time.Time, since time.Time, until time.Time, now time.Time, options SyncOptions) (time.Time, time.Time) {
+	// Freshness is keyed by UTC midnight, a range given with a clock time still covers its whole days
+	since, until = utcDay(since), utcDay(until)
+	today := utcDay(now)
+	if until.After(today) {
+		until = today
+	}
+	refreshFrom := today.AddDate(0, 0, 1-options.RefreshDays)
+
+	var first, last time.Time
+	for day := since; !day.After(until); day = day.AddDate(0, 0, 1) {
+		updatedAt, ok := freshness[day]
+		stale := !day.Before(refreshFrom) && now.Sub(updatedAt) > options.MaxAge
+		if ok && !stale {
+			continue
+		}
+		if first.IsZero() {
+			first = day
+		}
+		last = day
+	}
+
+	return first, last
+}
+
+// utcDay returns the UTC midnight starting the day of t.
+func utcDay(t time.Time) time.Time {
+	t = t.UTC()
+
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
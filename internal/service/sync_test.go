@@ -0,0 +1,110 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDaysToFetch(t *testing.T) {
+	now := time.Date(2024, 4, 10, 12, 0, 0, 0, time.UTC)
+	day := func(d int) time.Time {
+		return time.Date(2024, 4, d, 0, 0, 0, 0, time.UTC)
+	}
+	fresh := now.Add(-time.Hour)
+	stale := now.Add(-7 * time.Hour)
+
+	tests := []struct {
+		name      string
+		freshness map[time.Time]time.Time
+		since     time.Time
+		until     time.Time
+		first     time.Time
+		last      time.Time
+	}{
+		{
+			name:      "all days stored and fresh",
+			freshness: map[time.Time]time.Time{day(1): stale, day(2): stale, day(8): fresh, day(9): fresh, day(10): fresh},
+			since:     day(1),
+			until:     day(2),
+		},
+		{
+			name:      "missing day in the middle",
+			freshness: map[time.Time]time.Time{day(1): stale, day(3): stale},
+			since:     day(1),
+			until:     day(3),
+			first:     day(2),
+			last:      day(2),
+		},
+		{
+			name:      "old days are kept however old their numbers",
+			freshness: map[time.Time]time.Time{day(1): {}, day(2): {}},
+			since:     day(1),
+			until:     day(2),
+		},
+		{
+			name:      "stale recent days are refetched",
+			freshness: map[time.Time]time.Time{day(7): stale, day(8): stale, day(9): fresh, day(10): fresh},
+			since:     day(7),
+			until:     day(10),
+			first:     day(8),
+			last:      day(8),
+		},
+		{
+			name:      "range spans missing and stale days",
+			freshness: map[time.Time]time.Time{day(6): fresh, day(9): fresh, day(10): stale},
+			since:     day(5),
+			until:     day(10),
+			first:     day(5),
+			last:      day(10),
+		},
+		{
+			name:      "days after today are never fetched",
+			freshness: map[time.Time]time.Time{day(10): fresh},
+			since:     day(10),
+			until:     day(12),
+		},
+		{
+			name:  "nothing stored",
+			since: day(9),
+			until: day(12),
+			first: day(9),
+			last:  day(10),
+		},
+		{
+			name:  "range with clock times covers whole days",
+			since: day(8).Add(13 * time.Hour),
+			until: day(9).Add(6 * time.Hour),
+			first: day(8),
+			last:  day(9),
+		},
+		{
+			name:      "clock times are looked up by their day",
+			freshness: map[time.Time]time.Time{day(1): stale, day(2): stale},
+			since:     day(1).Add(13 * time.Hour),
+			until:     day(2).Add(6 * time.Hour),
+		},
+		{
+			name:  "same day with clock times",
+			since: day(10).Add(8 * time.Hour),
+			until: day(10).Add(11 * time.Hour),
+			first: day(10),
+			last:  day(10),
+		},
+		{
+			name:  "same day given in another zone",
+			since: day(9).Add(20 * time.Hour).In(time.FixedZone("UTC+7", 7*3600)),
+			until: day(9).Add(22 * time.Hour).In(time.FixedZone("UTC+7", 7*3600)),
+			first: day(9),
+			last:  day(9),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			first, last := daysToFetch(test.freshness, test.since, test.until, now, DefaultSyncOptions)
+			if !first.Equal(test.first) || !last.Equal(test.last) {
+				t.Errorf("daysToFetch() = %s, %s, want %s, %s", first, last, test.first, test.last)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"github.com/pkg/errors"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const activeStatus = "ACTIVE"
+
+// requiredUtmParameters must be present with a value on every tracked destination url.
+var requiredUtmParameters = []string{"utm_source", "utm_medium", "utm_campaign"}
+
+// AuditUTM lists the active ads whose tracking parameters are missing or malformed, grouped by campaign.
+func AuditUTM(ctx context.Context, request repository.RequestInput, repo *repository.MongodbRepository) (*repository.UtmAuditReport, error) {
+	since, until := request.DateRange()
+	ads, err := repo.AdTracking(ctx, since, until)
+	if err != nil {
+		return nil, errors.WithMessage(err, "can not load ad tracking")
+	}
+
+	return auditUTM(ads, since, until), nil
+}
+
+// auditUTM builds the report of the ads seen between since and until. Spend covers every ad, the untracked
+// share only active ads with tracking issues.
+func auditUTM(ads []repository.AdTracking, since time.Time, until time.Time) *repository.UtmAuditReport {
+	report := &repository.UtmAuditReport{Since: since, Until: until}
+	campaigns := map[string]*repository.UtmAuditCampaign{}
+	for _, ad := range ads {
+		report.Spend += ad.Spend
+		if !strings.EqualFold(ad.AdStatus, activeStatus) {
+			continue
+		}
+		report.ActiveAds++
+
+		issues := utmIssues(ad)
+		if len(issues) == 0 {
+			continue
+		}
+		report.UntrackedAds++
+		report.UntrackedSpend += ad.Spend
+
+		campaign, ok := campaigns[ad.CampaignID]
+		if !ok {
+			campaign = &repository.UtmAuditCampaign{
+				CampaignID:   ad.CampaignID,
+				CampaignName: ad.CampaignName,
+				AccountID:    ad.AccountID,
+			}
+			campaigns[ad.CampaignID] = campaign
+		}
+		campaign.UntrackedSpend += ad.Spend
+		campaign.Ads = append(campaign.Ads, repository.UtmAuditAd{
+			AdID:           ad.AdID,
+			AdName:         ad.AdName,
+			DestinationURL: ad.DestinationURL,
+			Spend:          ad.Spend,
+			Issues:         issues,
+		})
+	}
+
+	// Campaign spend covers all its ads, so the untracked share reads against the whole campaign
+	for _, ad := range ads {
+		if campaign, ok := campaigns[ad.CampaignID]; ok {
+			campaign.Spend += ad.Spend
+		}
+	}
+
+	for _, campaign := range campaigns {
+		sort.Slice(campaign.Ads, func(i, j int) bool {
+			return campaign.Ads[i].Spend > campaign.Ads[j].Spend
+		})
+		report.Campaigns = append(report.Campaigns, *campaign)
+	}
+	sort.Slice(report.Campaigns, func(i, j int) bool {
+		return report.Campaigns[i].UntrackedSpend > report.Campaigns[j].UntrackedSpend
+	})
+
+	if report.Spend > 0 {
+		report.UntrackedSpendPercent = report.UntrackedSpend / report.Spend * 100
+	}
+
+	return report
+}
+
+// utmIssues explains what is wrong with an ad's tracking. Without a destination url only the platform's
+// valid_parameters flag is known.
+func utmIssues(ad repository.AdTracking) []string {
+	if ad.DestinationURL == "" {
+		if ad.ValidParameters {
+			return nil
+		}
+		return []string{"invalid_parameters"}
+	}
+
+	destination, err := url.Parse(ad.DestinationURL)
+	if err != nil {
+		return []string{"malformed_url"}
+	}
+
+	var issues []string
+	query := destination.Query()
+	for _, name := range requiredUtmParameters {
+		values, ok := query[name]
+		switch {
+		case !ok:
+			issues = append(issues, "missing_"+name)
+		case len(values) == 0 || strings.TrimSpace(values[0]) == "":
+			issues = append(issues, "empty_"+name)
+		case strings.ContainsAny(values[0], "{}[]"):
+			// an unexpanded macro such as {campaignid}
+			issues = append(issues, "unresolved_"+name)
+		}
+	}
+	if len(issues) == 0 && !ad.ValidParameters {
+		issues = append(issues, "invalid_parameters")
+	}
+
+	return issues
+}
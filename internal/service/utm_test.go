@@ -0,0 +1,160 @@
+package service
+
+import (
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUtmIssues(t *testing.T) {
+	const tracked = "https://shop.example/p?utm_source=pinterest&utm_medium=cpc&utm_campaign=spring"
+
+	tests := []struct {
+		name string
+		ad   repository.AdTracking
+		want []string
+	}{
+		{name: "tracked", ad: repository.AdTracking{DestinationURL: tracked, ValidParameters: true}},
+		{name: "no url flagged valid by the platform", ad: repository.AdTracking{ValidParameters: true}},
+		{name: "no url flagged invalid by the platform", ad: repository.AdTracking{}, want: []string{"invalid_parameters"}},
+		{name: "malformed url", ad: repository.AdTracking{DestinationURL: "https://shop.example/%zz"}, want: []string{"malformed_url"}},
+		{
+			name: "missing parameters",
+			ad:   repository.AdTracking{DestinationURL: "https://shop.example/p?utm_source=pinterest"},
+			want: []string{"missing_utm_medium", "missing_utm_campaign"},
+		},
+		{
+			name: "empty parameter",
+			ad:   repository.AdTracking{DestinationURL: "https://shop.example/p?utm_source=pinterest&utm_medium=%20&utm_campaign=spring"},
+			want: []string{"empty_utm_medium"},
+		},
+		{
+			name: "unresolved macro",
+			ad:   repository.AdTracking{DestinationURL: "https://shop.example/p?utm_source=pinterest&utm_medium=cpc&utm_campaign={campaignid}"},
+			want: []string{"unresolved_utm_campaign"},
+		},
+		{
+			name: "complete url the platform flags invalid",
+			ad:   repository.AdTracking{DestinationURL: tracked},
+			want: []string{"invalid_parameters"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := utmIssues(test.ad); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("utmIssues() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAuditUTM(t *testing.T) {
+	since := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 4, 7, 0, 0, 0, 0, time.UTC)
+	ad := func(id string, campaignID string, status string, url string, spend float64) repository.AdTracking {
+		return repository.AdTracking{
+			AdID:            id,
+			AdStatus:        status,
+			CampaignID:      campaignID,
+			DestinationURL:  url,
+			ValidParameters: true,
+			Spend:           spend,
+		}
+	}
+	const tracked = "https://shop.example/p?utm_source=pinterest&utm_medium=cpc&utm_campaign=spring"
+	const untracked = "https://shop.example/p"
+
+	tests := []struct {
+		name      string
+		ads       []repository.AdTracking
+		active    int
+		untracked int
+		spend     float64
+		percent   float64
+		campaigns map[string][]string
+	}{
+		{name: "no ads"},
+		{
+			name:      "every ad tracked",
+			ads:       []repository.AdTracking{ad("1", "c1", "ACTIVE", tracked, 40), ad("2", "c1", "active", tracked, 60)},
+			active:    2,
+			spend:     100,
+			campaigns: map[string][]string{},
+		},
+		{
+			name: "untracked share of the whole spend",
+			ads: []repository.AdTracking{
+				ad("1", "c1", "ACTIVE", tracked, 50),
+				ad("2", "c1", "ACTIVE", untracked, 20),
+				ad("3", "c2", "ACTIVE", "https://shop.example/%zz", 30),
+				ad("4", "c2", "ACTIVE", untracked, 5),
+				// Paused ads count in the spend, not in the audit
+				ad("5", "c3", "PAUSED", untracked, 95),
+			},
+			active:    4,
+			untracked: 3,
+			spend:     200,
+			percent:   27.5,
+			campaigns: map[string][]string{"c1": {"2"}, "c2": {"3", "4"}},
+		},
+		{
+			name:      "untracked ads without spend",
+			ads:       []repository.AdTracking{ad("1", "c1", "ACTIVE", untracked, 0)},
+			active:    1,
+			untracked: 1,
+			campaigns: map[string][]string{"c1": {"1"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := auditUTM(test.ads, since, until)
+			if report.ActiveAds != test.active || report.UntrackedAds != test.untracked {
+				t.Errorf("auditUTM() active, untracked = %d, %d, want %d, %d", report.ActiveAds, report.UntrackedAds, test.active, test.untracked)
+			}
+			if report.Spend != test.spend {
+				t.Errorf("auditUTM() spend = %v, want %v", report.Spend, test.spend)
+			}
+			if math.IsNaN(report.UntrackedSpendPercent) || math.Abs(report.UntrackedSpendPercent-test.percent) > 1e-9 {
+				t.Errorf("auditUTM() untracked spend percent = %v, want %v", report.UntrackedSpendPercent, test.percent)
+			}
+			if !report.Since.Equal(since) || !report.Until.Equal(until) {
+				t.Errorf("auditUTM() range = %s, %s, want %s, %s", report.Since, report.Until, since, until)
+			}
+
+			campaigns := map[string][]string{}
+			for _, campaign := range report.Campaigns {
+				for _, ad := range campaign.Ads {
+					campaigns[campaign.CampaignID] = append(campaigns[campaign.CampaignID], ad.AdID)
+				}
+			}
+			if test.campaigns != nil && !reflect.DeepEqual(campaigns, test.campaigns) {
+				t.Errorf("auditUTM() untracked ads per campaign = %v, want %v", campaigns, test.campaigns)
+			}
+		})
+	}
+}
+
+func TestAuditUTMOrder(t *testing.T) {
+	ads := []repository.AdTracking{
+		{AdID: "1", AdStatus: "ACTIVE", CampaignID: "c1", Spend: 10},
+		{AdID: "2", AdStatus: "ACTIVE", CampaignID: "c2", Spend: 30},
+		{AdID: "3", AdStatus: "ACTIVE", CampaignID: "c2", Spend: 50},
+		{AdID: "4", AdStatus: "ACTIVE", CampaignID: "c1", Spend: 5, DestinationURL: "https://shop.example/p?utm_source=a&utm_medium=b&utm_campaign=c", ValidParameters: true},
+	}
+
+	report := auditUTM(ads, time.Time{}, time.Time{})
+	if len(report.Campaigns) != 2 || report.Campaigns[0].CampaignID != "c2" {
+		t.Fatalf("auditUTM() campaigns = %+v, want c2 with the most untracked spend first", report.Campaigns)
+	}
+	if got := report.Campaigns[0].Ads; got[0].AdID != "3" || got[1].AdID != "2" {
+		t.Errorf("auditUTM() c2 ads = %+v, want the highest spend first", got)
+	}
+	// The campaign spend reads against every ad of the campaign, tracked ones included
+	if got := report.Campaigns[1]; got.Spend != 15 || got.UntrackedSpend != 10 {
+		t.Errorf("auditUTM() c1 spend, untracked = %v, %v, want 15, 10", got.Spend, got.UntrackedSpend)
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"github.com/minhlong/go-aws-boilerplate/internal/repository"
+)
+
+// EntityRef locates one node of the insight tree.
+type EntityRef struct {
+	Level      string
+	ID         string
+	Name       string
+	Status     string
+	AccountID  string
+	CampaignID string
+	AdGroupID  string
+}
+
+// WalkLevel calls fn for every node of the given level, depth first in response order.
+func WalkLevel(accounts []repository.AccountInsight, level string, fn func(EntityRef, *repository.Metrics)) {
+	for i := range accounts {
+		account := &accounts[i]
+		if level == repository.LevelAccount {
+			fn(EntityRef{Level: level, ID: account.AccountID, Name: account.AccountName, AccountID: account.AccountID}, &account.Metrics)
+			continue
+		}
+
+		for j := range account.Campaigns {
+			campaign := &account.Campaigns[j]
+			if level == repository.LevelCampaign {
+				fn(EntityRef{
+					Level:      level,
+					ID:         campaign.CampaignID,
+					Name:       campaign.CampaignName,
+					Status:     campaign.CampaignStatus,
+					AccountID:  account.AccountID,
+					CampaignID: campaign.CampaignID,
+				}, &campaign.Metrics)
+				continue
+			}
+
+			for k := range campaign.AdGroups {
+				adGroup := &campaign.AdGroups[k]
+				if level == repository.LevelAdGroup {
+					fn(EntityRef{
+						Level:      level,
+						ID:         adGroup.AdGroupID,
+						Name:       adGroup.AdGroupName,
+						Status:     adGroup.AdGroupStatus,
+						AccountID:  account.AccountID,
+						CampaignID: campaign.CampaignID,
+						AdGroupID:  adGroup.AdGroupID,
+					}, &adGroup.Metrics)
+					continue
+				}
+
+				for l := range adGroup.Ads {
+					ad := &adGroup.Ads[l]
+					fn(EntityRef{
+						Level:      repository.LevelAd,
+						ID:         ad.AdID,
+						Name:       ad.AdName,
+						Status:     ad.AdStatus,
+						AccountID:  account.AccountID,
+						CampaignID: campaign.CampaignID,
+						AdGroupID:  adGroup.AdGroupID,
+					}, &ad.Metrics)
+				}
+			}
+		}
+	}
+}
+
+// MetricValue reads a metric by its response field name.
+func MetricValue(metrics repository.Metrics, name string) (float64, bool) {
+	switch name {
+	case "clicks":
+		return float64(metrics.Clicks), true
+	case "spend":
+		return metrics.Spend, true
+	case "impressions":
+		return float64(metrics.Impressions), true
+	case "add_to_cart":
+		return metrics.AddToCart, true
+	case "purchases":
+		return metrics.Purchases, true
+	case "purchases_value":
+		return metrics.PurchasesValue, true
+	case "assisted_purchase":
+		return metrics.AssistedPurchase, true
+	case "direct_purchase":
+		return metrics.DirectPurchase, true
+	case "ctr":
+		return metrics.CTR, true
+	case "cost_per_atc":
+		return metrics.CostPerATC, true
+	case "cost_per_purchase":
+		return metrics.CostPerPurchase, true
+	case "conversion_rate":
+		return metrics.ConversionRate, true
+	case "roas":
+		return metrics.ROAS, true
+	default:
+		return 0, false
+	}
+}
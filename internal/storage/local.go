@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+)
+
+type LocalStore struct {
+	Dir string
+}
+
+func NewLocalStore(dir string) *LocalStore {
+	return &LocalStore{Dir: dir}
+}
+
+func (l *LocalStore) path(key string) string {
+	return filepath.Join(l.Dir, filepath.FromSlash(key))
+}
+
+func (l *LocalStore) Put(_ context.Context, key string, _ string, body []byte) error {
+	path := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.WithMessage(err, "can not create storage directory")
+	}
+	if err := os.WriteFile(path, body, 0644); err != nil {
+		return errors.WithMessage(err, "can not write object")
+	}
+
+	return nil
+}
+
+func (l *LocalStore) Get(_ context.Context, key string) ([]byte, error) {
+	body, err := os.ReadFile(l.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, "can not read object")
+	}
+
+	return body, nil
+}
+
+func (l *LocalStore) URL(_ context.Context, key string) (string, error) {
+	path, err := filepath.Abs(l.path(key))
+	if err != nil {
+		return "", err
+	}
+
+	return "file://" + filepath.ToSlash(path), nil
+}
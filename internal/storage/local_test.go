@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStoreGet(t *testing.T) {
+	store := NewLocalStore(t.TempDir())
+	ctx := context.Background()
+	if err := store.Put(ctx, "archives/1/2024-01.jsonl.gz", "application/gzip", []byte("body")); err != nil {
+		t.Fatal(err)
+	}
+	// A directory where an object is expected can not be read, and is not a missing object
+	if err := os.MkdirAll(filepath.Join(store.Dir, "archives", "1", "2024-02.jsonl.gz"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		key      string
+		body     string
+		notFound bool
+		fails    bool
+	}{
+		{name: "stored object", key: "archives/1/2024-01.jsonl.gz", body: "body"},
+		{name: "missing object", key: "archives/1/2023-12.jsonl.gz", notFound: true, fails: true},
+		{name: "unreadable object", key: "archives/1/2024-02.jsonl.gz", fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, err := store.Get(ctx, test.key)
+			if (err != nil) != test.fails {
+				t.Fatalf("Get() error = %v, want failure %v", err, test.fails)
+			}
+			if errors.Is(err, ErrNotFound) != test.notFound {
+				t.Errorf("Get() error = %v, want not found %v", err, test.notFound)
+			}
+			if string(body) != test.body {
+				t.Errorf("Get() = %q, want %q", body, test.body)
+			}
+		})
+	}
+}
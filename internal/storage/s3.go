@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+	"io"
+	"time"
+)
+
+// presignExpiry is how long a download link stays valid.
+const presignExpiry = 24 * time.Hour
+
+var s3Client *s3.S3
+
+func init() {
+	sharedSession := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+	s3Client = s3.New(sharedSession)
+}
+
+type S3Store struct {
+	Bucket string
+}
+
+func NewS3Store(bucket string) *S3Store {
+	return &S3Store{Bucket: bucket}
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, contentType string, body []byte) error {
+	_, err := s3Client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+		Body:        bytes.NewReader(body),
+	})
+	if err != nil {
+		return errors.WithMessage(err, "can not put object")
+	}
+
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	output, err := s3Client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, "can not get object")
+	}
+	defer output.Body.Close()
+
+	return io.ReadAll(output.Body)
+}
+
+func (s *S3Store) URL(_ context.Context, key string) (string, error) {
+	request, _ := s3Client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	url, err := request.Presign(presignExpiry)
+	if err != nil {
+		return "", errors.WithMessage(err, "can not presign object url")
+	}
+
+	return url, nil
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"os"
+)
+
+// ErrNotFound is returned by Get when no object has the key.
+var ErrNotFound = errors.New("object not found")
+
+// ObjectStore keeps generated files (exports, archives) and hands out references to download them.
+type ObjectStore interface {
+	Put(ctx context.Context, key string, contentType string, body []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	URL(ctx context.Context, key string) (string, error)
+}
+
+// NewObjectStore picks the backend from OBJECT_STORE_DRIVER: "s3" (default) or "local" for development.
+func NewObjectStore() (ObjectStore, error) {
+	switch driver := os.Getenv("OBJECT_STORE_DRIVER"); driver {
+	case "", "s3":
+		bucket, ok := os.LookupEnv("OBJECT_STORE_BUCKET")
+		if !ok {
+			return nil, errors.New("OBJECT_STORE_BUCKET is missing")
+		}
+		return NewS3Store(bucket), nil
+	case "local":
+		return NewLocalStore(LocalDir()), nil
+	default:
+		return nil, errors.Errorf("unknown object store driver %q", driver)
+	}
+}
+
+// LocalDir is the directory of the local driver, OBJECT_STORE_DIR or the temporary directory.
+func LocalDir() string {
+	if dir, ok := os.LookupEnv("OBJECT_STORE_DIR"); ok {
+		return dir
+	}
+
+	return os.TempDir()
+}
@@ -1,39 +1,20 @@
 package main
 
 import (
+	"context"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/minhlong/go-aws-boilerplate/internal/handler"
-	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
-	"os"
+	"github.com/minhlong/go-aws-boilerplate/pkg/logging"
+	"github.com/minhlong/go-aws-boilerplate/pkg/tracing"
 )
 
 func main() {
-	// Init log for debugging
-	initLogger()
+	// Init JSON logger
+	logging.Init()
 
-	// Declare lambda handle function
-	lambda.Start(handler.HandleLambdaEvent)
-}
-
-func initLogger() {
-	config := zap.NewProductionEncoderConfig()
-	config.EncodeTime = zapcore.ISO8601TimeEncoder
-
-	fileEncoder := zapcore.NewJSONEncoder(config)
-	consoleEncoder := zapcore.NewConsoleEncoder(config)
-
-	logFile, _ := os.OpenFile("logger.json5", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	writer := zapcore.AddSync(logFile)
-	defaultLogLevel := zapcore.DebugLevel
-
-	// Log both file and console
-	core := zapcore.NewTee(
-		zapcore.NewCore(fileEncoder, writer, defaultLogLevel),
-		zapcore.NewCore(consoleEncoder, zapcore.AddSync(os.Stdout), defaultLogLevel),
-	)
-
-	logger := zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
+	// Init tracing, TRACING_EXPORTER picks where spans go
+	tracing.Init(context.Background())
 
-	zap.ReplaceGlobals(logger)
+	// Declare lambda handle function, serving both the API Gateway route and the SQS queue
+	lambda.Start(handler.HandleFunctionEvent)
 }
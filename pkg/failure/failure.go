@@ -0,0 +1,81 @@
+// Package failure classifies errors by what should happen to the job that hit them: validation failures are
+// dropped, transient failures retried and permanent failures dead lettered with their reason.
+package failure
+
+import (
+	"errors"
+	"fmt"
+)
+
+type Kind string
+
+const (
+	// KindValidation marks a request that can never succeed as sent, retrying it is pointless.
+	KindValidation Kind = "validation"
+	// KindTransient marks a failure that may pass on retry, such as a network error or throttling.
+	KindTransient Kind = "transient"
+	// KindPermanent marks a failure of a valid request that retrying will not fix, such as a misconfiguration.
+	KindPermanent Kind = "permanent"
+)
+
+type Error struct {
+	Kind   Kind
+	Reason string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Reason
+	}
+	if e.Reason == "" {
+		return e.Err.Error()
+	}
+
+	return e.Reason + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func Validation(err error, reason string) error {
+	return &Error{Kind: KindValidation, Reason: reason, Err: err}
+}
+
+func Validationf(format string, args ...interface{}) error {
+	return &Error{Kind: KindValidation, Reason: fmt.Sprintf(format, args...)}
+}
+
+func Transient(err error, reason string) error {
+	return &Error{Kind: KindTransient, Reason: reason, Err: err}
+}
+
+func Permanent(err error, reason string) error {
+	return &Error{Kind: KindPermanent, Reason: reason, Err: err}
+}
+
+func Permanentf(format string, args ...interface{}) error {
+	return &Error{Kind: KindPermanent, Reason: fmt.Sprintf(format, args...)}
+}
+
+// KindOf returns the kind of the outermost classified error in the chain. Unclassified errors are treated as
+// transient, SQS then retries them and moves them to the dead letter queue once the receive count runs out.
+func KindOf(err error) Kind {
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified.Kind
+	}
+
+	return KindTransient
+}
+
+// ReasonOf returns the reason of the outermost classified error, or the error text when there is none.
+func ReasonOf(err error) string {
+	var classified *Error
+	if errors.As(err, &classified) && classified.Reason != "" {
+		return classified.Reason
+	}
+
+	return err.Error()
+}
@@ -0,0 +1,55 @@
+// Package logging sets up the process logger and carries request scoped fields through the context.
+package logging
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"os"
+)
+
+type contextKey struct{}
+
+// Init replaces the global logger with a JSON logger writing to stdout, which Lambda forwards to CloudWatch.
+// The level is read from LOG_LEVEL (debug, info, warn, error) and defaults to info.
+func Init() {
+	InitWithOutput(os.Stdout)
+}
+
+// InitWithOutput is Init writing elsewhere, command line tools log to stderr to keep stdout for their output.
+func InitWithOutput(output *os.File) {
+	level := zapcore.InfoLevel
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		if err := level.Set(value); err != nil {
+			level = zapcore.InfoLevel
+		}
+	}
+
+	config := zap.NewProductionEncoderConfig()
+	config.EncodeTime = zapcore.ISO8601TimeEncoder
+
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(config), zapcore.Lock(output), level)
+	logger := zap.New(redactCore{core}, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
+
+	zap.ReplaceGlobals(logger)
+}
+
+// With returns a context whose logger adds the fields to every line.
+func With(ctx context.Context, fields ...zap.Field) context.Context {
+	return context.WithValue(ctx, contextKey{}, L(ctx).With(fields...))
+}
+
+// L returns the logger of the context, falling back to the global logger. The Lambda request ID is added
+// when the context belongs to an invocation.
+func L(ctx context.Context) *zap.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*zap.Logger); ok {
+		return logger
+	}
+
+	if invocation, ok := lambdacontext.FromContext(ctx); ok {
+		return zap.L().With(zap.String("requestID", invocation.AwsRequestID))
+	}
+
+	return zap.L()
+}
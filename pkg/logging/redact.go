@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"encoding/json"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// secretKeys are matched case insensitively against field names and JSON keys of logged values.
+var secretKeys = []string{"token", "secret", "password", "authorization"}
+
+// redactCore masks secrets before they reach the encoder, so a request logged as a whole does not leak
+// its access token.
+type redactCore struct {
+	zapcore.Core
+}
+
+func (c redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return redactCore{c.Core.With(redactFields(fields))}
+}
+
+func (c redactCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+
+	return checked
+}
+
+func (c redactCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(entry, redactFields(fields))
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	scrubbed := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		switch {
+		case isSecret(field.Key):
+			scrubbed[i] = zap.String(field.Key, redacted)
+		case field.Type == zapcore.ReflectType:
+			scrubbed[i] = zap.Any(field.Key, redactValue(field.Interface))
+		default:
+			scrubbed[i] = field
+		}
+	}
+
+	return scrubbed
+}
+
+// redactValue goes through the JSON form of a value and masks its secret keys, the value is kept as is when
+// it has no JSON object form.
+func redactValue(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return value
+	}
+
+	return redactJSON(decoded)
+}
+
+func redactJSON(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, child := range typed {
+			if isSecret(key) {
+				typed[key] = redacted
+				continue
+			}
+			typed[key] = redactJSON(child)
+		}
+	case []interface{}:
+		for i, child := range typed {
+			typed[i] = redactJSON(child)
+		}
+	}
+
+	return value
+}
+
+func isSecret(key string) bool {
+	key = strings.ToLower(key)
+	for _, secret := range secretKeys {
+		if strings.Contains(key, secret) {
+			return true
+		}
+	}
+
+	return false
+}
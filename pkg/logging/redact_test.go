@@ -0,0 +1,114 @@
+package logging
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"testing"
+)
+
+type loggedRequest struct {
+	ShopID      int64             `json:"sid"`
+	AccessToken string            `json:"access_token"`
+	Headers     map[string]string `json:"headers"`
+	Accounts    []loggedAccount   `json:"acc"`
+}
+
+type loggedAccount struct {
+	ID     string `json:"id"`
+	Secret string `json:"client_secret"`
+}
+
+func TestRedactFields(t *testing.T) {
+	request := loggedRequest{
+		ShopID:      12,
+		AccessToken: "pina_abc",
+		Headers:     map[string]string{"Authorization": "Bearer abc", "Accept": "application/json"},
+		Accounts:    []loggedAccount{{ID: "a1", Secret: "s3cr3t"}},
+	}
+
+	tests := []struct {
+		name  string
+		field zap.Field
+		check func(t *testing.T, value interface{})
+	}{
+		{
+			name:  "secret field name",
+			field: zap.String("accessToken", "pina_abc"),
+			check: func(t *testing.T, value interface{}) {
+				if value != redacted {
+					t.Errorf("accessToken = %v, want %s", value, redacted)
+				}
+			},
+		},
+		{
+			name:  "case insensitive field name",
+			field: zap.String("DB_PASSWORD", "hunter2"),
+			check: func(t *testing.T, value interface{}) {
+				if value != redacted {
+					t.Errorf("DB_PASSWORD = %v, want %s", value, redacted)
+				}
+			},
+		},
+		{
+			name:  "plain field",
+			field: zap.String("shopName", "Acme"),
+			check: func(t *testing.T, value interface{}) {
+				if value != "Acme" {
+					t.Errorf("shopName = %v, want Acme", value)
+				}
+			},
+		},
+		{
+			name:  "nested values",
+			field: zap.Any("request", request),
+			check: func(t *testing.T, value interface{}) {
+				logged, ok := value.(map[string]interface{})
+				if !ok {
+					t.Fatalf("request = %T, want a JSON object", value)
+				}
+				if logged["access_token"] != redacted || logged["sid"] != float64(12) {
+					t.Errorf("request = %v, want the token masked and the shop kept", logged)
+				}
+				headers, _ := logged["headers"].(map[string]interface{})
+				if headers["Authorization"] != redacted || headers["Accept"] != "application/json" {
+					t.Errorf("headers = %v, want Authorization masked", headers)
+				}
+				accounts, _ := logged["acc"].([]interface{})
+				account, _ := accounts[0].(map[string]interface{})
+				if account["client_secret"] != redacted || account["id"] != "a1" {
+					t.Errorf("account = %v, want client_secret masked", account)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			zap.New(redactCore{core}).Info("logged", test.field)
+
+			entries := logs.All()
+			if len(entries) != 1 {
+				t.Fatalf("logged %d entries, want 1", len(entries))
+			}
+			test.check(t, entries[0].ContextMap()[test.field.Key])
+		})
+	}
+}
+
+func TestRedactWith(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	zap.New(redactCore{core}).With(zap.String("refreshToken", "r1")).Info("logged")
+
+	if value := logs.All()[0].ContextMap()["refreshToken"]; value != redacted {
+		t.Errorf("refreshToken = %v, want %s", value, redacted)
+	}
+}
+
+func TestRedactKeepsValueWithoutJSONForm(t *testing.T) {
+	value := make(chan int)
+	if got := redactValue(value); got != interface{}(value) {
+		t.Errorf("redactValue() = %v, want the value unchanged", got)
+	}
+}
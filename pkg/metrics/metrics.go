@@ -0,0 +1,155 @@
+// Package metrics emits business and operational metrics as CloudWatch Embedded Metric Format log lines, or as
+// Prometheus text for local runs.
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backends picked with METRICS_BACKEND.
+const (
+	BackendEMF        = "emf"
+	BackendPrometheus = "prometheus"
+	BackendNone       = "none"
+
+	defaultNamespace = "InsightService"
+)
+
+type Unit string
+
+const (
+	Milliseconds Unit = "Milliseconds"
+	Bytes        Unit = "Bytes"
+	Count        Unit = "Count"
+)
+
+// Dimension names, every metric is dimensioned by the platform and job type of the request it belongs to.
+const (
+	DimensionPlatform = "Platform"
+	DimensionJobType  = "JobType"
+)
+
+type contextKey struct{}
+
+// mu keeps concurrent lines from interleaving.
+var mu sync.Mutex
+
+// WithDimensions returns a context whose metrics carry the platform and the job type.
+func WithDimensions(ctx context.Context, platform string, jobType string) context.Context {
+	return context.WithValue(ctx, contextKey{}, map[string]string{
+		DimensionPlatform: platform,
+		DimensionJobType:  jobType,
+	})
+}
+
+func dimensions(ctx context.Context) map[string]string {
+	found, _ := ctx.Value(contextKey{}).(map[string]string)
+	dims := make(map[string]string, len(found))
+	for key, value := range found {
+		if value != "" {
+			dims[key] = value
+		}
+	}
+
+	return dims
+}
+
+// Emit writes one metric with the dimensions of the context.
+func Emit(ctx context.Context, name string, value float64, unit Unit) {
+	var line []byte
+	switch backend() {
+	case BackendEMF:
+		line = emfLine(name, value, unit, dimensions(ctx), time.Now())
+	case BackendPrometheus:
+		line = prometheusLine(name, value, dimensions(ctx), time.Now())
+	default:
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	os.Stdout.Write(line)
+}
+
+// Duration emits the time elapsed since start in milliseconds.
+func Duration(ctx context.Context, name string, start time.Time) {
+	Emit(ctx, name, float64(time.Since(start))/float64(time.Millisecond), Milliseconds)
+}
+
+// backend defaults to EMF inside Lambda, where CloudWatch picks the lines up from the logs, and to no metrics
+// elsewhere.
+func backend() string {
+	if value := os.Getenv("METRICS_BACKEND"); value != "" {
+		return value
+	}
+	if os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
+		return BackendEMF
+	}
+
+	return BackendNone
+}
+
+func emfLine(name string, value float64, unit Unit, dims map[string]string, now time.Time) []byte {
+	namespace := os.Getenv("METRICS_NAMESPACE")
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+
+	keys := make([]string, 0, len(dims))
+	for key := range dims {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	document := map[string]interface{}{
+		"_aws": map[string]interface{}{
+			"Timestamp": now.UnixMilli(),
+			"CloudWatchMetrics": []map[string]interface{}{{
+				"Namespace":  namespace,
+				"Dimensions": [][]string{keys},
+				"Metrics":    []map[string]string{{"Name": name, "Unit": string(unit)}},
+			}},
+		},
+		name: value,
+	}
+	for key, dim := range dims {
+		document[key] = dim
+	}
+
+	line, _ := json.Marshal(document)
+
+	return append(line, '\n')
+}
+
+func prometheusLine(name string, value float64, dims map[string]string, now time.Time) []byte {
+	labels := make([]string, 0, len(dims))
+	for key, dim := range dims {
+		labels = append(labels, fmt.Sprintf("%s=%q", snakeCase(key), dim))
+	}
+	sort.Strings(labels)
+
+	return []byte(fmt.Sprintf("%s{%s} %g %d\n", snakeCase(name), strings.Join(labels, ","), value, now.UnixMilli()))
+}
+
+// snakeCase turns the CloudWatch style names into Prometheus ones, e.g. JobDuration into job_duration.
+func snakeCase(name string) string {
+	var builder strings.Builder
+	for i, char := range name {
+		if char >= 'A' && char <= 'Z' {
+			if i > 0 {
+				builder.WriteByte('_')
+			}
+			char += 'a' - 'A'
+		}
+		builder.WriteRune(char)
+	}
+
+	return builder.String()
+}
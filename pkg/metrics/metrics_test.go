@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEMFLine(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		namespace  string
+		dims       map[string]string
+		wantNS     string
+		wantDimSet []interface{}
+	}{
+		{
+			name:       "default namespace and sorted dimensions",
+			dims:       map[string]string{DimensionPlatform: "pinterest", DimensionJobType: "insights"},
+			wantNS:     defaultNamespace,
+			wantDimSet: []interface{}{DimensionJobType, DimensionPlatform},
+		},
+		{
+			name:       "configured namespace without dimensions",
+			namespace:  "Staging",
+			dims:       map[string]string{},
+			wantNS:     "Staging",
+			wantDimSet: []interface{}{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("METRICS_NAMESPACE", test.namespace)
+
+			line := emfLine("JobDuration", 12.5, Milliseconds, test.dims, now)
+			if line[len(line)-1] != '\n' {
+				t.Errorf("line %q does not end with a newline", line)
+			}
+
+			var document map[string]interface{}
+			if err := json.Unmarshal(line, &document); err != nil {
+				t.Fatalf("line %q is not JSON: %v", line, err)
+			}
+			if document["JobDuration"] != 12.5 {
+				t.Errorf("JobDuration = %v, want 12.5", document["JobDuration"])
+			}
+			for key, value := range test.dims {
+				if document[key] != value {
+					t.Errorf("%s = %v, want %s", key, document[key], value)
+				}
+			}
+
+			aws, _ := document["_aws"].(map[string]interface{})
+			if aws["Timestamp"] != float64(now.UnixMilli()) {
+				t.Errorf("Timestamp = %v, want %d", aws["Timestamp"], now.UnixMilli())
+			}
+			directives, _ := aws["CloudWatchMetrics"].([]interface{})
+			if len(directives) != 1 {
+				t.Fatalf("CloudWatchMetrics = %v, want one directive", aws["CloudWatchMetrics"])
+			}
+			directive, _ := directives[0].(map[string]interface{})
+			if directive["Namespace"] != test.wantNS {
+				t.Errorf("Namespace = %v, want %s", directive["Namespace"], test.wantNS)
+			}
+			if want := []interface{}{test.wantDimSet}; !reflect.DeepEqual(directive["Dimensions"], want) {
+				t.Errorf("Dimensions = %v, want %v", directive["Dimensions"], want)
+			}
+			want := []interface{}{map[string]interface{}{"Name": "JobDuration", "Unit": "Milliseconds"}}
+			if !reflect.DeepEqual(directive["Metrics"], want) {
+				t.Errorf("Metrics = %v, want %v", directive["Metrics"], want)
+			}
+		})
+	}
+}
+
+func TestPrometheusLine(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value float64
+		dims  map[string]string
+		want  string
+	}{
+		{
+			name:  "labels are snake cased and sorted",
+			value: 3,
+			dims:  map[string]string{DimensionPlatform: "pinterest", DimensionJobType: "insights"},
+			want:  `job_succeeded{job_type="insights",platform="pinterest"} 3 1711972800000` + "\n",
+		},
+		{
+			name:  "no labels",
+			value: 0.5,
+			want:  "job_succeeded{} 0.5 1711972800000\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(prometheusLine("JobSucceeded", test.value, test.dims, now)); got != test.want {
+				t.Errorf("prometheusLine() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDimensions(t *testing.T) {
+	ctx := WithDimensions(context.Background(), "pinterest", "")
+
+	want := map[string]string{DimensionPlatform: "pinterest"}
+	if got := dimensions(ctx); !reflect.DeepEqual(got, want) {
+		t.Errorf("dimensions() = %v, want %v without the empty job type", got, want)
+	}
+	if got := dimensions(context.Background()); len(got) != 0 {
+		t.Errorf("dimensions() = %v, want none", got)
+	}
+}
+
+func TestBackend(t *testing.T) {
+	tests := []struct {
+		name     string
+		backend  string
+		function string
+		want     string
+	}{
+		{name: "configured", backend: BackendPrometheus, function: "insights", want: BackendPrometheus},
+		{name: "lambda", function: "insights", want: BackendEMF},
+		{name: "local", want: BackendNone},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("METRICS_BACKEND", test.backend)
+			t.Setenv("AWS_LAMBDA_FUNCTION_NAME", test.function)
+			if got := backend(); got != test.want {
+				t.Errorf("backend() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
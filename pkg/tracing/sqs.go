@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.opentelemetry.io/otel"
+)
+
+// receivedCarrier reads the trace context from the attributes of a received SQS message.
+type receivedCarrier map[string]events.SQSMessageAttribute
+
+func (c receivedCarrier) Get(key string) string {
+	attribute, ok := c[key]
+	if !ok || attribute.StringValue == nil {
+		return ""
+	}
+
+	return *attribute.StringValue
+}
+
+func (c receivedCarrier) Set(key string, value string) {}
+
+func (c receivedCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// sendCarrier writes the trace context into the attributes of an outgoing SQS message.
+type sendCarrier map[string]*sqs.MessageAttributeValue
+
+func (c sendCarrier) Get(key string) string {
+	attribute, ok := c[key]
+	if !ok || attribute.StringValue == nil {
+		return ""
+	}
+
+	return *attribute.StringValue
+}
+
+func (c sendCarrier) Set(key string, value string) {
+	c[key] = &sqs.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(value),
+	}
+}
+
+func (c sendCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// ExtractSQS continues the trace carried by the message attributes of a received message.
+func ExtractSQS(ctx context.Context, attributes map[string]events.SQSMessageAttribute) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, receivedCarrier(attributes))
+}
+
+// InjectSQS adds the current trace context to the attributes of a message about to be sent.
+func InjectSQS(ctx context.Context, attributes map[string]*sqs.MessageAttributeValue) {
+	otel.GetTextMapPropagator().Inject(ctx, sendCarrier(attributes))
+}
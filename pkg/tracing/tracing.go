@@ -0,0 +1,96 @@
+// Package tracing sets up OpenTelemetry and propagates trace context through SQS messages.
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"os"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+
+	instrumentationName = "github.com/minhlong/go-aws-boilerplate"
+)
+
+var provider *sdktrace.TracerProvider
+
+// Init installs the tracer provider picked by TRACING_EXPORTER: "otlp" sends spans to the collector configured
+// through the standard OTEL_EXPORTER_OTLP_* variables, "stdout" prints them, anything else keeps tracing off.
+// Context is propagated in every mode so a trace started upstream is not broken by this service.
+func Init(ctx context.Context) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch os.Getenv("TRACING_EXPORTER") {
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New()
+	default:
+		return
+	}
+	if err != nil {
+		zap.L().Warn("can not init trace exporter, tracing is off", zap.Error(err))
+		return
+	}
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+}
+
+// Flush exports the pending spans. Lambda freezes the process between invocations, so handlers call it
+// before returning.
+func Flush(ctx context.Context) {
+	if provider == nil {
+		return
+	}
+	if err := provider.ForceFlush(ctx); err != nil {
+		zap.L().Warn("can not flush spans", zap.Error(err))
+	}
+}
+
+// Shutdown flushes and stops the provider, for commands exiting.
+func Shutdown(ctx context.Context) {
+	if provider == nil {
+		return
+	}
+	if err := provider.Shutdown(ctx); err != nil {
+		zap.L().Warn("can not shut tracing down", zap.Error(err))
+	}
+}
+
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End records the error on the span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
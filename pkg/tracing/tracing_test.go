@@ -0,0 +1,79 @@
+package tracing
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.opentelemetry.io/otel/trace"
+	"testing"
+)
+
+func TestSQSRoundTrip(t *testing.T) {
+	t.Setenv("TRACING_EXPORTER", ExporterNone)
+	Init(context.Background())
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	sent := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled})
+	ctx := trace.ContextWithSpanContext(context.Background(), sent)
+
+	attributes := map[string]*sqs.MessageAttributeValue{}
+	InjectSQS(ctx, attributes)
+	if len(attributes) == 0 {
+		t.Fatal("InjectSQS() added no attribute")
+	}
+
+	// SQS hands the attributes to the consumer in the Lambda event shape
+	received := map[string]events.SQSMessageAttribute{}
+	for name, attribute := range attributes {
+		received[name] = events.SQSMessageAttribute{DataType: *attribute.DataType, StringValue: attribute.StringValue}
+	}
+	extracted := trace.SpanContextFromContext(ExtractSQS(context.Background(), received))
+
+	if extracted.TraceID() != traceID || extracted.SpanID() != spanID {
+		t.Errorf("ExtractSQS() = %s/%s, want %s/%s", extracted.TraceID(), extracted.SpanID(), traceID, spanID)
+	}
+	if !extracted.IsRemote() || !extracted.IsSampled() {
+		t.Errorf("ExtractSQS() remote %v sampled %v, want a sampled remote parent", extracted.IsRemote(), extracted.IsSampled())
+	}
+}
+
+func TestExtractSQSWithoutTrace(t *testing.T) {
+	t.Setenv("TRACING_EXPORTER", ExporterNone)
+	Init(context.Background())
+
+	ctx := ExtractSQS(context.Background(), map[string]events.SQSMessageAttribute{})
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		t.Error("ExtractSQS() made up a trace from a message without one")
+	}
+}
+
+func TestInitTracingOff(t *testing.T) {
+	tests := []struct {
+		name     string
+		exporter string
+	}{
+		{name: "unset"},
+		{name: "none", exporter: ExporterNone},
+		{name: "unknown exporter", exporter: "zipkin"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("TRACING_EXPORTER", test.exporter)
+			Init(context.Background())
+
+			if provider != nil {
+				t.Fatal("Init() installed a tracer provider")
+			}
+			_, span := Start(context.Background(), "job")
+			if span.IsRecording() || span.SpanContext().IsValid() {
+				t.Error("Start() returned a recording span, want the no-op tracer")
+			}
+			End(span, nil)
+			// Without a provider flushing and shutting down do nothing
+			Flush(context.Background())
+			Shutdown(context.Background())
+		})
+	}
+}